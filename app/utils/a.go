@@ -3,22 +3,19 @@ package logic
 
 import (
 	"context"
-	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 
 	"bitbucket.org/telexcoengineering/tracker-backend/errors"
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
 	"bitbucket.org/telexcoengineering/tracker-backend/service/metrix"
-	"bitbucket.org/telexcoengineering/tracker-backend/service/telemetry"
 	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"github.com/opentracing/opentracing-go"
 )
 
-
 // --- VS CODE STYLE DASHBOARD ---
 const DashboardHTML = `
 <!DOCTYPE html>
@@ -79,12 +76,17 @@ const DashboardHTML = `
     <aside class="w-12 bg-activity flex flex-col items-center py-4 z-20">
         <button @click="view = 'dashboard'" :class="view === 'dashboard' ? 'text-white border-l-2 border-white' : 'text-gray-500 hover:text-white'" class="p-3 mb-2 w-full flex justify-center"><i data-lucide="layout-dashboard" class="w-6 h-6"></i></button>
         <button @click="view = 'quarantine'" :class="view === 'quarantine' ? 'text-warning-500 border-l-2 border-warning-500' : 'text-gray-500 hover:text-white'" class="p-3 mb-2 w-full flex justify-center"><i data-lucide="skull" class="w-6 h-6"></i></button>
+        <button @click="view = 'shadow'; loadShadow()" :class="view === 'shadow' ? 'text-white border-l-2 border-white' : 'text-gray-500 hover:text-white'" class="p-3 mb-2 w-full flex justify-center"><i data-lucide="ghost" class="w-6 h-6"></i></button>
+        <button @click="view = 'verdicts'; loadVerdicts()" :class="view === 'verdicts' ? 'text-white border-l-2 border-white' : 'text-gray-500 hover:text-white'" class="p-3 mb-2 w-full flex justify-center"><i data-lucide="history" class="w-6 h-6"></i></button>
         <div class="flex-1"></div>
         <button @click="inspectorOpen = !inspectorOpen" class="p-3 text-gray-500 hover:text-white"><i data-lucide="panel-right" class="w-6 h-6"></i></button>
     </aside>
 
     <aside class="w-64 bg-sidebar border-r border-border hidden md:flex flex-col">
-        <div class="h-8 flex items-center px-4 text-[10px] font-bold uppercase tracking-wider text-gray-400">Explorer</div>
+        <div class="h-8 flex items-center justify-between px-4 text-[10px] font-bold uppercase tracking-wider text-gray-400">
+            <span>Explorer</span>
+            <span class="normal-case font-normal text-gray-500" x-show="me.operator" x-text="me.operator + ' · ' + me.role"></span>
+        </div>
         <div class="px-2">
             <div class="bg-black/20 p-1 flex items-center border border-border rounded mb-2">
                 <i data-lucide="search" class="w-3 h-3 ml-1 mr-2 text-gray-500"></i>
@@ -104,7 +106,7 @@ const DashboardHTML = `
             <div class="flex items-center gap-2">
                 <i data-lucide="wifi" class="w-3 h-3"></i> <span x-text="ping + 'ms'"></span>
             </div>
-            <span x-text="stats.total_hits + ' Events'"></span>
+            <span x-text="stats.total_hits + ' Events'"></span>
         </div>
 
     </aside>
@@ -241,7 +243,7 @@ const DashboardHTML = `
                                             <td class="p-2 pl-4 text-accent font-bold" x-text="t.tracker_phone_id"></td>
                                             <td class="p-2 text-gray-300" x-text="t.tracked_phone_number"></td>
                                             <td class="p-2 relative" x-data="{ open: false, loading: false }">
-                                                <button @click="open = !open" 
+                                                <button @click="open = can('operator') && !open" 
                                                         @click.outside="open = false"
                                                         class="text-[9px] font-bold px-2 py-0.5 rounded border flex items-center gap-1 transition-all"
                                                         :class="{
@@ -268,7 +270,7 @@ const DashboardHTML = `
                                                             // Call API
                                                             fetch('/dashboard/api/relations/update', {
                                                                 method: 'POST',
-                                                                body: JSON.stringify({ id: t.id, status: opt })
+                                                                body: JSON.stringify({ id: t.id, status: opt, tracked_telegram_id: t.tracked_telegram_id })
                                                             }).then(r => {
                                                                 if(r.ok) { 
                                                                     t.status = opt; // Update UI instantly
@@ -305,8 +307,14 @@ const DashboardHTML = `
                 <i data-lucide="activity" class="w-3 h-3 mr-2 text-yellow-500"></i> Live_Telemetry.json
             </div>
             <div class="px-4 flex items-center cursor-pointer min-w-fit" :class="view === 'quarantine' ? 'vs-tab-active' : 'vs-tab-inactive'" @click="view = 'quarantine'">
-                <i data-lucide="shield-alert" class="w-3 h-3 mr-2 text-red-500"></i> Quarantine_Zone.list
-            </div>
+                <i data-lucide="shield-alert" class="w-3 h-3 mr-2 text-red-500"></i> Quarantine_Zone.list
+            </div>
+            <div class="px-4 flex items-center cursor-pointer min-w-fit" :class="view === 'shadow' ? 'vs-tab-active' : 'vs-tab-inactive'" @click="view = 'shadow'; loadShadow()">
+                <i data-lucide="ghost" class="w-3 h-3 mr-2 text-gray-400"></i> Shadow_Verdicts.log
+            </div>
+            <div class="px-4 flex items-center cursor-pointer min-w-fit" :class="view === 'verdicts' ? 'vs-tab-active' : 'vs-tab-inactive'" @click="view = 'verdicts'; loadVerdicts()">
+                <i data-lucide="history" class="w-3 h-3 mr-2 text-red-400"></i> Kill_Verdicts.log
+            </div>
         </div>
 
         <div class="flex-1 overflow-y-auto p-0 relative" id="mainScroll">
@@ -330,9 +338,27 @@ const DashboardHTML = `
                          <div class="text-2xl" :class="stats.rate > 98 ? 'text-green-500' : 'text-red-500'" x-text="stats.rate + '%'">0%</div>
                      </div>
                  </div>
-                <div class="h-64 bg-sidebar border border-border p-0 relative">
-                    <div id="trafficChart" class="w-full h-full"></div>
-                </div>
+                <div class="h-64 bg-sidebar border border-border p-0 relative">
+                    <div id="trafficChart" class="w-full h-full"></div>
+                </div>
+
+                <div class="bg-sidebar border border-border">
+                    <div class="px-4 py-1 text-xs border-b border-border flex justify-between items-center h-8">
+                        <span class="font-bold text-gray-500">TOP ERRORS</span>
+                        <button x-show="errorClass" @click="toggleErrorClass(errorClass)" class="text-[10px] text-gray-400 hover:text-white" x-text="'clear filter: ' + errorClass"></button>
+                    </div>
+                    <template x-for="ec in (stats.error_classes || [])" :key="ec.code">
+                        <div @click="toggleErrorClass(ec.code)" class="flex items-center gap-4 px-4 py-1 cursor-pointer hover:bg-activity"
+                             :class="errorClass === ec.code ? 'bg-activity' : ''">
+                            <span class="w-48 truncate font-bold" :class="errorClass === ec.code ? 'text-white' : 'text-red-400'" x-text="ec.code"></span>
+                            <span class="w-16 text-right text-gray-400" x-text="formatCompact(ec.total)"></span>
+                            <svg viewBox="0 0 100 20" preserveAspectRatio="none" class="flex-1 h-5">
+                                <polyline :points="sparkPoints(ec.series)" fill="none" stroke="#ef4444" stroke-width="1.5" vector-effect="non-scaling-stroke"></polyline>
+                            </svg>
+                        </div>
+                    </template>
+                    <div x-show="!stats.error_classes || stats.error_classes.length === 0" class="px-4 py-3 text-gray-600 italic">No upstream errors counted yet.</div>
+                </div>
 
 <div class="bg-black border border-border font-mono text-sm flex flex-col h-96">
     <div class="bg-sidebar px-4 py-1 text-xs border-b border-border flex justify-between items-center shrink-0 h-8">
@@ -352,7 +378,9 @@ const DashboardHTML = `
             </div>
         </div>
         <div class="flex gap-2">
-            <button @click="clearFeed" class="hover:text-white" title="Clear All Data"><i data-lucide="trash" class="w-3 h-3"></i></button>
+            <span x-show="resetJob" class="text-gray-500" x-text="resetJob ? ('reset ' + resetJob.scope + ': ' + resetJob.state + ' (' + resetJob.deleted + ' keys)') : ''"></span>
+            <button x-show="can('admin')" @click="clearFeed" class="hover:text-white" title="Clear Feed"><i data-lucide="trash" class="w-3 h-3"></i></button>
+            <button x-show="can('admin')" @click="resetAll" class="hover:text-red-500" title="Reset All Data"><i data-lucide="bomb" class="w-3 h-3"></i></button>
         </div>
     </div>
 
@@ -370,7 +398,10 @@ const DashboardHTML = `
                 <span class="text-purple-400 hover:underline shrink-0" 
                       @click.stop="inspect(log.tg, 'user')" x-text="'U:'+log.tg"></span>
                 
-                <span class="text-gray-400 truncate flex-1" x-text="log.e ? log.e : 'OK ('+log.ms+'ms)'"></span>
+                <span x-show="log.ec" class="shrink-0 px-1 text-[10px] border"
+                      :class="log.er ? 'text-yellow-500 border-yellow-700' : 'text-red-400 border-red-800'"
+                      :title="log.eu + (log.er ? ' (retryable)' : '')" x-text="log.ec"></span>
+                <span class="text-gray-400 truncate flex-1" x-text="log.e ? log.e : 'OK ('+log.ms+'ms)'"></span>
             </div>
         </template>
         
@@ -403,14 +434,22 @@ const DashboardHTML = `
                                 
                                 <td class="p-3">
                                     <div class="flex gap-0.5">
-                                        <template x-for="i in 10" :key="i">
-                                            <div
-                                                class="w-1.5 h-4 transition-all duration-300"
-                                                :class="(q.strikes === 0 || i <= q.strikes)
-                                                    ? 'bg-red-500'
-                                                    : 'bg-gray-700'">
-                                            </div>
-                                        </template>
+                                        <template x-for="i in strikeSegments()" :key="i">
+                                            <div
+                                                class="w-1.5 h-4 transition-all duration-300"
+                                                :class="(q.strikes === 0 || i <= strikeFill(q.strikes))
+                                                    ? 'bg-red-500'
+                                                    : 'bg-gray-700'">
+                                            </div>
+                                        </template>
+                                        <span class="ml-2 text-gray-500 text-[10px]" x-text="q.strikes ? (+q.strikes.toFixed(1)) + '/' + strikeThreshold() : ''"></span>
+                                    </div>
+                                    <div class="flex gap-0.5 mt-1">
+                                        <template x-for="s in (q.signals || [])">
+                                            <div class="w-1 h-1 rounded-full"
+                                                :class="s.kind === 'heal' ? 'bg-green-500' : 'bg-red-400'"
+                                                :title="new Date(s.ts * 1000).toLocaleString() + ' ' + s.kind + ((s.rule || s.class) ? ' [' + (s.rule || s.class) + ']' : '') + ' ' + s.weight + ' -> ' + (+s.score.toFixed(2))"></div>
+                                        </template>
                                     </div>
                                 </td>
                                 
@@ -419,24 +458,121 @@ const DashboardHTML = `
                                         <i data-lucide="Skull" class="w-3 h-3"></i>
                                         <div class="w-0 md:w-max invisible md:visible">DELETED<div>
                                     </span>
-                                    <span x-show="q.strikes < 10 && q.strikes > 0" class="text-yellow-500 md:flex items-center md:gap-2">
+                                    <span x-show="q.strikes < strikeThreshold() && q.strikes > 0" class="text-yellow-500 md:flex items-center md:gap-2">
                                         <i data-lucide="alert-triangle" class="w-3 h-3"></i>
-                                        <div class="w-0 md:w-max invisible md:visible">SUSPICIOUS<div>
-                                    </span>
-                                </td>
-                                
-                                <td class="p-3">
-                                    <button @click="inspect(q.id, 'user')" class="bg-blue-600 hover:bg-blue-500 text-white px-3 py-1 text-[10px] rounded-sm">INSPECT</button>
-                                </td>
+                                        <div class="w-0 md:w-max invisible md:visible">SUSPICIOUS<div>
+                                    </span>
+                                    <span x-show="q.review" class="text-orange-400 font-bold md:flex items-center md:gap-2"
+                                        :title="q.review && q.review.auto_approve_at ? 'auto-approves ' + new Date(q.review.auto_approve_at * 1000).toLocaleString() : 'waiting for an operator'">
+                                        <i data-lucide="gavel" class="w-3 h-3"></i>
+                                        <div class="w-0 md:w-max invisible md:visible">PENDING REVIEW<div>
+                                    </span>
+                                </td>
+                                
+                                <td class="p-3 flex gap-1">
+                                    <button @click="inspect(q.id, 'user')" class="bg-blue-600 hover:bg-blue-500 text-white px-3 py-1 text-[10px] rounded-sm">INSPECT</button>
+                                    <template x-if="q.review && can('operator')">
+                                        <div class="flex gap-1">
+                                            <button @click="decideReview(q.id, 'approve')" class="bg-red-700 hover:bg-red-600 text-white px-3 py-1 text-[10px] rounded-sm">APPROVE</button>
+                                            <button @click="decideReview(q.id, 'reject')" class="bg-green-700 hover:bg-green-600 text-white px-3 py-1 text-[10px] rounded-sm">REJECT</button>
+                                        </div>
+                                    </template>
+                                </td>
                             </tr>
                         </template>
                         
-                        <tr x-show="!stats.quarantine_list || stats.quarantine_list.length === 0">
-                            <td colspan="4" class="p-8 text-center text-gray-600 italic">No users in quarantine zone.</td>
-                        </tr>
-                    </tbody>
-                </table>
-            </div>
+                        <tr x-show="!stats.quarantine_list || stats.quarantine_list.length === 0">
+                            <td colspan="4" class="p-8 text-center text-gray-600 italic">No users in quarantine zone.</td>
+                        </tr>
+                    </tbody>
+                </table>
+            </div>
+
+            <div x-show="view === 'shadow'" class="p-0">
+                <div class="grid grid-cols-2 md:grid-cols-5 gap-0 md:gap-4 p-1 md:p-6">
+                    <div class="bg-sidebar border border-border p-4">
+                        <div class="text-gray-500 text-[10px] uppercase flex justify-between">Mode
+                            <button x-show="can('operator')" @click="reconcileShadow()" class="hover:text-white" title="Confirm verdicts the DB has as deleted"><i data-lucide="database" class="w-3 h-3"></i></button>
+                        </div>
+                        <div class="text-lg font-bold" :class="shadow.mode === 'shadow' ? 'text-gray-300' : 'text-red-500'" x-text="(shadow.mode || '-').toUpperCase()"></div>
+                    </div>
+                    <div class="bg-sidebar border border-border p-4">
+                        <div class="text-gray-500 text-[10px] uppercase">Would-Kill</div>
+                        <div class="text-lg font-bold text-white" x-text="shadow.summary.total"></div>
+                    </div>
+                    <div class="bg-sidebar border border-border p-4">
+                        <div class="text-gray-500 text-[10px] uppercase">Confirmed</div>
+                        <div class="text-lg font-bold text-red-500" x-text="shadow.summary.confirmed"></div>
+                    </div>
+                    <div class="bg-sidebar border border-border p-4">
+                        <div class="text-gray-500 text-[10px] uppercase">False Positive</div>
+                        <div class="text-lg font-bold text-green-500" x-text="shadow.summary.false_positives"></div>
+                    </div>
+                    <div class="bg-sidebar border border-border p-4">
+                        <div class="text-gray-500 text-[10px] uppercase">FP Rate (settled)</div>
+                        <div class="text-lg font-bold text-yellow-500" x-text="shadow.summary.false_positive_rate.toFixed(1) + '%'"></div>
+                    </div>
+                </div>
+                <table class="w-full text-left border-collapse">
+                    <thead class="bg-sidebar text-gray-500 sticky top-0">
+                        <tr>
+                            <th class="p-3 border-b border-border">ID</th>
+                            <th class="p-3 border-b border-border">Verdict</th>
+                            <th class="p-3 border-b border-border">Score</th>
+                            <th class="p-3 border-b border-border">Outcome</th>
+                        </tr>
+                    </thead>
+                    <tbody class="divide-y divide-border">
+                        <template x-for="v in shadow.verdicts" :key="v.id">
+                            <tr class="hover:bg-sidebar/50">
+                                <td class="p-3 font-bold cursor-pointer hover:underline text-purple-400" @click="inspect(v.id, 'user')" x-text="v.id"></td>
+                                <td class="p-3 text-gray-400" :title="(v.would_do || []).join('\n')" x-text="timeAgo(v.ts) + ' [' + v.rule + ']'"></td>
+                                <td class="p-3 text-gray-400" x-text="(+v.score.toFixed(1)) + '/' + v.threshold"></td>
+                                <td class="p-3">
+                                    <span class="font-bold"
+                                        :class="v.outcome === 'confirmed' ? 'text-red-500' : (v.outcome === 'false_positive' ? 'text-green-500' : 'text-yellow-500')"
+                                        x-text="v.outcome.toUpperCase().replace('_', ' ')"></span>
+                                    <span x-show="v.outcome_at" class="ml-2 text-gray-600 text-[10px]" x-text="v.outcome_by + ' ' + timeAgo(v.outcome_at)"></span>
+                                </td>
+                            </tr>
+                        </template>
+                        <tr x-show="shadow.verdicts.length === 0">
+                            <td colspan="4" class="p-8 text-center text-gray-600 italic">No shadow verdicts recorded.</td>
+                        </tr>
+                    </tbody>
+                </table>
+            </div>
+
+            <div x-show="view === 'verdicts'" class="p-0">
+                <table class="w-full text-left border-collapse">
+                    <thead class="bg-sidebar text-gray-500 sticky top-0">
+                        <tr>
+                            <th class="p-3 border-b border-border">ID</th>
+                            <th class="p-3 border-b border-border">Killed</th>
+                            <th class="p-3 border-b border-border">By</th>
+                            <th class="p-3 border-b border-border">Before</th>
+                            <th class="p-3 border-b border-border">Action</th>
+                        </tr>
+                    </thead>
+                    <tbody class="divide-y divide-border">
+                        <template x-for="v in verdicts" :key="v.id">
+                            <tr class="hover:bg-sidebar/50">
+                                <td class="p-3 font-bold cursor-pointer hover:underline text-purple-400" @click="inspect(v.telegram_id, 'user')" x-text="v.telegram_id"></td>
+                                <td class="p-3 text-gray-400" :title="(v.changes || []).join('\n')" x-text="timeAgo(v.ts) + ' @ ' + (+v.strikes.toFixed(1)) + '/' + v.threshold"></td>
+                                <td class="p-3 text-gray-400" x-text="v.actor"></td>
+                                <td class="p-3 text-gray-500" x-text="(v.before.is_deleted ? 'deleted' : 'alive') + ', ' + v.before.contacts.length + ' contacts'"></td>
+                                <td class="p-3">
+                                    <span x-show="v.restored_at" class="text-green-500 text-[10px]" x-text="'RESTORED by ' + v.restored_by + ' ' + timeAgo(v.restored_at)"></span>
+                                    <button x-show="!v.restored_at && can('operator')" @click="restoreVerdict(v)" class="bg-green-700 hover:bg-green-600 text-white px-3 py-1 text-[10px] rounded-sm">RESTORE</button>
+                                </td>
+                            </tr>
+                        </template>
+                        <tr x-show="verdicts.length === 0">
+                            <td colspan="5" class="p-8 text-center text-gray-600 italic">No kills recorded.</td>
+                        </tr>
+                    </tbody>
+                </table>
+            </div>
 
         </div>
     </main>
@@ -463,7 +599,7 @@ const DashboardHTML = `
                     <div class="text-3xl text-white font-mono select-all" x-text="activeInspect"></div>
                 </div>
                 <div class="flex flex-col gap-2">
-                    <button @click="toggleWatch()" class="border px-3 py-1 text-xs flex items-center gap-2" :class="inspectorData.isWatched ? 'border-red-500 bg-red-900/20 text-red-400' : 'border-gray-600 text-gray-400 hover:border-white'">
+                    <button x-show="can('operator')" @click="toggleWatch()" class="border px-3 py-1 text-xs flex items-center gap-2" :class="inspectorData.isWatched ? 'border-red-500 bg-red-900/20 text-red-400' : 'border-gray-600 text-gray-400 hover:border-white'">
                         <i :data-lucide="inspectorData.isWatched ? 'eye-off' : 'eye'" class="w-3 h-3"></i>
                         <span x-text="inspectorData.isWatched ? 'STOP WATCHING' : 'WATCH LOGS'"></span>
                     </button>
@@ -480,7 +616,7 @@ const DashboardHTML = `
                     <span>Relationships</span>
                     <span x-text="(inspectorData.related ? inspectorData.related.length : 0) + ' Found'"></span>
                 </div>
-                <button @click="openDeepScan()" 
+                <button x-show="can('operator')" @click="openDeepScan()" 
                         class="w-full mt-4 bg-blue-600 hover:bg-blue-500 text-white py-2 px-3 text-xs font-bold rounded flex items-center justify-center gap-2 transition">
                     <i data-lucide="radar"></i> REVEAL ACTIVE TRACKERS
                 </button>
@@ -526,7 +662,20 @@ const DashboardHTML = `
         </div>
     </aside>
 
-    <script>
+    <script>
+// CSRF: every state-changing fetch echoes the paradox_csrf cookie as a header.
+(function() {
+    const nativeFetch = window.fetch.bind(window);
+    const csrfToken = () => (document.cookie.match(/(?:^|; )paradox_csrf=([^;]*)/) || [])[1] || '';
+    window.fetch = (url, opts = {}) => {
+        const method = (opts.method || 'GET').toUpperCase();
+        if (method !== 'GET' && method !== 'HEAD') {
+            opts.headers = Object.assign({}, opts.headers, { 'X-CSRF-Token': decodeURIComponent(csrfToken()) });
+        }
+        return nativeFetch(url, opts);
+    };
+})();
+
 function app() {
     return {
         view: 'dashboard',
@@ -538,27 +687,74 @@ function app() {
         trackerModalLoading: false,
         trackerModalData: { identity: {}, trackers: [] },
         
-        activeInspect: null,
-        searchId: '',
-        ping: 0,
+        activeInspect: null,
+        searchId: '',
+        ping: 0,
+
+        // Session identity (role gates the controls below; the API enforces it anyway)
+        me: { operator: '', role: 'viewer' },
         
-        // Feed Toggles
-        showOk: true,
+        // Error-class filter for the traffic graph ('' = all errors)
+        errorClass: '',
+
+        // Feed Toggles
+        showOk: true,
         showErr: true,
 
-        stats: { total_hits: 0, total_errs: 0, rate: 0, feed: [], quarantine_list: [] },
+        stats: { total_hits: 0, total_errs: 0, rate: 0, feed: [], quarantine_list: [] },
+        verdicts: [],
+        shadow: { mode: '', summary: { total: 0, pending: 0, confirmed: 0, false_positives: 0, false_positive_rate: 0 }, verdicts: [] },
         inspectorData: { type: '', isWatched: false, history: [], related: [] },
-        seenQuarantineIds: new Set(),
+        seenQuarantineIds: new Set(),
+        resetJob: null,
+        streamLive: false,
+        feedLive: false,
+        lastPoll: 0,
+        pollSoon: null,
         
         // Chart Instance
         chart: null,
 
-        initApp() {
-            this.initIcons();
+        initApp() {
+            this.loadMe();
+            this.initIcons();
             // Initialize ApexCharts immediately
-            this.initChart();
-            setInterval(() => this.poll(), 2000);
-        },
+            this.initChart();
+            this.poll();
+            this.openStream();
+            // Once lookups arrive over the stream, a full poll only refreshes
+            // the graph. Until then the feed and counters still come from /stats.
+            setInterval(() => {
+                if (!this.streamLive || !this.feedLive || Date.now() - this.lastPoll > 30000) this.poll();
+            }, 2000);
+        },
+
+        // Pushes feed entries, counter deltas and quarantine changes.
+        // EventSource reconnects by itself and resumes from Last-Event-ID.
+        openStream() {
+            if (!window.EventSource) return;
+            const es = new EventSource('/dashboard/api/stream');
+            es.onerror = () => { this.streamLive = false; };
+            es.addEventListener('ready', () => { this.streamLive = true; });
+            es.addEventListener('feed', e => {
+                this.feedLive = true;
+                this.stats.feed = [JSON.parse(e.data), ...(this.stats.feed || [])].slice(0, 100);
+            });
+            es.addEventListener('counters', e => {
+                const d = JSON.parse(e.data);
+                this.stats.total_hits += d.hits;
+                this.stats.total_errs += d.errors;
+            });
+            // Quarantine rows carry signals and review state: refetch them.
+            es.addEventListener('quarantine', () => this.schedulePoll());
+            es.addEventListener('reset', () => this.poll());
+            es.addEventListener('resync', () => { this.streamLive = true; this.poll(); });
+        },
+
+        schedulePoll() {
+            clearTimeout(this.pollSoon);
+            this.pollSoon = setTimeout(() => this.poll(), 250);
+        },
 
         initIcons() {
             setTimeout(() => lucide.createIcons(), 100);
@@ -566,7 +762,67 @@ function app() {
             this.$watch('inspectorOpen', () => setTimeout(() => lucide.createIcons(), 50));
         },
 
-        formatCompact(n) { return Intl.NumberFormat('en', { notation: "compact" }).format(n || 0); },
+        async loadMe() {
+            try {
+                let res = await fetch('/dashboard/api/me');
+                if (res.ok) this.me = await res.json();
+            } catch(e) { console.error(e); }
+        },
+
+        async loadShadow() {
+            try {
+                let res = await fetch('/dashboard/api/shadow');
+                if (res.ok) this.shadow = await res.json();
+            } catch(e) { console.error(e); }
+        },
+
+        async reconcileShadow() {
+            try {
+                let res = await fetch('/dashboard/api/shadow/reconcile', { method: 'POST' });
+                if (!res.ok) alert('Reconcile failed: ' + ((await res.json()).error?.message || res.status));
+                this.loadShadow();
+            } catch(e) { console.error(e); }
+        },
+
+        async loadVerdicts() {
+            try {
+                let res = await fetch('/dashboard/api/verdicts');
+                if (res.ok) this.verdicts = (await res.json()).verdicts;
+            } catch(e) { console.error(e); }
+        },
+
+        async restoreVerdict(v) {
+            if (!confirm('Restore ' + v.telegram_id + '? This un-deletes it and resumes tracking.')) return;
+            try {
+                let res = await fetch('/dashboard/api/verdicts/' + v.id + '/restore', { method: 'POST' });
+                if (!res.ok) alert('Restore failed: ' + ((await res.json()).error?.message || res.status));
+                this.loadVerdicts();
+            } catch(e) { console.error(e); }
+        },
+
+        async decideReview(id, decision) {
+            const msg = decision === 'approve'
+                ? 'Mark ' + id + ' as deleted and stop tracking it?'
+                : 'Reject the verdict for ' + id + ' and clear its strikes?';
+            if (!confirm(msg)) return;
+            try {
+                let res = await fetch('/dashboard/api/review/' + id + '/' + decision, { method: 'POST' });
+                if (!res.ok) alert('Review failed: ' + ((await res.json()).error?.message || res.status));
+                this.poll();
+            } catch(e) { console.error(e); }
+        },
+
+        can(role) {
+            const rank = { viewer: 1, operator: 2, admin: 3 };
+            return (rank[this.me.role] || 0) >= rank[role];
+        },
+
+        // Strike bar: one segment per strike up to the policy threshold (capped for width)
+        strikeThreshold() { return (this.stats.policy && this.stats.policy.threshold) || 10; },
+        strikeSegments() { return Math.min(20, Math.ceil(this.strikeThreshold())); },
+        strikeFill(strikes) { return Math.floor(strikes / this.strikeThreshold() * this.strikeSegments()); },
+
+        formatCompact(n) { return Intl.NumberFormat('en', { notation: "compact" }).format(n || 0); },
 
         timeAgo(unixTimestamp) {
             if (!unixTimestamp) return 'Never';
@@ -599,8 +855,9 @@ function app() {
             this.trackerModalLoading = true;
             
             try {
-                let res = await fetch('/dashboard/api/relations/deep?id=' + this.activeInspect);
-                let data = await res.json();
+                let res = await fetch('/dashboard/api/relations/deep?id=' + this.activeInspect);
+                let data = await res.json();
+                if (!res.ok) throw new Error(data.error?.message || res.status);
                 this.trackerModalData = data;
             } catch(e) {
                 console.error(e);
@@ -611,11 +868,13 @@ function app() {
             }
         },
 
-        async poll() {
-            let start = performance.now();
+        async poll() {
+            let start = performance.now();
+            this.lastPoll = Date.now();
             try {
-                let res = await fetch('/dashboard/api/stats');
-                let data = await res.json();
+                let res = await fetch('/dashboard/api/stats' + (this.errorClass ? '?class=' + encodeURIComponent(this.errorClass) : ''));
+                if (!res.ok) return;
+                let data = await res.json();
                 
                 // Glow Logic
                 if (data.quarantine_list) {
@@ -694,12 +953,45 @@ function app() {
 
             this.chart.updateSeries([
                 { name: 'Success', data: g.hits },
-                { name: 'Errors', data: g.errs }
-            ]);
-        },
+                { name: g.class ? 'Errors [' + g.class + ']' : 'Errors', data: g.errs }
+            ]);
+        },
+
+        // Top-N error panel: clicking a code isolates it in the graph
+        toggleErrorClass(code) {
+            this.errorClass = this.errorClass === code ? '' : code;
+            this.poll();
+        },
+
+        sparkPoints(series) {
+            if (!series || series.length === 0) return '';
+            const max = Math.max(1, ...series);
+            const step = 100 / Math.max(1, series.length - 1);
+            return series.map((v, i) => (i * step).toFixed(1) + ',' + (20 - v / max * 18).toFixed(1)).join(' ');
+        },
 
         // --- REST OF HELPERS ---
-        async clearFeed() { if(confirm("Clear Data?")) fetch('/dashboard/api/reset', {method:'POST'}); },
+        async clearFeed() { if(confirm("Clear the live feed?")) this.startReset({scope:'feed'}); },
+        async resetAll() {
+            if (!confirm('Wipe ALL monitoring data, quarantine included? A snapshot is taken first.')) return;
+            let res = await this.startReset({scope:'all'});
+            if (res.status !== 428) return;
+            const body = await res.json();
+            if (prompt('Type RESET to confirm') !== 'RESET') return;
+            this.startReset({scope:'all', confirm: body.error.details.confirm_token});
+        },
+        async startReset(body) {
+            let res = await fetch('/dashboard/api/reset', {method:'POST', body: JSON.stringify(body)});
+            if (res.status === 202) this.watchReset((await res.clone().json()).id);
+            else if (res.status !== 428) alert('Reset failed: ' + ((await res.clone().json()).error?.message || res.status));
+            return res;
+        },
+        async watchReset(id) {
+            let job = await (await fetch('/dashboard/api/reset/' + id)).json();
+            this.resetJob = job;
+            if (job.state === 'running') setTimeout(() => this.watchReset(id), 1000);
+            else this.poll();
+        },
         async inspect(id, type) { this.activeInspect = id; this.inspectorOpen = true; this.inspectorData = {type, history:[]}; await this.fetchDetails(id); },
         inspectLog(log) { this.inspect(log.tg, 'user'); },
         async fetchDetails(id) { let r = await fetch('/dashboard/api/inspect?id='+id); this.inspectorData = await r.json(); },
@@ -735,42 +1027,51 @@ function app() {
 
 // --- NEW INSPECTOR API HANDLERS ---
 
+// InspectRequest is GET /dashboard/api/inspect?id=123.
+type InspectRequest struct {
+	ID TelegramID `query:"id"`
+}
+
+func (r InspectRequest) Validate() error { return requireTelegramID("id", r.ID) }
+
+// InspectResponse describes one ID as the monitor sees it.
+type InspectResponse struct {
+	ID        int64            `json:"id"`
+	Type      string           `json:"type"` // "user", "tracker" or "unknown"
+	IsWatched bool             `json:"isWatched"`
+	History   []LookupLogEntry `json:"history"` // newest first
+	Related   []string         `json:"related"` // trackers of a user, or users of a tracker
+}
+
 // GET /dashboard/api/inspect?id=123
-func (l TelegramLogic) InspectEntity(c *gin.Context) {
-	idStr := c.Query("id")
-	if idStr == "" {
-		c.JSON(400, gin.H{"error": "missing id"})
+func (l TelegramMonitor) InspectEntity(c *gin.Context) {
+	var req InspectRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
 		return
 	}
-	id, _ := strconv.ParseInt(idStr, 10, 64)
+	id := int64(req.ID)
 	ctx := context.Background()
-	r := l.Telemetry.MonitorRedis
 
 	// 1. Check if Watched
-	isWatched, _ := r.SIsMember(ctx, telemetry.KeyWatchlist, idStr).Result()
+	isWatched, _ := store.IsWatched(ctx, id)
 
 	// 2. Check Quarantine Status (implicitly watched)
-	isQuarantined, _ := r.SIsMember(ctx, telemetry.KeyQuarantineSet, id).Result()
+	quarantined, _ := store.IsQuarantined(ctx, id)
 
 	// 3. Fetch History (Deep Logs)
 	// We check history for this ID.
-	historyKey := fmt.Sprintf("monitor:history:%s", idStr)
-	logsRaw, _ := r.LRange(ctx, historyKey, 0, 499).Result() // Get last 500
-
-	var history []map[string]interface{}
-	for _, raw := range logsRaw {
-		var item map[string]interface{}
-		_ = json.Unmarshal([]byte(raw), &item)
-		history = append(history, item)
-	}
+	logsRaw, _ := store.History(ctx, id, 500) // Get last 500
+
+	history := parseLookupLog(logsRaw)
 
 	// 4. Fetch Relationships
 	// Try both U2T and T2U to see what this ID is
-	u2tKey := fmt.Sprintf("monitor:map:u2t:%s", idStr)
-	t2uKey := fmt.Sprintf("monitor:map:t2u:%s", idStr)
-
-	trackers, _ := r.SMembers(ctx, u2tKey).Result()
-	users, _ := r.SMembers(ctx, t2uKey).Result()
+	trackers, users, _ := store.Relations(ctx, id)
 
 	related := []string{}
 	typeStr := "unknown"
@@ -783,62 +1084,94 @@ func (l TelegramLogic) InspectEntity(c *gin.Context) {
 		related = users
 	}
 
-	c.JSON(200, gin.H{
-		"id": id,
-		"type": typeStr,
-		"isWatched": isWatched || isQuarantined,
-		"history":   history,
-		"related":   related,
+	c.JSON(200, InspectResponse{
+		ID:        id,
+		Type:      typeStr,
+		IsWatched: isWatched || quarantined,
+		History:   history,
+		Related:   related,
 	})
 }
 
+// ToggleWatchRequest is POST /dashboard/api/watch.
+type ToggleWatchRequest struct {
+	ID     TelegramID `json:"id"`
+	Action bool       `json:"action"` // true to watch, false to stop
+}
+
+func (r ToggleWatchRequest) Validate() error { return requireTelegramID("id", r.ID) }
+
 // POST /dashboard/api/watch { "id": 123, "action": true }
-func (l TelegramLogic) ToggleWatch(c *gin.Context) {
-	var req struct {
-		ID     interface{} `json:"id"` // can be string or int
-		Action bool        `json:"action"`
+func (l TelegramMonitor) ToggleWatch(c *gin.Context) {
+	var req ToggleWatchRequest
+	if !bindJSON(c, &req) {
+		return
 	}
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
 		return
 	}
-
-	idStr := fmt.Sprintf("%v", req.ID)
+	id := int64(req.ID)
+	idStr := keyspace.Member(id)
 	ctx := context.Background()
 
+	wasWatched, _ := store.IsWatched(ctx, id)
+
+	if err := store.SetWatched(ctx, id, req.Action); err != nil {
+		logger.ZSLogger.Errorw("failed to update watchlist", "id", idStr, "error", err)
+		abortWithError(c, newAPIError(500, "watch_update_failed", "could not update the watchlist"))
+		return
+	}
 	if req.Action {
-		l.Telemetry.MonitorRedis.SAdd(ctx, telemetry.KeyWatchlist, idStr)
 		logger.ZSLogger.Infow("manual watch enabled", "id", idStr)
 	} else {
-		l.Telemetry.MonitorRedis.SRem(ctx, telemetry.KeyWatchlist, idStr)
 		// We do NOT delete the history immediately, we let TTL handle it
 		logger.ZSLogger.Infow("manual watch disabled", "id", idStr)
 	}
+	l.auditRequest(c, AuditActionWatch, idStr, gin.H{"watched": wasWatched}, gin.H{"watched": req.Action})
 
-	c.JSON(200, gin.H{"status": "ok"})
+	c.JSON(200, StatusResponse{Status: "ok"})
 }
 
 // --- LOGIC METHODS (Extension) ---
+// IsDefiniteDeletionError reports whether err should count as a strike:
+// a classifier rule matched it with a definite or suspicious verdict.
 func (l TelegramLogic) IsDefiniteDeletionError(err error) bool {
-	// Console Log
-
-	msg := err.Error()
-	isDeletion := strings.Contains(msg, "PEER_ID_INVALID") ||
-		strings.Contains(msg, "USER_NOT_FOUND") ||
-		strings.Contains(msg, "tdlib_not_found_the_user") ||
-		(strings.Contains(msg, "Qt error code: 400") && strings.Contains(msg, "Not Found"))
+	upstream := AsUpstreamError(err)
+	if upstream == nil {
+		return false
+	}
+	match, ok := CurrentDeletionClassifier().Classify(upstream)
+	isDeletion := ok && match.Verdict.Strikes()
 
 	// Log only if it IS a deletion error to avoid spamming logs for standard network errors
 	if isDeletion {
-		fmt.Printf(">>> DEFINITE DELETION DETECTED: %s\n", msg) // <--- Added
-		logger.ZSLogger.Infow("definite deletion error detected", "error_msg", msg)
+		fmt.Printf(">>> DEFINITE DELETION DETECTED [%s]: %s\n", match.RuleID, upstream.Message) // <--- Added
+		logger.ZSLogger.Infow("deletion error detected",
+			"error_msg", upstream.Message,
+			"error_code", upstream.Code,
+			"upstream", upstream.Upstream,
+			"rule", match.RuleID,
+			"verdict", match.Verdict,
+		)
 		_ = logger.ZSLogger.Sync()
 	}
 
 	return isDeletion
 }
 
-func (l TelegramLogic) ProcessDeletionSignal(inputSpan opentracing.Span, ctx context.Context, telegramID int64) {
+// ProcessDeletionSignal records one strike against telegramID for a failure
+// the caller already judged definite (IsDefiniteDeletionError). It weighs as
+// an unmatched error; ProcessDeletionError weighs by the rule cause matches.
+func (l TelegramMonitor) ProcessDeletionSignal(inputSpan opentracing.Span, ctx context.Context, telegramID int64) {
+	l.ProcessDeletionError(inputSpan, ctx, telegramID, nil)
+}
+
+// ProcessDeletionError records one strike against telegramID, weighted by
+// the classifier rule cause matched under the current StrikePolicy, and fires
+// the kill switch once the policy threshold is reached.
+func (l TelegramMonitor) ProcessDeletionError(inputSpan opentracing.Span, ctx context.Context, telegramID int64, cause error) {
 	fmt.Printf(">>> Processing Deletion Signal for TelegramID: %d\n", telegramID) // <--- Added
 
 	const op errors.Op = "Logic.TelegramMonitoring.ProcessDeletionSignal"
@@ -849,254 +1182,522 @@ func (l TelegramLogic) ProcessDeletionSignal(inputSpan opentracing.Span, ctx con
 	}()
 
 	// Safety Check (Prevents Panic)
-	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+	store := l.monitorStore()
+	if store == nil {
 		fmt.Println(">>> WARN: Telemetry is nil, skipping deletion processing") // <--- Added
 		logger.ZSLogger.Warn("skipping deletion signal processing: telemetry service is nil")
 		return
 	}
 
-	// OLD: Use ZADD with timestamp as score to keep order
-	// l.Telemetry.MonitorRedis.ZAdd(ctx, telemetry.KeyQuarantineSet, &redis.Z{
-	// 	Score:  float64(time.Now().Unix()),
-	// 	Member: telegramID,
-	// })
-
-	// NEW: Use ZAddArgs with NX (Not Exist).
-	// This ensures the timestamp (Score) is set ONLY when they first enter quarantine.
-	// Future strikes won't change their position, keeping the list stable.
-	l.Telemetry.MonitorRedis.ZAddArgs(ctx, telemetry.KeyQuarantineSet, redis.ZAddArgs{
-		NX: true, // <--- CRITICAL FIX: Only add if not already present
-		Members: []redis.Z{{
-			Score:  float64(time.Now().Unix()),
-			Member: telegramID,
-		}},
-	})
+	if upstream := NewUpstreamError(op, cause); upstream != nil {
+		cause = upstream
+	}
+	match := ClassifyDeletionError(cause)
+	if !match.Verdict.Strikes() {
+		logger.ZSLogger.Infow("deletion signal dropped: classifier says no strike",
+			"telegram_id", telegramID,
+			"rule", match.RuleID,
+			"verdict", match.Verdict,
+		)
+		return
+	}
+
+	policy := CurrentStrikePolicy()
+	weight := policy.WeightFor(match)
 
-	// 1. Increment Strike in Monitor Redis
-	key := fmt.Sprintf("monitor:strikes:%d", telegramID)
-	strikes, err := l.Telemetry.MonitorRedis.Incr(ctx, key).Result()
+	// 1. One atomic transition: quarantine (NX, so the first-seen time sticks),
+	// watchlist, decayed score + weight, signal history and the threshold check.
+	now := time.Now()
+	transition, err := store.ApplyStrike(ctx, telegramID, match, weight, now, policy)
 	if err != nil {
 		fmt.Printf(">>> ERROR: Failed to incr strikes: %v\n", err) // <--- Added
-		logger.ZSLogger.Errorw("failed to increment strikes in redis", "telegram_id", telegramID, "error", err)
+		logger.ZSLogger.Errorw("failed to record strike in redis", "telegram_id", telegramID, "error", err)
 		return
 	}
-	l.Telemetry.MonitorRedis.Expire(ctx, key, 7*24*time.Hour)
+	strikes := transition.Score
 
-	fmt.Printf(">>> Strike Recorded! Current Strikes for %d: %d\n", telegramID, strikes) // <--- Added
+	fmt.Printf(">>> Strike Recorded! Current Strikes for %d: %.2f\n", telegramID, strikes) // <--- Added
 	logger.ZSLogger.Infow("deletion strike recorded",
 		"telegram_id", telegramID,
+		"rule", match.RuleID,
+		"verdict", match.Verdict,
+		"weight", weight,
 		"current_strikes", strikes,
 	)
+	publishMonitorEvent(ctx, store, MonitorEventQuarantine, QuarantineEvent{
+		TelegramID: telegramID, Change: QuarantineStruck, Score: strikes, Reason: match.RuleID, At: now.Unix(),
+	})
 
-	// 2. Add to Dashboard Quarantine View
-	l.Telemetry.MonitorRedis.SAdd(ctx, telemetry.KeyQuarantineSet, telegramID)
+	// 2. KILL SWITCH (policy threshold)
+	switch transition.Verdict {
+	case StrikeHeld:
+		logger.ZSLogger.Infow("kill switch held: strikes span too short",
+			"telegram_id", telegramID,
+			"current_strikes", strikes,
+			"span", now.Sub(time.Unix(transition.FirstSeen, 0)).String(),
+			"min_span", policy.MinSpan.Std().String(),
+		)
+		return
+	case StrikeThreshold:
+
+		// Shadow mode: write down the would-kill and leave DB and monitor state alone,
+		// so later signals can still prove the verdict right or wrong.
+		if policy.Mode == StrikeModeShadow {
+			verdict := ShadowVerdict{
+				TelegramID: telegramID,
+				At:         now.Unix(),
+				Score:      strikes,
+				Threshold:  policy.Threshold,
+				Rule:       match.RuleID,
+				WouldDo:    []string{changeMarkDeleted, changeStopTracking},
+				Outcome:    ShadowOutcomePending,
+			}
+			recorded, err := store.RecordShadowVerdict(ctx, verdict)
+			if err != nil {
+				logger.ZSLogger.Errorw("failed to record shadow verdict", "telegram_id", telegramID, "error", err)
+				return
+			}
+			if recorded {
+				logger.ZSLogger.Warnw("shadow kill switch: threshold reached, not enforcing",
+					"telegram_id", telegramID,
+					"current_strikes", strikes,
+					"threshold", policy.Threshold,
+				)
+			}
+			return
+		}
 
-	// 2. NEW: Ensure we start recording history immediately
-	// By being in QuarantineSet, the SafeTelemetry script will automatically pick it up.
-	// However, if we want to be doubly sure or track it even after quarantine is lifted manually:
-	l.Telemetry.MonitorRedis.SAdd(ctx, telemetry.KeyWatchlist, telegramID)
+		// Review mode: park the verdict for an operator instead of writing to the DB.
+		if policy.Review.Enabled {
+			pending := PendingVerdict{
+				TelegramID: telegramID,
+				QueuedAt:   now.Unix(),
+				Score:      strikes,
+				Threshold:  policy.Threshold,
+				Rule:       match.RuleID,
+			}
+			if after := policy.Review.AutoApproveAfter.Std(); after > 0 {
+				pending.AutoApproveAt = now.Add(after).Unix()
+			}
+			queued, err := store.EnqueueReview(ctx, pending)
+			if err != nil {
+				logger.ZSLogger.Errorw("failed to queue verdict for review", "telegram_id", telegramID, "error", err)
+				return
+			}
+			if queued {
+				logger.ZSLogger.Warnw("kill switch pending review: strike threshold reached",
+					"telegram_id", telegramID,
+					"current_strikes", strikes,
+					"threshold", policy.Threshold,
+				)
+			}
+			return
+		}
 
-	// 3. KILL SWITCH (3 Strikes)
-	if strikes >= 10 {
-		fmt.Printf(">>> KILL SWITCH ACTIVATED for %d\n", telegramID) // <--- Added
-		logger.ZSLogger.Warnw("KILL SWITCH ACTIVATED: user reached 3 strikes, disabling tracking",
+		logger.ZSLogger.Warnw("KILL SWITCH ACTIVATED: strike threshold reached, disabling tracking",
 			"telegram_id", telegramID,
+			"current_strikes", strikes,
+			"threshold", policy.Threshold,
 		)
+		// A kill that did not run logged why; the next strike over the
+		// threshold tries again.
+		_ = l.executeKill(inputSpan, ctx, store, telegramID, strikes, AuditActorSystem, "")
+	}
+}
 
-		// DB Updates
-		err = l.TelegramUserRepo.UpdateIsDeletedByTelegramID(inputSpan, ctx, telegramID, true)
-		if err != nil {
-			fmt.Printf(">>> ERROR: Failed to mark deleted in DB: %v\n", err) // <--- Added
-			logger.ZSLogger.Errorw("failed to mark user as deleted in DB", "telegram_id", telegramID, "error", err)
-		}
+// errKillClaimed is executeKill's answer when the kill for an ID already ran.
+var errKillClaimed = stderrors.New("kill already claimed")
+
+// executeKill marks the account deleted, stops tracking it and drops its
+// monitor state. actor is whoever made the call: the kill switch itself, an
+// operator approving a pending verdict, or the auto-approver.
+//
+// The DB writes run at most once per ID: concurrent callers that reached the
+// same verdict lose the kill claim and return without touching anything.
+//
+// On top of that the whole execution runs under the per-ID verdict lease, so
+// a kill and a restore for the same account do not interleave. The lease is
+// checked before every DB write, but the repos do not take its token: a
+// replica that stalls between the check and the write can still race the
+// next holder (see the lease file).
+//
+// A nil error means the kill ran. Otherwise it did not: ErrLeaseHeld and
+// ErrLeaseLost mean another kill or restore holds the account,
+// errKillClaimed that the kill already ran, anything else a failed write.
+// A failed kill hands its claim back so it can be retried; see abandonKill
+// for one that already marked the account deleted.
+func (l TelegramMonitor) executeKill(inputSpan opentracing.Span, ctx context.Context, store MonitorStore, telegramID int64, strikes float64, actor, requestID string) error {
+	lease, err := l.acquireVerdictLease(ctx, telegramID)
+	if err != nil {
+		return err
+	}
+	defer lease.release(ctx)
+
+	verdict := VerdictRecord{
+		Fence:      lease.lease.Token,
+		TelegramID: telegramID,
+		At:         time.Now().Unix(),
+		Actor:      actor,
+		RequestID:  requestID,
+		Strikes:    strikes,
+		Threshold:  CurrentStrikePolicy().Threshold,
+	}
+	if id, err := randomHex(8); err == nil {
+		verdict.ID = id
+	} else {
+		verdict.ID = fmt.Sprintf("%d-%d", telegramID, time.Now().UnixNano())
+	}
 
-		err = l.TrackedTelegramUserRepo.StopTrackingForTelegramID(inputSpan, ctx, telegramID)
-		if err != nil {
-			fmt.Printf(">>> ERROR: Failed to stop tracking in DB: %v\n", err) // <--- Added
-			logger.ZSLogger.Errorw("failed to stop tracking in DB", "telegram_id", telegramID, "error", err)
-		}
+	claimed, err := store.ClaimKill(ctx, telegramID, verdict.ID, killClaimTTL)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to claim kill, not executing", "telegram_id", telegramID, "error", err)
+		return fmt.Errorf("claim kill: %w", err)
+	}
+	if !claimed {
+		logger.ZSLogger.Infow("kill already claimed elsewhere, skipping DB side effects", "telegram_id", telegramID, "actor", actor)
+		return errKillClaimed
+	}
+
+	fmt.Printf(">>> KILL SWITCH ACTIVATED for %d\n", telegramID) // <--- Added
+
+	// Snapshot what we are about to overwrite, so the kill can be restored
+	verdict.Before = l.captureVerdictBefore(inputSpan, ctx, telegramID)
+	if records, err := store.LoadStrikes(ctx, []int64{telegramID}, int64(CurrentStrikePolicy().MaxSignals)); err == nil {
+		verdict.Signals = records[0].Signals
+	}
+
+	if !lease.held(ctx) {
+		// Nothing written yet: hand the kill back so the next signal can retry it.
+		_ = store.ReleaseKillClaim(ctx, telegramID)
+		return ErrLeaseLost
+	}
+
+	// DB Updates
+	err = l.TelegramUserRepo.UpdateIsDeletedByTelegramID(inputSpan, ctx, telegramID, true)
+	if err != nil {
+		fmt.Printf(">>> ERROR: Failed to mark deleted in DB: %v\n", err) // <--- Added
+		logger.ZSLogger.Errorw("failed to mark user as deleted in DB", "telegram_id", telegramID, "error", err)
+		_ = store.ReleaseKillClaim(ctx, telegramID)
+		return fmt.Errorf("mark deleted: %w", err)
+	}
+	verdict.Changes = append(verdict.Changes, changeMarkDeleted)
+
+	if !lease.held(ctx) {
+		logger.ZSLogger.Errorw("verdict lease lost mid-kill, tracking not stopped", "telegram_id", telegramID, "verdict_id", verdict.ID)
+		return l.abandonKill(inputSpan, ctx, store, verdict, nil, ErrLeaseLost)
+	}
+	if err = l.TrackedTelegramUserRepo.StopTrackingForTelegramID(inputSpan, ctx, telegramID); err != nil {
+		fmt.Printf(">>> ERROR: Failed to stop tracking in DB: %v\n", err) // <--- Added
+		logger.ZSLogger.Errorw("failed to stop tracking in DB", "telegram_id", telegramID, "error", err)
+		return l.abandonKill(inputSpan, ctx, store, verdict, lease, fmt.Errorf("stop tracking: %w", err))
+	}
+	verdict.Changes = append(verdict.Changes, changeStopTracking)
+
+	if err := store.SaveVerdict(ctx, verdict); err != nil {
+		logger.ZSLogger.Errorw("failed to persist kill verdict", "telegram_id", telegramID, "verdict_id", verdict.ID, "error", err)
+	}
+
+	l.audit(ctx, actor, AuditActionKillSwitch, strconv.FormatInt(telegramID, 10), requestID,
+		gin.H{"strikes": strikes, "threshold": verdict.Threshold, "is_deleted": verdict.Before.IsDeleted, "contacts": verdict.Before.Contacts},
+		gin.H{"verdict_id": verdict.ID, "is_deleted": true, "tracking": "stopped"},
+	)
 
-		// Cleanup Monitor
-		l.Telemetry.MonitorRedis.Del(ctx, key)
-		l.Telemetry.MonitorRedis.SRem(ctx, telemetry.KeyQuarantineSet, telegramID)
+	settleShadow(ctx, store, telegramID, ShadowOutcomeConfirmed, "kill_switch")
 
-		fmt.Printf(">>> Kill Switch Cleanup Complete for %d\n", telegramID) // <--- Added
-		logger.ZSLogger.Infow("kill switch cleanup complete", "telegram_id", telegramID)
+	// Cleanup Monitor (one script so the dashboard never sees half of it)
+	if err := store.Dequarantine(ctx, telegramID); err != nil {
+		logger.ZSLogger.Errorw("failed to clear quarantine after kill", "telegram_id", telegramID, "error", err)
+	} else {
+		publishMonitorEvent(ctx, store, MonitorEventQuarantine, QuarantineEvent{
+			TelegramID: telegramID, Change: QuarantineCleared, Reason: "kill", At: time.Now().Unix(),
+		})
 	}
+
+	fmt.Printf(">>> Kill Switch Cleanup Complete for %d\n", telegramID) // <--- Added
+	logger.ZSLogger.Infow("kill switch cleanup complete", "telegram_id", telegramID)
+	return nil
 }
 
-func (l TelegramLogic) HealDeletionStrikes(ctx context.Context, telegramID int64) {
+// abandonKill backs out of a kill that marked the account deleted but did
+// not get to stop tracking it. While the lease is still held, is_deleted is
+// put back and the claim released, so the kill can be retried from scratch.
+// Without the lease (or if the rollback fails) nothing more is written: the
+// claim stays and the half-done verdict is saved, so restoring it undoes the
+// kill.
+func (l TelegramMonitor) abandonKill(span opentracing.Span, ctx context.Context, store MonitorStore, verdict VerdictRecord, lease *verdictLease, cause error) error {
+	if lease != nil && lease.held(ctx) {
+		err := l.TelegramUserRepo.UpdateIsDeletedByTelegramID(span, ctx, verdict.TelegramID, verdict.Before.IsDeleted)
+		if err == nil {
+			_ = store.ReleaseKillClaim(ctx, verdict.TelegramID)
+			return cause
+		}
+		logger.ZSLogger.Errorw("failed to roll back is_deleted after a failed kill", "telegram_id", verdict.TelegramID, "error", err)
+	}
+	if err := store.SaveVerdict(ctx, verdict); err != nil {
+		logger.ZSLogger.Errorw("failed to persist half-done kill verdict", "telegram_id", verdict.TelegramID, "verdict_id", verdict.ID, "error", err)
+	}
+	logger.ZSLogger.Errorw("kill left half-done: restore its verdict to undo it", "telegram_id", verdict.TelegramID, "verdict_id", verdict.ID, "changes", verdict.Changes)
+	return cause
+}
+
+func (l TelegramMonitor) HealDeletionStrikes(ctx context.Context, telegramID int64) {
 	// Safety Check
-	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+	store := l.monitorStore()
+	if store == nil {
 		return
 	}
 
-	key := fmt.Sprintf("monitor:strikes:%d", telegramID)
+	// A success lowers the decayed score instead of wiping it, so an account
+	// that alternates between failing and answering cannot reset its record.
+	// Read, decay, subtract and clear happen in one script.
+	policy := CurrentStrikePolicy()
+	result, score, err := store.ApplyHeal(ctx, telegramID, time.Now(), policy)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to record heal in redis", "telegram_id", telegramID, "error", err)
+		return
+	}
+	if result == HealNone {
+		return
+	}
+	change := QuarantineHealed
+	if result == HealCleared {
+		change = QuarantineCleared
+	}
+	publishMonitorEvent(ctx, store, MonitorEventQuarantine, QuarantineEvent{
+		TelegramID: telegramID, Change: change, Score: score, Reason: "heal", At: time.Now().Unix(),
+	})
 
-	// Check existence first to avoid unnecessary logs/calls
-	exists, _ := l.Telemetry.MonitorRedis.Exists(ctx, key).Result()
+	// The account answered: any pending shadow verdict on it was wrong.
+	settleShadow(ctx, store, telegramID, ShadowOutcomeFalsePositive, "lookup_succeeded")
+	if score < policy.Threshold {
+		l.withdrawReview(ctx, store, telegramID, score)
+	}
 
-	if exists > 0 {
+	if result == HealCleared {
 		fmt.Printf(">>> HEALING STRIKES for %d (User is Alive)\n", telegramID) // <--- Added
 		logger.ZSLogger.Infow("healing deletion strikes: user found alive",
 			"telegram_id", telegramID,
 		)
 		_ = logger.ZSLogger.Sync()
-
-		l.Telemetry.MonitorRedis.Del(ctx, key)
-		// l.Telemetry.MonitorRedis.SRem(ctx, telemetry.KeyQuarantineSet, telegramID)
-		l.Telemetry.MonitorRedis.ZRem(ctx, telemetry.KeyQuarantineSet, telegramID) // Changed from SRem
+		return
 	}
+
+	logger.ZSLogger.Infow("strike score lowered: user answered",
+		"telegram_id", telegramID,
+		"score", score,
+	)
 }
 
 // --- HTTP HANDLERS ---
 
-func (l TelegramLogic) ServeDashboardUI(c *gin.Context) {
+func (l TelegramMonitor) ServeDashboardUI(c *gin.Context) {
 	c.Data(200, "text/html", []byte(DashboardHTML))
 }
 
 // Add this struct for JSON response
 type QuarantineDetail struct {
-	TelegramID int64 `json:"id"`
-	Strikes    int   `json:"strikes"`
+	TelegramID int64          `json:"id"`
+	EnteredAt  int64          `json:"entered_at"`     // unix seconds, 0 if unknown
+	Rule       string         `json:"rule,omitempty"` // rule of the first strike
+	Strikes    float64        `json:"strikes"`        // decayed score, as of now
+	Signals    []StrikeSignal `json:"signals"`        // newest first
+	// Review is set while the account waits for an operator's verdict.
+	Review *PendingVerdict `json:"review,omitempty"`
+}
+
+// StatsRequest is GET /dashboard/api/stats?class=&top=.
+type StatsRequest struct {
+	Class string `query:"class"` // narrows the error line to one upstream code
+	Top   int    `query:"top"`   // size of the error-class panel, 0 for the default
+}
+
+func (r StatsRequest) Validate() error {
+	if r.Top < 0 || r.Top > errorTaxonomyMaxTopN {
+		return newAPIError(400, "invalid_top", "top must be between 1 and %d, or 0 for the default", errorTaxonomyMaxTopN)
+	}
+	return nil
+}
+
+// StatsResponse is everything the dashboard polls for.
+type StatsResponse struct {
+	TotalHits       int64              `json:"total_hits"`
+	TotalErrs       int64              `json:"total_errs"`
+	Rate            string             `json:"rate"` // success rate in percent, one decimal
+	QuarantineCount int                `json:"quarantine_count"`
+	QuarantineList  []QuarantineDetail `json:"quarantine_list"`
+	ReviewCount     int                `json:"review_count"`
+	WorstTrackers   []TrackerScore     `json:"worst_trackers"`
+	Feed            []LookupLogEntry   `json:"feed"` // newest first
+	Graph           StatsGraph         `json:"graph"`
+	ErrorClasses    []ErrorClassStat   `json:"error_classes"`
+	Leases          map[string]int64   `json:"leases"`
+	Policy          StrikePolicy       `json:"policy"`
 }
 
-func (l TelegramLogic) ServeDashboardStats(c *gin.Context) {
-	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
-		c.JSON(200, gin.H{"error": "telemetry_nil"})
+// StatsGraph is the per-minute chart, oldest minute first.
+type StatsGraph struct {
+	Labels []string `json:"labels"` // "15:04"
+	Hits   []int64  `json:"hits"`
+	Errs   []int64  `json:"errs"`
+	Class  string   `json:"class"` // the upstream code errs is narrowed to, if any
+}
+
+// GET /dashboard/api/stats?class=<code>&top=N
+func (l TelegramMonitor) ServeDashboardStats(c *gin.Context) {
+	var req StatsRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
 		return
 	}
 
 	ctx := context.Background()
-	r := l.Telemetry.MonitorRedis
-	pipe := r.Pipeline()
-
-	// 1. Standard Stats
-	hitsCmd := pipe.Get(ctx, telemetry.KeyGlobalHits)
-	errsCmd := pipe.Get(ctx, telemetry.KeyGlobalErrors)
-	feedCmd := pipe.LRange(ctx, telemetry.KeyLiveFeed, 0, 99)
-	worstTrackersCmd := pipe.ZRevRangeWithScores(ctx, telemetry.KeyTrackerHealth, 0, 4)
-
-	// 2. Quarantine List (Fetch Members first)
-	// We execute part of the pipe now to get the IDs, so we can fetch their strikes
-	// quarantineMembersCmd := pipe.SMembers(ctx, telemetry.KeyQuarantineSet)
-	// CHANGED: Fetch with Scores (Newest First)
-	quarantineMembersCmd := pipe.ZRevRangeWithScores(ctx, telemetry.KeyQuarantineSet, 0, -1)
-
-	// 3. Time Series
-	now := time.Now().Unix() / 60
-	var hitsTS, errsTS []*redis.StringCmd
-	var labels []string
-	for i := 29; i >= 0; i-- {
-		t := now - int64(i)
-		hitsTS = append(hitsTS, pipe.Get(ctx, fmt.Sprintf("%s:%d", telemetry.KeyTimeSeriesHit, t)))
-		errsTS = append(errsTS, pipe.Get(ctx, fmt.Sprintf("%s:%d", telemetry.KeyTimeSeriesErr, t)))
-		labels = append(labels, time.Unix(t*60, 0).Format("15:04"))
-	}
 
-	// EXECUTE PIPELINE
-	_, _ = pipe.Exec(ctx)
+	errorClass := req.Class
+	topN := req.Top
+	if topN == 0 {
+		topN = errorTaxonomyTopN
+	}
 
-	// --- Process Quarantine Details ---
-	// Now we need to fetch strikes for each quarantined user.
-	// This requires a second mini-pipeline or individual calls. A pipeline is faster.
+	// 1. Standard Stats + Time Series
+	now := time.Now()
+	stats, err := store.Stats(ctx, StatsQuery{Now: now, Minutes: 30, FeedLimit: 100, WorstN: 5})
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read dashboard stats", "error", err)
+		abortWithError(c, newAPIError(500, "stats_read_failed", "could not read monitor stats"))
+		return
+	}
+	var labels []string
+	for i := len(stats.HitSeries) - 1; i >= 0; i-- {
+		labels = append(labels, now.Add(-time.Duration(i)*time.Minute).Format("15:04"))
+	}
 
-	quarantineZ := quarantineMembersCmd.Val()
+	// 2. Quarantine List (the store copes with the legacy SET shape)
+	pendingReviews, err := store.PendingReviews(ctx)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read review queue", "error", err)
+	}
+	quarantine, err := store.Quarantine(ctx)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read quarantine", "error", err)
+	}
 	quarantineDetails := []QuarantineDetail{}
-	// quarantineIDs := quarantineMembersCmd.Val()
-	// quarantineDetails := []QuarantineDetail{}
-
-	if len(quarantineZ) > 0 {
-		strikePipe := r.Pipeline()
-		strikeCmds := make(map[string]*redis.StringCmd)
 
-		for _, zItem := range quarantineZ {
-			qID := fmt.Sprintf("%v", zItem.Member) // ZItem Member is interface{}
-			key := fmt.Sprintf("monitor:strikes:%s", qID)
-			strikeCmds[qID] = strikePipe.Get(ctx, key)
+	// --- Process Quarantine Details ---
+	// Strikes for every quarantined user come back in one batch.
+	if len(quarantine) > 0 {
+		policy := CurrentStrikePolicy()
+		ids := make([]int64, len(quarantine))
+		for i, entry := range quarantine {
+			ids[i] = entry.TelegramID
 		}
-		_, _ = strikePipe.Exec(ctx)
-
-		for qID, cmd := range strikeCmds {
-			strikes, _ := cmd.Int()
-			// Convert string ID back to int64
-			idInt, _ := strconv.ParseInt(qID, 10, 64)
-			quarantineDetails = append(quarantineDetails, QuarantineDetail{
-				TelegramID: idInt,
-				Strikes:    strikes,
-			})
+		records, err := store.LoadStrikes(ctx, ids, 10)
+		if err != nil {
+			logger.ZSLogger.Errorw("failed to read quarantine strikes", "error", err)
+			records = make([]StrikeRecord, len(ids))
+		}
+
+		for i, id := range ids {
+			signals := records[i].Signals
+			if signals == nil {
+				signals = []StrikeSignal{}
+			}
+			detail := QuarantineDetail{
+				TelegramID: id,
+				EnteredAt:  quarantine[i].EnteredAt,
+				Strikes:    records[i].State.at(now, policy.HalfLife.Std()),
+				Signals:    signals,
+			}
+			if meta := quarantine[i].Meta; meta != nil {
+				detail.Rule = meta.Rule
+			}
+			if pending, ok := pendingReviews[id]; ok {
+				detail.Review = &pending
+			}
+			quarantineDetails = append(quarantineDetails, detail)
 		}
 	}
 	// ----------------------------------
 
 	// Process General Stats
-	h, _ := hitsCmd.Int64()
-	e, _ := errsCmd.Int64()
+	h, e := stats.Hits, stats.Errors
 	rate := 100.0
 	if h > 0 {
 		rate = 100.0 - (float64(e)/float64(h))*100.0
 	}
 
-	var feed []map[string]interface{}
-	for _, s := range feedCmd.Val() {
-		var item map[string]interface{}
-		_ = json.Unmarshal([]byte(s), &item)
-		feed = append(feed, item)
-	}
+	feed := parseLookupLog(stats.Feed)
 
-	var gHits, gErrs []int64
-	for i, cmd := range hitsTS {
-		v1, _ := cmd.Int64()
-		gHits = append(gHits, v1)
-		v2, _ := errsTS[i].Int64()
-		gErrs = append(gErrs, v2)
+	gHits, gErrs := stats.HitSeries, stats.ErrorSeries
+	if errorClass != "" {
+		gErrs, _ = store.ErrorCodeSeries(ctx, errorClass, len(labels), now)
 	}
-
-	c.JSON(200, gin.H{
-		"total_hits":       h,
-		"total_errs":       e,
-		"rate":             fmt.Sprintf("%.1f", rate),
-		"quarantine_count": len(quarantineDetails), // Send count
-		"quarantine_list":  quarantineDetails,      // Send details
-		"worst_trackers":   worstTrackersCmd.Val(),
-		"feed":             feed,
-		"graph":            gin.H{"labels": labels, "hits": gHits, "errs": gErrs},
+	errorClasses := topErrorClasses(ctx, store, stats.ErrorsByCode, topN, now)
+
+	c.JSON(200, StatsResponse{
+		TotalHits:       h,
+		TotalErrs:       e,
+		Rate:            fmt.Sprintf("%.1f", rate),
+		QuarantineCount: len(quarantineDetails),
+		QuarantineList:  quarantineDetails,
+		ReviewCount:     len(pendingReviews),
+		WorstTrackers:   stats.WorstTrackers,
+		Feed:            feed,
+		Graph:           StatsGraph{Labels: labels, Hits: gHits, Errs: gErrs, Class: errorClass},
+		ErrorClasses:    errorClasses,
+		Leases:          leaseMetricsSnapshot(),
+		Policy:          CurrentStrikePolicy(),
 	})
 }
 
-func (l TelegramLogic) ClearMonitoringData(c *gin.Context) {
-	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
-		c.JSON(500, gin.H{"error": "telemetry_nil"})
-		return
-	}
+// DeepDetailsRequest is GET /dashboard/api/relations/deep?id=123.
+type DeepDetailsRequest struct {
+	ID TelegramID `query:"id"`
+}
 
-	ctx := context.Background()
-	// Atomic Lua script to find and delete keys starting with 'monitor:'
-	script := `
-        local keys = redis.call('keys', 'monitor:*')
-        if #keys > 0 then
-            return redis.call('del', unpack(keys))
-        else
-            return 0
-        end
-    `
-
-	// FIX: Pass []string{} instead of 0
-	val, err := l.Telemetry.MonitorRedis.Eval(ctx, script, []string{}).Result()
+func (r DeepDetailsRequest) Validate() error { return requireTelegramID("id", r.ID) }
 
-	if err != nil {
-		logger.ZSLogger.Errorw("failed to clear monitoring redis", "error", err)
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
-	}
+// DeepDetailsResponse is the PII deep scan of one tracked account.
+type DeepDetailsResponse struct {
+	Identity DeepIdentity         `json:"identity"`
+	Trackers []TrackerContactView `json:"trackers"`
+}
 
-	logger.ZSLogger.Infow("monitoring redis cleared via dashboard", "keys_deleted", val)
-	c.JSON(200, gin.H{"status": "ok", "keys_deleted": val})
+// DeepIdentity is the tracked account's profile. Unknown accounts keep the
+// placeholders ("Unknown", "N/A", "UNKNOWN").
+type DeepIdentity struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`  // full name, else "@username"
+	Phone     string `json:"phone"` // suffixed " (Detected)" when taken from a tracker contact
+	Username  string `json:"username"`
+	IsDeleted bool   `json:"is_deleted"`
+	Bio       string `json:"bio"`
+	Status    string `json:"status"`
+	LastSeen  string `json:"last_seen"`
+	Photos    int    `json:"photos"`
+	Updated   int64  `json:"updated"`
 }
 
-func (l TelegramLogic) GetDeepDetails(c *gin.Context) {
-	idStr := c.Query("id")
-	telegramID, _ := strconv.ParseInt(idStr, 10, 64)
+// TrackerContactView is domain.TrackerContact with the keys the frontend uses.
+type TrackerContactView struct {
+	ID                 int64  `json:"id"`
+	TrackerPhoneID     int64  `json:"tracker_phone_id"`
+	TrackedTelegramID  int64  `json:"tracked_telegram_id"`
+	TrackedPhoneNumber string `json:"tracked_phone_number"`
+	Status             string `json:"status"`
+	CreatedAt          int64  `json:"created_at"`
+}
+
+// GET /dashboard/api/relations/deep?id=123
+func (l TelegramMonitor) GetDeepDetails(c *gin.Context) {
+	var req DeepDetailsRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	telegramID := int64(req.ID)
 
 	ctx := c.Request.Context()
 	span := opentracing.StartSpan("Dashboard.GetDeepDetails")
@@ -1113,86 +1714,101 @@ func (l TelegramLogic) GetDeepDetails(c *gin.Context) {
 	}
 
 	// --- TRANSFORM DATA (Fixing JSON Keys without touching Domain) ---
-	var formattedContacts []gin.H
-	if contacts != nil {
-		for _, t := range contacts {
-			formattedContacts = append(formattedContacts, gin.H{
-				"id":                   t.ID,
-				"tracker_phone_id":     t.TrackerPhoneID,
-				"tracked_telegram_id":  t.TrackedTelegramID,
-				"tracked_phone_number": t.TrackedPhoneNumber,
-				"status":               t.Status,
-				// Map the integer stamp to the key the frontend expects ('created_at')
-				"created_at": t.CreatedAtStamp,
-			})
-		}
-	} else {
-		formattedContacts = []gin.H{}
+	formattedContacts := make([]TrackerContactView, 0, len(contacts))
+	for _, t := range contacts {
+		formattedContacts = append(formattedContacts, TrackerContactView{
+			ID:                 t.ID,
+			TrackerPhoneID:     t.TrackerPhoneID,
+			TrackedTelegramID:  t.TrackedTelegramID,
+			TrackedPhoneNumber: t.TrackedPhoneNumber,
+			Status:             t.Status,
+			// Map the integer stamp to the key the frontend expects ('created_at')
+			CreatedAt: t.CreatedAtStamp,
+		})
 	}
 	// ----------------------------------------------------------------
 
-	// Build Rich Identity Object (Your existing logic)
-	idData := gin.H{
-		"id":         telegramID,
-		"name":       "Unknown",
-		"phone":      "N/A",
-		"username":   "",
-		"is_deleted": false,
-		"bio":        "",
-		"status":     "UNKNOWN",
-		"last_seen":  "",
-		"photos":     0,
-		"updated":    0,
+	// Build Rich Identity Object
+	idData := DeepIdentity{
+		ID:     telegramID,
+		Name:   "Unknown",
+		Phone:  "N/A",
+		Status: "UNKNOWN",
 	}
 
 	if identity != nil {
 		if identity.Fullname != nil && *identity.Fullname != "" {
-			idData["name"] = identity.Fullname
+			idData.Name = *identity.Fullname
 		} else if identity.Username != nil && *identity.Username != "" {
-			idData["name"] = "@" + *identity.Username
+			idData.Name = "@" + *identity.Username
 		}
 		if identity.PhoneNumber != nil && *identity.PhoneNumber != "" {
-			idData["phone"] = identity.PhoneNumber
+			idData.Phone = *identity.PhoneNumber
 		}
 		if identity.Username != nil && *identity.Username != "" {
-			idData["username"] = identity.Username
+			idData.Username = *identity.Username
 		}
 		if identity.Bio != nil && *identity.Bio != "" {
-			idData["bio"] = identity.Bio
+			idData.Bio = *identity.Bio
 		}
-		idData["status"] = identity.OnlineStatus
-		idData["is_deleted"] = identity.IsDeleted
+		idData.Status = identity.OnlineStatus
+		idData.IsDeleted = identity.IsDeleted
 		if identity.LastSeenString != nil {
-			idData["last_seen"] = identity.LastSeenString
+			idData.LastSeen = *identity.LastSeenString
 		}
-		idData["photos"] = identity.ProfilePhotosCount
-		idData["updated"] = identity.UpdatedAtStamp
+		idData.Photos = identity.ProfilePhotosCount
+		idData.Updated = identity.UpdatedAtStamp
 	}
 
 	// Fallback Phone Detection
-	if idData["phone"] == "N/A" {
+	if idData.Phone == "N/A" {
 		for _, t := range contacts {
 			if t.TrackedPhoneNumber != "" {
-				idData["phone"] = t.TrackedPhoneNumber + " (Detected)"
+				idData.Phone = t.TrackedPhoneNumber + " (Detected)"
 				break
 			}
 		}
 	}
 
-	c.JSON(200, gin.H{
-		"identity": idData,
-		"trackers": formattedContacts, // <--- Send the transformed map
+	c.JSON(200, DeepDetailsResponse{
+		Identity: idData,
+		Trackers: formattedContacts,
 	})
 }
 
-// POST /dashboard/api/relations/update
-func (l TelegramLogic) UpdateRelationStatus(c *gin.Context) {
-	var req struct {
-		ID     int64  `json:"id"`
-		Status string `json:"status"`
+// relationStatuses are the tracker contact statuses an operator may set.
+var relationStatuses = map[string]bool{"ACTIVE": true, "INACTIVE": true, "DELETED": true}
+
+// RelationStatusRequest is POST /dashboard/api/relations/update.
+type RelationStatusRequest struct {
+	ID     int64  `json:"id"` // tracker contact ID
+	Status string `json:"status"`
+	// Optional: lets us record the previous status in the audit trail.
+	TrackedTelegramID TelegramID `json:"tracked_telegram_id"`
+}
+
+func (r RelationStatusRequest) Validate() error {
+	if r.ID <= 0 {
+		return newAPIError(400, "invalid_id", "id must be a positive contact ID")
+	}
+	if !relationStatuses[r.Status] {
+		return newAPIError(400, "invalid_status", "status must be ACTIVE, INACTIVE or DELETED")
 	}
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": "invalid_json"})
+	if r.TrackedTelegramID < 0 {
+		return newAPIError(400, "invalid_tracked_telegram_id", "tracked_telegram_id must be a positive integer")
+	}
+	return nil
+}
+
+type RelationStatusResponse struct {
+	Status    string `json:"status"`
+	NewStatus string `json:"new_status"`
+}
+
+// POST /dashboard/api/relations/update
+func (l TelegramMonitor) UpdateRelationStatus(c *gin.Context) {
+	var req RelationStatusRequest
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1200,37 +1816,80 @@ func (l TelegramLogic) UpdateRelationStatus(c *gin.Context) {
 	span := opentracing.StartSpan("Dashboard.UpdateRelationStatus")
 	defer span.Finish()
 
+	var before interface{}
+	if req.TrackedTelegramID != 0 {
+		contacts, _ := l.TrackedTelegramUserRepo.GetTrackerContactsByTrackedTelegramID(span, ctx, int64(req.TrackedTelegramID))
+		for _, t := range contacts {
+			if t.ID == req.ID {
+				before = gin.H{"status": t.Status}
+				break
+			}
+		}
+	}
+
 	err := l.TrackedTelegramUserRepo.UpdateTrackerContactStatus(span, ctx, req.ID, req.Status)
 	if err != nil {
 		logger.ZSLogger.Errorw("failed to update status", "err", err)
-		c.JSON(500, gin.H{"error": "db_update_failed"})
+		abortWithError(c, newAPIError(500, "db_update_failed", "could not update the contact status"))
 		return
 	}
+	l.auditRequest(c, AuditActionRelationStatus, strconv.FormatInt(req.ID, 10), before, gin.H{"status": req.Status})
 
-	c.JSON(200, gin.H{"status": "ok", "new_status": req.Status})
+	c.JSON(200, RelationStatusResponse{Status: "ok", NewStatus: req.Status})
 }
 
-
-func ParadoxAuthMiddleware() gin.HandlerFunc {
+// ParadoxAuthMiddleware guards the dashboard. The gesture screen is only the
+// front door: unlocking requires operator credentials and yields a
+// server-side session (see DashboardAuth). Scripts authenticate with an
+// "Authorization: Bearer pxt_..." API token instead of the cookie.
+func ParadoxAuthMiddleware(auth *DashboardAuth) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		c.Set(ctxKeyDashboardAuth, auth)
+
+		if raw := bearerToken(c); raw != "" {
+			principal, err := auth.authenticateBearer(c, raw)
+			if err != nil {
+				var apiErr APIError
+				if !stderrors.As(err, &apiErr) {
+					logger.ZSLogger.Errorw("bearer token check failed", "error", err)
+					apiErr = newAPIError(500, "auth_failed", "could not check the API token")
+				}
+				if apiErr.Status == 401 {
+					c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				}
+				abortWithError(c, apiErr)
+				return
+			}
+			c.Set(ctxKeyDashboardSession, principal)
+			c.Next()
+			return
+		}
+
 		action := c.Query("paradox")
 
 		if c.Request.Method == "POST" {
 			if action == "unlock" {
-				c.SetCookie("paradox_auth", "unlocked", 3600*24*30, "/", "", false, false)
-				c.JSON(200, gin.H{"status": "unlocked"})
+				if !validCSRF(c, nil) {
+					rejectCSRF(c)
+					return
+				}
+				auth.handleUnlock(c)
 				c.Abort()
 				return
 			}
 			if action == "logout" {
-				c.SetCookie("paradox_auth", "", -1, "/", "", false, false)
-				c.JSON(200, gin.H{"status": "logged_out"})
+				if !validCSRF(c, auth.sessionFromRequest(c)) {
+					rejectCSRF(c)
+					return
+				}
+				auth.handleLogout(c)
 				c.Abort()
 				return
 			}
 		}
 
 		if action == "reentry" {
+			auth.ensurePreSessionCSRF(c)
 			c.Header("Content-Type", "text/html")
 			c.Status(200)
 			c.Writer.Write([]byte(Paradox403HTML))
@@ -1238,12 +1897,17 @@ func ParadoxAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		cookie, err := c.Cookie("paradox_auth")
-		if err == nil && cookie == "unlocked" {
+		if sess := auth.sessionFromRequest(c); sess != nil {
+			if !isSafeMethod(c.Request.Method) && !validCSRF(c, sess) {
+				rejectCSRF(c)
+				return
+			}
+			c.Set(ctxKeyDashboardSession, sess)
 			c.Next()
 			return
 		}
 
+		auth.ensurePreSessionCSRF(c)
 		c.Header("Content-Type", "text/html")
 		c.Status(403)
 		c.Writer.Write([]byte(Paradox403HTML))
@@ -1281,7 +1945,28 @@ const Paradox403HTML = `
             backdrop-filter: blur(10px);
             transition: 0.1s;
         }
-        .hub-val { font-size: 20px; font-weight: bold; color: #555; letter-spacing: 2px; }
+        .hub-val { font-size: 20px; font-weight: bold; color: #555; letter-spacing: 2px; }
+
+        /* Credential prompt shown after the gesture (the gesture alone is not a login) */
+        #login {
+            position: absolute; inset: 0; z-index: 20;
+            display: none; align-items: center; justify-content: center;
+            background: rgba(0,0,0,0.6);
+        }
+        #login form {
+            display: flex; flex-direction: column; gap: 10px; width: 240px;
+            padding: 20px; border: 1px solid #00ff9d; background: rgba(10,10,10,0.9);
+        }
+        #login input {
+            background: #000; color: #00ff9d; border: 1px solid #333;
+            padding: 8px; font-family: monospace; outline: none; user-select: text;
+        }
+        #login input:focus { border-color: #00ff9d; }
+        #login button {
+            background: #00ff9d; color: #000; border: 0; padding: 8px;
+            font-family: monospace; font-weight: bold; letter-spacing: 2px; cursor: pointer;
+        }
+        #login .err { color: #ff2a2a; min-height: 1em; font-size: 11px; }
         
         /* The Horror Text Style */
         .haha-screen {
@@ -1309,8 +1994,16 @@ const Paradox403HTML = `
 <body>
     <canvas id="cvs"></canvas>
     <div id="ui">
-        <div class="hub" id="hub"><div class="hub-val" id="val">LOCKED</div></div>
-    </div>
+        <div class="hub" id="hub"><div class="hub-val" id="val">LOCKED</div></div>
+    </div>
+    <div id="login">
+        <form id="loginForm" autocomplete="on">
+            <input id="user" name="username" placeholder="operator" autocomplete="username" autocapitalize="off">
+            <input id="pass" name="password" type="password" placeholder="passphrase" autocomplete="current-password">
+            <div class="err" id="loginErr"></div>
+            <button type="submit">ENTER</button>
+        </form>
+    </div>
 
 <script>
     const C = {
@@ -1457,8 +2150,8 @@ const Paradox403HTML = `
             val.innerText = "OPEN";
             val.style.color = C.colors.good;
             // EXPLOSION
-            for(let i=0; i<200; i++) particles.push(new Confetti());
-            finish('?paradox=unlock', 2000); // Wait 2s before redirect
+            for(let i=0; i<200; i++) particles.push(new Confetti());
+            setTimeout(showLogin, 1500); // Gesture opens the door, credentials unlock it
         } else if (unlockProgress <= -100 && mode !== 'horror') {
             mode = 'horror';
             val.innerText = "DIE";
@@ -1527,10 +2220,36 @@ const Paradox403HTML = `
         ctx.beginPath(); ctx.arc(p.x, p.y, 4, 0, Math.PI*2); ctx.fill();
     }
 
-    // --- NETWORKING ---
-    function finish(urlParam, delay) {
+    // --- NETWORKING ---
+    const csrfToken = () => decodeURIComponent((document.cookie.match(/(?:^|; )paradox_csrf=([^;]*)/) || [])[1] || '');
+
+    function showLogin() {
+        document.getElementById('login').style.display = 'flex';
+        document.getElementById('user').focus();
+    }
+
+    document.getElementById('loginForm').addEventListener('submit', e => {
+        e.preventDefault();
+        const err = document.getElementById('loginErr');
+        err.innerText = '';
+        fetch(window.location.pathname + '?paradox=unlock', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() },
+            body: JSON.stringify({
+                username: document.getElementById('user').value,
+                password: document.getElementById('pass').value
+            })
+        }).then(r => {
+            if (r.ok) { window.location.href = window.location.pathname; return; }
+            document.getElementById('pass').value = '';
+            if (r.status === 429) err.innerText = 'LOCKED OUT ' + (r.headers.get('Retry-After') || '?') + 's';
+            else err.innerText = r.status === 401 ? 'ACCESS DENIED' : 'ERROR ' + r.status;
+        }).catch(() => { err.innerText = 'NETWORK ERROR'; });
+    });
+
+    function finish(urlParam, delay) {
         // Send request immediately
-        fetch(window.location.pathname + urlParam, {method:'POST'})
+        fetch(window.location.pathname + urlParam, {method:'POST', headers: {'X-CSRF-Token': csrfToken()}})
         .then(() => {
             setTimeout(() => {
                 if (urlParam.includes('logout')) {
@@ -1548,8 +2267,10 @@ const Paradox403HTML = `
 
     // INPUT HANDLERS
     const getSide = (x) => x < W/2 ? 'L' : 'R';
-    window.addEventListener('touchstart', e => {
-        e.preventDefault();
+    const inLogin = (e) => e.target.closest && e.target.closest('#login');
+    window.addEventListener('touchstart', e => {
+        if (inLogin(e)) return;
+        e.preventDefault();
         for(let i=0; i<e.touches.length; i++) {
             const t = e.touches[i];
             const p = pads[getSide(t.clientX)];
@@ -1558,8 +2279,9 @@ const Paradox403HTML = `
         }
     }, {passive:false});
 
-    window.addEventListener('touchmove', e => {
-        e.preventDefault();
+    window.addEventListener('touchmove', e => {
+        if (inLogin(e)) return;
+        e.preventDefault();
         for(let i=0; i<e.touches.length; i++) {
             const t = e.touches[i];
             const p = pads[getSide(t.clientX)];
@@ -1576,8 +2298,9 @@ const Paradox403HTML = `
     });
 
     // KEYBOARD DEBUG
-    window.addEventListener('keydown', e => {
-        if(e.key=='w') pads.L.vy -= 25;
+    window.addEventListener('keydown', e => {
+        if (inLogin(e)) return;
+        if(e.key=='w') pads.L.vy -= 25;
         if(e.key=='s') pads.L.vy += 25;
         if(e.key=='ArrowUp') pads.R.vy -= 25;
         if(e.key=='ArrowDown') pads.R.vy += 25;
@@ -1588,4 +2311,3 @@ const Paradox403HTML = `
 </body>
 </html>
 `
-
@@ -0,0 +1,195 @@
+// logic/keyspace/audit.go
+package keyspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// --- KEYS AUDIT ---
+//
+// Audit SCANs monitor:* and reports every key that breaks the schema:
+//
+//   unknown    - matches no Spec (typo'd builder, leftover from old code)
+//   wrong_type - matches a Spec but holds another Redis type
+//   no_ttl     - its Spec says it must expire but it never will
+//
+// plus the schema version Redis was last migrated to. SCAN keeps it safe to
+// run against production.
+
+const (
+	ProblemUnknown   = "unknown"
+	ProblemWrongType = "wrong_type"
+	ProblemNoTTL     = "no_ttl"
+
+	auditScanCount = 500
+	// auditMaxProblems caps the report; the counts stay exact.
+	auditMaxProblems = 1000
+)
+
+type Problem struct {
+	Key     string    `json:"key"`
+	Problem string    `json:"problem"`
+	Spec    string    `json:"spec,omitempty"`
+	Want    RedisType `json:"want,omitempty"`
+	Got     string    `json:"got,omitempty"`
+}
+
+type AuditReport struct {
+	SchemaVersion int            `json:"schema_version"` // what this build expects
+	StoredVersion int            `json:"stored_version"` // what Redis says, 0 if never written
+	Scanned       int            `json:"scanned"`
+	BySpec        map[string]int `json:"by_spec"`
+	Counts        map[string]int `json:"counts"` // problem -> count
+	Problems      []Problem      `json:"problems"`
+	Truncated     bool           `json:"truncated"`
+}
+
+// OK is true when every key matches the schema and the version is current.
+func (a AuditReport) OK() bool {
+	return len(a.Counts) == 0 && a.StoredVersion == a.SchemaVersion
+}
+
+// Audit scans monitor:* once.
+func Audit(ctx context.Context, r redis.Cmdable) (AuditReport, error) {
+	report := AuditReport{
+		SchemaVersion: SchemaVersion,
+		BySpec:        map[string]int{},
+		Counts:        map[string]int{},
+		Problems:      []Problem{},
+	}
+	report.StoredVersion, _ = StoredVersion(ctx, r)
+
+	var cursor uint64
+	for {
+		keys, next, err := r.Scan(ctx, cursor, All, auditScanCount).Result()
+		if err != nil {
+			return report, err
+		}
+		if err := auditBatch(ctx, r, keys, &report); err != nil {
+			return report, err
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return report, nil
+}
+
+func auditBatch(ctx context.Context, r redis.Cmdable, keys []string, report *AuditReport) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := r.Pipeline()
+	types := make([]*redis.StatusCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, k := range keys {
+		types[i] = pipe.Type(ctx, k)
+		ttls[i] = pipe.TTL(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+
+	for i, k := range keys {
+		got := types[i].Val()
+		if got == "none" { // expired between SCAN and TYPE
+			continue
+		}
+		report.Scanned++
+		spec := Lookup(k)
+		switch {
+		case spec == nil:
+			report.add(Problem{Key: k, Problem: ProblemUnknown, Got: got})
+			continue
+		case RedisType(got) != spec.Type:
+			report.add(Problem{Key: k, Problem: ProblemWrongType, Spec: spec.Name, Want: spec.Type, Got: got})
+		case spec.Expires && ttls[i].Val() < 0: // -1ns from go-redis: no expiry
+			report.add(Problem{Key: k, Problem: ProblemNoTTL, Spec: spec.Name})
+		}
+		report.BySpec[spec.Name]++
+	}
+	return nil
+}
+
+func (a *AuditReport) add(p Problem) {
+	a.Counts[p.Problem]++
+	if len(a.Problems) >= auditMaxProblems {
+		a.Truncated = true
+		return
+	}
+	a.Problems = append(a.Problems, p)
+}
+
+// StoredVersion reads the schema version Redis was last migrated to.
+func StoredVersion(ctx context.Context, r redis.Cmdable) (int, error) {
+	v, err := r.Get(ctx, Version).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
+
+// MarkVersion records that Redis now follows schema version v. Migrations
+// call it when they finish.
+func MarkVersion(ctx context.Context, r redis.Cmdable, v int) error {
+	return r.Set(ctx, Version, v, 0).Err()
+}
+
+// RunAuditCommand is `monitor keys audit`: it runs Audit and prints a
+// human-readable report to w. The returned error is non-nil when the audit
+// could not run or found problems, so the command exits non-zero.
+func RunAuditCommand(ctx context.Context, r redis.Cmdable, w io.Writer) error {
+	started := time.Now()
+	report, err := Audit(ctx, r)
+	if err != nil {
+		return fmt.Errorf("keys audit: %w", err)
+	}
+
+	fmt.Fprintf(w, "schema version: expected %d, stored %d\n", report.SchemaVersion, report.StoredVersion)
+	fmt.Fprintf(w, "scanned %d keys in %s\n\n", report.Scanned, time.Since(started).Round(time.Millisecond))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SPEC\tKEYS")
+	names := make([]string, 0, len(report.BySpec))
+	for name := range report.BySpec {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%d\n", name, report.BySpec[name])
+	}
+	tw.Flush()
+
+	if len(report.Problems) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PROBLEM\tKEY\tSPEC\tWANT\tGOT")
+		for _, p := range report.Problems {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Problem, p.Key, p.Spec, p.Want, p.Got)
+		}
+		tw.Flush()
+		if report.Truncated {
+			fmt.Fprintf(w, "(only the first %d problems are listed)\n", auditMaxProblems)
+		}
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("keys audit: %d unknown, %d wrong type, %d without ttl, schema version %d/%d",
+			report.Counts[ProblemUnknown], report.Counts[ProblemWrongType], report.Counts[ProblemNoTTL],
+			report.StoredVersion, report.SchemaVersion)
+	}
+	fmt.Fprintln(w, "\nok")
+	return nil
+}
@@ -0,0 +1,251 @@
+// logic/keyspace/keyspace.go
+package keyspace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/service/telemetry"
+)
+
+// --- MONITOR KEYSPACE ---
+//
+// Every monitor:* key the dashboard reads or writes is declared here once:
+// its name pattern, its Redis type and whether it must expire. Handlers
+// build keys through the typed functions below instead of Sprintf, so an
+// ID is always formatted the same way. Audit checks a live Redis against
+// the same table.
+//
+// dashboard:* and lease:* are declared here too, but kept out of monitor:*
+// and out of Schema on purpose. Resets, snapshots and Audit only ever cover
+// monitor:*, so none of them can log operators out, revoke API tokens,
+// rewind lease fencing tokens, or erase the audit chain, the event stream or
+// the verdicts and kill claims that undo a kill.
+
+// SchemaVersion is bumped whenever a key changes shape.
+//
+//	1  quarantine as a plain SET
+//	2  quarantine as ZSET + meta HASH (MigrateQuarantine)
+const SchemaVersion = 2
+
+type RedisType string
+
+const (
+	TypeString RedisType = "string"
+	TypeList   RedisType = "list"
+	TypeSet    RedisType = "set"
+	TypeZSet   RedisType = "zset"
+	TypeHash   RedisType = "hash"
+)
+
+// Spec declares one family of keys.
+type Spec struct {
+	Name string `json:"name"`
+	// Pattern is the key with placeholders: {id} (decimal int64),
+	// {minute} (unix minute) and {code} (upstream error code).
+	Pattern string    `json:"pattern"`
+	Type    RedisType `json:"type"`
+	// Expires means the key must carry a TTL. TTL is the fixed value when
+	// there is one; 0 means the writer takes it from config (StrikePolicy).
+	Expires bool          `json:"expires"`
+	TTL     time.Duration `json:"ttl,omitempty"`
+}
+
+// Fixed TTLs.
+const (
+	ErrorCodeSeriesTTL = 2 * time.Hour
+	ShadowVerdictsTTL  = 30 * 24 * time.Hour
+)
+
+// Singleton keys. The telemetry service writes the first group, so the
+// names stay defined there.
+const (
+	Watchlist     = telemetry.KeyWatchlist
+	Quarantine    = telemetry.KeyQuarantineSet
+	GlobalHits    = telemetry.KeyGlobalHits
+	GlobalErrors  = telemetry.KeyGlobalErrors
+	LiveFeed      = telemetry.KeyLiveFeed
+	TrackerHealth = telemetry.KeyTrackerHealth
+
+	QuarantineMeta = "monitor:quarantine:meta"
+	ReviewPending  = "monitor:review:pending"
+	ShadowVerdicts = "monitor:shadow:verdicts"
+	ErrorsByCode   = "monitor:errors:by_code"
+	Version        = "monitor:schema:version"
+)
+
+const (
+	prefixHistory = "monitor:history"
+	prefixMapU2T  = "monitor:map:u2t"
+	prefixMapT2U  = "monitor:map:t2u"
+	prefixStrikes = "monitor:strikes"
+	prefixSignals = "monitor:signals"
+	prefixErrCode = "monitor:ts:errcode"
+	patternMinute = ":{minute}"
+	patternID     = ":{id}"
+)
+
+// Schema is every monitor:* key family, in the order Audit reports them.
+var Schema = []Spec{
+	{Name: "watchlist", Pattern: Watchlist, Type: TypeSet},
+	{Name: "quarantine", Pattern: Quarantine, Type: TypeZSet},
+	{Name: "quarantine_meta", Pattern: QuarantineMeta, Type: TypeHash},
+	{Name: "global_hits", Pattern: GlobalHits, Type: TypeString},
+	{Name: "global_errors", Pattern: GlobalErrors, Type: TypeString},
+	{Name: "live_feed", Pattern: LiveFeed, Type: TypeList},
+	{Name: "tracker_health", Pattern: TrackerHealth, Type: TypeZSet},
+	{Name: "ts_hits", Pattern: telemetry.KeyTimeSeriesHit + patternMinute, Type: TypeString, Expires: true},
+	{Name: "ts_errors", Pattern: telemetry.KeyTimeSeriesErr + patternMinute, Type: TypeString, Expires: true},
+	{Name: "ts_error_code", Pattern: prefixErrCode + ":{code}" + patternMinute, Type: TypeString, Expires: true, TTL: ErrorCodeSeriesTTL},
+	{Name: "errors_by_code", Pattern: ErrorsByCode, Type: TypeHash},
+	{Name: "history", Pattern: prefixHistory + patternID, Type: TypeList, Expires: true},
+	{Name: "map_u2t", Pattern: prefixMapU2T + patternID, Type: TypeSet},
+	{Name: "map_t2u", Pattern: prefixMapT2U + patternID, Type: TypeSet},
+	{Name: "strikes", Pattern: prefixStrikes + patternID, Type: TypeHash, Expires: true},
+	{Name: "signals", Pattern: prefixSignals + patternID, Type: TypeList, Expires: true},
+	{Name: "review_pending", Pattern: ReviewPending, Type: TypeHash},
+	{Name: "shadow_verdicts", Pattern: ShadowVerdicts, Type: TypeHash, Expires: true, TTL: ShadowVerdictsTTL},
+	{Name: "schema_version", Pattern: Version, Type: TypeString},
+}
+
+// --- Builders ---
+
+// Member formats an ID as a key segment or a set/hash member. Every
+// builder goes through it, so 123 is never stored as "123.0" or "1.23e+02".
+func Member(telegramID int64) string { return strconv.FormatInt(telegramID, 10) }
+
+// History is the deep log of one tracked ID.
+func History(telegramID int64) string { return prefixHistory + ":" + Member(telegramID) }
+
+// MapU2T holds the trackers of a user; MapT2U the users of a tracker.
+func MapU2T(telegramID int64) string { return prefixMapU2T + ":" + Member(telegramID) }
+func MapT2U(telegramID int64) string { return prefixMapT2U + ":" + Member(telegramID) }
+
+func Strikes(telegramID int64) string { return prefixStrikes + ":" + Member(telegramID) }
+func Signals(telegramID int64) string { return prefixSignals + ":" + Member(telegramID) }
+
+// HitsMinute and ErrorsMinute are the traffic graph buckets.
+func HitsMinute(minute int64) string {
+	return fmt.Sprintf("%s:%d", telemetry.KeyTimeSeriesHit, minute)
+}
+
+func ErrorsMinute(minute int64) string {
+	return fmt.Sprintf("%s:%d", telemetry.KeyTimeSeriesErr, minute)
+}
+
+func ErrorCodeMinute(code string, minute int64) string {
+	return fmt.Sprintf("%s:%s:%d", prefixErrCode, code, minute)
+}
+
+// --- Dashboard and lease keys ---
+
+const (
+	AuditLog   = "dashboard:audit:log"  // LIST, oldest first
+	AuditHead  = "dashboard:audit:head" // STRING, JSON head of the chain
+	APITokens  = "dashboard:tokens"     // SET of token IDs
+	Verdicts   = "dashboard:verdicts"   // ZSET verdict id by kill time
+	Events     = "dashboard:events"     // STREAM, fields type and data
+	LeaseFence = "lease:fence"          // STRING counter the lease tokens come from
+)
+
+const (
+	prefixSession         = "dashboard:session:"
+	prefixAPIToken        = "dashboard:token:"
+	prefixVerdict         = "dashboard:verdict:"
+	prefixKillClaim       = "dashboard:kill:claim:"
+	prefixResetJob        = "dashboard:reset:job:"
+	prefixResetConfirm    = "dashboard:reset:confirm:"
+	prefixRateLimitBucket = "dashboard:ratelimit:bucket:"
+	prefixRateLimitFail   = "dashboard:ratelimit:fail:"
+	prefixRateLimitLock   = "dashboard:ratelimit:lock:"
+	prefixLease           = "lease:"
+)
+
+// Session is keyed by the hex SHA-256 of the cookie, never the cookie itself.
+func Session(tokenHash string) string { return prefixSession + tokenHash }
+
+// APIToken is the HASH of one token; it expires with the token.
+func APIToken(id string) string { return prefixAPIToken + id }
+
+// Verdict is the HASH { record, restored_at, restored_by } of one kill.
+func Verdict(id string) string { return prefixVerdict + id }
+
+// KillClaim holds the id of the verdict that claimed the kill.
+func KillClaim(telegramID int64) string { return prefixKillClaim + Member(telegramID) }
+
+func ResetJob(id string) string         { return prefixResetJob + id }
+func ResetConfirm(token string) string  { return prefixResetConfirm + token }
+func RateLimitBucket(key string) string { return prefixRateLimitBucket + key }
+func RateLimitFail(key string) string   { return prefixRateLimitFail + key }
+func RateLimitLock(key string) string   { return prefixRateLimitLock + key }
+
+// Lease is the HASH { owner, token } of one held lease.
+func Lease(name string) string { return prefixLease + name }
+
+// --- Matching ---
+
+// All matches every key in the schema (and anything stray under monitor:).
+const All = "monitor:*"
+
+// ScanPattern turns the named spec into a SCAN MATCH pattern, or "" if no
+// spec has that name.
+func ScanPattern(name string) string {
+	for _, spec := range Schema {
+		if spec.Name == name {
+			p := spec.Pattern
+			for _, ph := range []string{"{id}", "{minute}", "{code}"} {
+				p = strings.ReplaceAll(p, ph, "*")
+			}
+			return p
+		}
+	}
+	return ""
+}
+
+// Lookup returns the spec key belongs to, or nil if it matches none.
+func Lookup(key string) *Spec {
+	for i := range Schema {
+		if match(Schema[i].Pattern, key) {
+			return &Schema[i]
+		}
+	}
+	return nil
+}
+
+func match(pattern, key string) bool {
+	ps := strings.Split(pattern, ":")
+	ks := strings.Split(key, ":")
+	if len(ps) != len(ks) {
+		return false
+	}
+	for i, p := range ps {
+		if !matchSegment(p, ks[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchSegment(p, s string) bool {
+	switch p {
+	case "{id}":
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	case "{minute}":
+		n, err := strconv.ParseInt(s, 10, 64)
+		return err == nil && n >= 0
+	case "{code}":
+		if s == "" {
+			return false
+		}
+		for _, r := range s {
+			if !(r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+		return true
+	}
+	return p == s
+}
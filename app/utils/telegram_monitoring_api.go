@@ -0,0 +1,219 @@
+// logic/telegram_monitoring_api.go
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- ERROR ENVELOPE ---
+
+// APIError is the body of every failed dashboard API call:
+//
+//	{"error": {"code": "invalid_id", "message": "id must be a positive integer", "request_id": "9f2c41d07ab3e615"}}
+//
+// Code is stable and meant for programs; Message is for people and may
+// change. Details carries whatever a client needs to recover, such as a
+// confirmation token or the role a route requires.
+type APIError struct {
+	Status    int                    `json:"-"`
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	RequestID string                 `json:"request_id"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// APIErrorResponse wraps APIError so error bodies never look like a result.
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+func (e APIError) Error() string { return e.Code + ": " + e.Message }
+
+func newAPIError(status int, code, format string, args ...interface{}) APIError {
+	return APIError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// With returns a copy of e carrying one more detail.
+func (e APIError) With(key string, value interface{}) APIError {
+	details := make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+	e.Details = details
+	return e
+}
+
+// Errors more than one handler returns.
+var (
+	errTelemetryUnavailable = APIError{Status: 503, Code: "telemetry_unavailable", Message: "monitoring telemetry is not configured on this instance"}
+	errInvalidJSON          = APIError{Status: 400, Code: "invalid_json", Message: "request body is not valid JSON"}
+)
+
+// StatusResponse is the body of calls that only acknowledge.
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// abortWithError writes e, stamped with the request ID, and stops the chain.
+func abortWithError(c *gin.Context, e APIError) {
+	e.RequestID = dashboardRequestID(c)
+	c.AbortWithStatusJSON(e.Status, APIErrorResponse{Error: e})
+}
+
+// --- REQUEST BINDING ---
+
+// requestValidator is implemented by request structs that check their own
+// fields once bound. Returning an APIError picks the code; any other error
+// becomes 400 invalid_request.
+type requestValidator interface {
+	Validate() error
+}
+
+// bindJSON decodes the body into req and validates it. An empty body binds
+// as {}. On failure the error response is written and bindJSON returns false.
+func bindJSON(c *gin.Context, req interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(req); err != nil && err != io.EOF {
+		var apiErr APIError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &apiErr):
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			apiErr = newAPIError(400, "invalid_json", "%s must not be a JSON %s", typeErr.Field, typeErr.Value)
+		default:
+			apiErr = errInvalidJSON
+		}
+		abortWithError(c, apiErr)
+		return false
+	}
+	return validateRequest(c, req)
+}
+
+// bindParams fills req's `uri:"name"` fields from path parameters and its
+// `query:"name"` fields from the query string, then validates it. Absent
+// parameters leave the field at its zero value. A value that does not parse
+// is rejected as invalid_<name>.
+func bindParams(c *gin.Context, req interface{}) bool {
+	v := reflect.ValueOf(req).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		var name, raw string
+		if name = t.Field(i).Tag.Get("uri"); name != "" {
+			raw = c.Param(name)
+		} else if name = t.Field(i).Tag.Get("query"); name != "" {
+			raw = c.Query(name)
+		} else {
+			continue
+		}
+		if raw == "" {
+			continue
+		}
+		if err := setParam(v.Field(i), raw); err != nil {
+			abortWithError(c, newAPIError(400, "invalid_"+name, "%s %s", name, err))
+			return false
+		}
+	}
+	return validateRequest(c, req)
+}
+
+func setParam(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		field.SetInt(n)
+	default:
+		panic("bindParams: unsupported field kind " + field.Kind().String())
+	}
+	return nil
+}
+
+func validateRequest(c *gin.Context, req interface{}) bool {
+	v, ok := req.(requestValidator)
+	if !ok {
+		return true
+	}
+	if err := v.Validate(); err != nil {
+		var apiErr APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = newAPIError(400, "invalid_request", "%s", err)
+		}
+		abortWithError(c, apiErr)
+		return false
+	}
+	return true
+}
+
+// --- SHARED FIELD TYPES ---
+
+// TelegramID is a Telegram user or tracker ID. In JSON it may arrive as a
+// number or a string of digits; JS clients send both. Fractions and
+// exponents are rejected rather than rounded.
+type TelegramID int64
+
+func (id *TelegramID) UnmarshalJSON(b []byte) error {
+	raw := string(b)
+	if raw == "null" {
+		return nil
+	}
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		raw = raw[1 : len(raw)-1]
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return newAPIError(400, "invalid_id", "id must be an integer, got %s", b)
+	}
+	*id = TelegramID(n)
+	return nil
+}
+
+// looseString reads a JSON string, number or bool and keeps its text.
+type looseString string
+
+func (s *looseString) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		*s = looseString(str)
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v.(type) {
+	case float64, bool:
+		*s = looseString(b)
+	case nil:
+	default:
+		return fmt.Errorf("expected a scalar, got %s", b)
+	}
+	return nil
+}
+
+// requireTelegramID reports a missing (zero) or non-positive ID under name.
+func requireTelegramID(name string, id TelegramID) error {
+	if id == 0 {
+		return newAPIError(400, "missing_"+name, "%s is required", name)
+	}
+	if id < 0 {
+		return newAPIError(400, "invalid_"+name, "%s must be a positive integer", name)
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+// logic/telegram_monitoring_audit.go
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- AUDIT TRAIL (Hash-Chained) ---
+//
+// Every dashboard mutation appends one entry to a Redis list. Each entry
+// carries the hash of its predecessor and its own hash over the canonical
+// JSON body, so editing, dropping or reordering entries breaks the chain.
+//
+// An append WATCHes the head and writes it together with the log, so both
+// keys must live on one node: like the monitor store, the audit log needs a
+// single-node Redis and is unavailable on a cluster client.
+
+const (
+	auditGenesisHash = "genesis"
+	auditAppendRetry = 10
+	auditPageSize    = 500
+	auditListDefault = 100
+
+	AuditActorSystem = "system"
+
+	AuditActionWatch          = "watch.toggle"
+	AuditActionRelationStatus = "relation.status"
+	AuditActionReset          = "monitor.reset"
+	AuditActionKillSwitch     = "kill_switch"
+	AuditActionTokenCreate    = "token.create"
+	AuditActionTokenRevoke    = "token.revoke"
+	AuditActionPolicyReload   = "policy.reload"
+)
+
+type AuditEntry struct {
+	Seq       int64           `json:"seq"`
+	Timestamp int64           `json:"ts"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	TargetID  string          `json:"target_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+type auditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// AuditFilter narrows AuditLog.List. Zero values match everything.
+// AuditFilter doubles as the GET /dashboard/api/audit query.
+type AuditFilter struct {
+	Actor    string `query:"actor"`
+	Action   string `query:"action"`
+	TargetID string `query:"target"`
+	Since    int64  `query:"since"` // unix seconds, inclusive
+	Until    int64  `query:"until"` // unix seconds, inclusive
+	Limit    int    `query:"limit"` // 0 means 100; capped at 500
+}
+
+func (f AuditFilter) Validate() error {
+	if f.Since < 0 || f.Until < 0 {
+		return newAPIError(400, "invalid_range", "since and until must be unix seconds")
+	}
+	if f.Until != 0 && f.Until < f.Since {
+		return newAPIError(400, "invalid_range", "until is before since")
+	}
+	if f.Limit < 0 {
+		return newAPIError(400, "invalid_limit", "limit must not be negative")
+	}
+	return nil
+}
+
+type AuditVerification struct {
+	OK       bool   `json:"ok"`
+	Checked  int64  `json:"checked"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // seq of the first bad entry
+	Reason   string `json:"reason,omitempty"`
+}
+
+type AuditLog struct {
+	redis redis.UniversalClient
+}
+
+func NewAuditLog(r redis.UniversalClient) *AuditLog {
+	return &AuditLog{redis: r}
+}
+
+// errAuditNoRedis is why auditLog has nothing when the monitor Redis is unset.
+var errAuditNoRedis = stderrors.New("monitor Redis is not configured")
+
+// auditLog returns the log on the monitor Redis, or why there is none:
+// errAuditNoRedis or ErrRedisCluster.
+func (l TelegramMonitor) auditLog() (*AuditLog, error) {
+	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+		return nil, errAuditNoRedis
+	}
+	if refuseRedisCluster(l.Telemetry.MonitorRedis) {
+		return nil, ErrRedisCluster
+	}
+	return NewAuditLog(l.Telemetry.MonitorRedis), nil
+}
+
+// Append chains a new entry onto the log. before/after are marshalled as-is.
+func (a *AuditLog) Append(ctx context.Context, actor, action, targetID, requestID string, before, after interface{}) (*AuditEntry, error) {
+	beforeRaw, err := marshalAuditValue(before)
+	if err != nil {
+		return nil, err
+	}
+	afterRaw, err := marshalAuditValue(after)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &AuditEntry{
+		Timestamp: time.Now().Unix(),
+		Actor:     actor,
+		Action:    action,
+		TargetID:  targetID,
+		Before:    beforeRaw,
+		After:     afterRaw,
+		RequestID: requestID,
+	}
+
+	// Optimistic transaction on the head: two replicas appending at once
+	// must not both chain onto the same predecessor.
+	for i := 0; i < auditAppendRetry; i++ {
+		err = a.redis.Watch(ctx, func(tx *redis.Tx) error {
+			head, err := readAuditHead(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			entry.Seq = head.Seq + 1
+			entry.PrevHash = head.Hash
+			entry.Hash = ""
+			if entry.Hash, err = hashAuditEntry(entry); err != nil {
+				return err
+			}
+
+			raw, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			newHead, err := json.Marshal(auditHead{Seq: entry.Seq, Hash: entry.Hash})
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.RPush(ctx, keyspace.AuditLog, raw)
+				pipe.Set(ctx, keyspace.AuditHead, newHead, 0)
+				return nil
+			})
+			return err
+		}, keyspace.AuditHead)
+
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// List returns matching entries, newest first.
+func (a *AuditLog) List(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	if f.Limit <= 0 {
+		f.Limit = auditListDefault
+	}
+	if f.Limit > auditPageSize {
+		f.Limit = auditPageSize
+	}
+
+	out := []AuditEntry{}
+	for stop := int64(-1); ; stop -= auditPageSize {
+		start := stop - auditPageSize + 1
+		page, err := a.redis.LRange(ctx, keyspace.AuditLog, start, stop).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(page) - 1; i >= 0; i-- {
+			var e AuditEntry
+			if err := json.Unmarshal([]byte(page[i]), &e); err != nil {
+				return nil, err
+			}
+			if f.Since > 0 && e.Timestamp < f.Since {
+				return out, nil // older than the window, and everything after is older still
+			}
+			if !f.matches(e) {
+				continue
+			}
+			out = append(out, e)
+			if len(out) >= f.Limit {
+				return out, nil
+			}
+		}
+
+		if len(page) < auditPageSize {
+			return out, nil
+		}
+	}
+}
+
+func (f AuditFilter) matches(e AuditEntry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.TargetID != "" && e.TargetID != f.TargetID {
+		return false
+	}
+	if f.Until > 0 && e.Timestamp > f.Until {
+		return false
+	}
+	return true
+}
+
+// Verify walks the whole chain from genesis and reports the first entry whose
+// sequence, back-link or hash does not check out.
+func (a *AuditLog) Verify(ctx context.Context) (*AuditVerification, error) {
+	res := &AuditVerification{OK: true}
+	prev := auditHead{Hash: auditGenesisHash}
+
+	for start := int64(0); ; start += auditPageSize {
+		page, err := a.redis.LRange(ctx, keyspace.AuditLog, start, start+auditPageSize-1).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, raw := range page {
+			var e AuditEntry
+			if err := json.Unmarshal([]byte(raw), &e); err != nil {
+				return res.broken(prev.Seq+1, "entry is not valid JSON"), nil
+			}
+			if e.Seq != prev.Seq+1 {
+				return res.broken(prev.Seq+1, fmt.Sprintf("sequence gap: found seq %d", e.Seq)), nil
+			}
+			if e.PrevHash != prev.Hash {
+				return res.broken(e.Seq, "prev_hash does not match the preceding entry"), nil
+			}
+			want, err := hashAuditEntry(&e)
+			if err != nil {
+				return nil, err
+			}
+			if want != e.Hash {
+				return res.broken(e.Seq, "hash does not match entry contents"), nil
+			}
+			prev = auditHead{Seq: e.Seq, Hash: e.Hash}
+			res.Checked++
+		}
+
+		if len(page) < auditPageSize {
+			break
+		}
+	}
+
+	// Truncating the tail leaves a valid-looking chain; the head catches it.
+	head, err := readAuditHead(ctx, a.redis)
+	if err != nil {
+		return nil, err
+	}
+	if head != prev {
+		return res.broken(prev.Seq+1, fmt.Sprintf("head points at seq %d but log ends at seq %d", head.Seq, prev.Seq)), nil
+	}
+	return res, nil
+}
+
+func (v *AuditVerification) broken(seq int64, reason string) *AuditVerification {
+	v.OK = false
+	v.BrokenAt = seq
+	v.Reason = reason
+	return v
+}
+
+func readAuditHead(ctx context.Context, r redis.Cmdable) (auditHead, error) {
+	raw, err := r.Get(ctx, keyspace.AuditHead).Bytes()
+	if err == redis.Nil {
+		return auditHead{Hash: auditGenesisHash}, nil
+	}
+	if err != nil {
+		return auditHead{}, err
+	}
+	var head auditHead
+	err = json.Unmarshal(raw, &head)
+	return head, err
+}
+
+// hashAuditEntry hashes the canonical JSON of e with Hash blanked out.
+func hashAuditEntry(e *AuditEntry) (string, error) {
+	body := *e
+	body.Hash = ""
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func marshalAuditValue(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// --- Request helpers ---
+
+// dashboardActor names whoever is behind the request, for the audit trail.
+func dashboardActor(c *gin.Context) string {
+	if sess := DashboardSessionFrom(c); sess != nil {
+		return sess.Operator
+	}
+	return "anonymous"
+}
+
+// dashboardRequestID reuses an upstream X-Request-ID or mints one, and echoes
+// it back so operators can quote it when reporting a problem.
+func dashboardRequestID(c *gin.Context) string {
+	if id := c.GetString("request_id"); id != "" {
+		return id
+	}
+	id := c.GetHeader("X-Request-ID")
+	if id == "" {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	c.Set("request_id", id)
+	c.Header("X-Request-ID", id)
+	return id
+}
+
+// audit records a dashboard mutation. Failures are logged, never surfaced:
+// by the time we audit, the change has already happened.
+func (l TelegramMonitor) audit(ctx context.Context, actor, action, targetID, requestID string, before, after interface{}) {
+	a, err := l.auditLog()
+	if err != nil {
+		logger.ZSLogger.Errorw("audit skipped", "action", action, "target_id", targetID, "error", err)
+		return
+	}
+	if _, err := a.Append(ctx, actor, action, targetID, requestID, before, after); err != nil {
+		logger.ZSLogger.Errorw("failed to append audit entry", "action", action, "target_id", targetID, "error", err)
+	}
+}
+
+func (l TelegramMonitor) auditRequest(c *gin.Context, action, targetID string, before, after interface{}) {
+	l.audit(c.Request.Context(), dashboardActor(c), action, targetID, dashboardRequestID(c), before, after)
+}
+
+// --- HTTP HANDLERS ---
+
+// AuditLogResponse is one page of the audit log, newest first.
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// GET /dashboard/api/audit?actor=&action=&target=&since=&until=&limit=
+func (l TelegramMonitor) ServeAuditLog(c *gin.Context) {
+	var f AuditFilter
+	if !bindParams(c, &f) {
+		return
+	}
+	a, err := l.auditLog()
+	if err != nil {
+		logger.ZSLogger.Warnw("audit log unavailable", "error", err)
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+
+	entries, err := a.List(c.Request.Context(), f)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read audit log", "error", err)
+		abortWithError(c, newAPIError(500, "audit_read_failed", "could not read the audit log"))
+		return
+	}
+	c.JSON(200, AuditLogResponse{Entries: entries})
+}
+
+// GET /dashboard/api/audit/verify
+func (l TelegramMonitor) VerifyAuditLog(c *gin.Context) {
+	a, err := l.auditLog()
+	if err != nil {
+		logger.ZSLogger.Warnw("audit log unavailable", "error", err)
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+
+	res, err := a.Verify(c.Request.Context())
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to verify audit log", "error", err)
+		abortWithError(c, newAPIError(500, "audit_read_failed", "could not read the audit log"))
+		return
+	}
+	if !res.OK {
+		logger.ZSLogger.Warnw("audit chain verification failed", "broken_at", res.BrokenAt, "reason", res.Reason)
+	}
+	c.JSON(200, res)
+}
@@ -0,0 +1,48 @@
+// logic/telegram_monitoring_audit_test.go
+package logic
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestAuditLogList(t *testing.T) {
+	ctx := context.Background()
+	_, r := newSnapshotRedis(t)
+	a := NewAuditLog(r)
+	for i := 0; i < auditPageSize+20; i++ {
+		if _, err := a.Append(ctx, "tester", AuditActionWatch, strconv.Itoa(i), "", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"default", 0, auditListDefault},
+		{"within the cap", 3, 3},
+		{"capped", auditPageSize * 2, auditPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := a.List(ctx, AuditFilter{Limit: tt.limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.want {
+				t.Fatalf("got %d entries, want %d", len(entries), tt.want)
+			}
+			if newest := entries[0].TargetID; newest != strconv.Itoa(auditPageSize+19) {
+				t.Errorf("first entry is %s, want the newest", newest)
+			}
+		})
+	}
+
+	res, err := a.Verify(ctx)
+	if err != nil || !res.OK {
+		t.Errorf("verify = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,321 @@
+// logic/telegram_monitoring_auth.go
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- DASHBOARD AUTH (Operator Sessions) ---
+
+const (
+	// DashboardSessionCookie carries the opaque session ID. The value is never
+	// stored server-side; Redis only holds its SHA-256.
+	DashboardSessionCookie = "paradox_session"
+
+	ctxKeyDashboardSession = "dashboard_session"
+
+	defaultDashboardSessionTTL = 12 * time.Hour
+)
+
+// DashboardOperator is a single login allowed into the dashboard.
+// PasswordHash is a bcrypt hash (see HashDashboardPassword), never plain text.
+// An empty Role means RoleViewer.
+type DashboardOperator struct {
+	Username     string        `json:"username" yaml:"username"`
+	PasswordHash string        `json:"password_hash" yaml:"password_hash"`
+	Role         DashboardRole `json:"role" yaml:"role"`
+}
+
+type DashboardAuthConfig struct {
+	Operators  []DashboardOperator `json:"operators" yaml:"operators"`
+	SessionTTL time.Duration       `json:"session_ttl" yaml:"session_ttl"`
+
+	CookieDomain string `json:"cookie_domain" yaml:"cookie_domain"`
+	// InsecureCookie drops the Secure flag. Only for local development over plain HTTP.
+	InsecureCookie bool `json:"insecure_cookie" yaml:"insecure_cookie"`
+
+	// RateLimit is merged over DefaultRateLimitConfig; see RateLimitConfig.
+	RateLimit RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+}
+
+// DashboardSession is what we keep in the monitor Redis for each login.
+type DashboardSession struct {
+	Operator  string        `json:"operator"`
+	Role      DashboardRole `json:"role"`
+	CSRFToken string        `json:"csrf"`
+	TokenID   string        `json:"token_id,omitempty"` // set when authenticated by an API token
+	CreatedAt int64         `json:"created_at"`
+	ExpiresAt int64         `json:"expires_at"`
+}
+
+type dashboardCredential struct {
+	hash []byte // bcrypt
+	role DashboardRole
+}
+
+type DashboardAuth struct {
+	redis     redis.UniversalClient
+	cfg       DashboardAuthConfig
+	operators map[string]dashboardCredential
+	limiter   *DashboardRateLimiter
+}
+
+// dummyPasswordHash is compared against when the username is unknown, so a
+// failed login costs the same whether or not the operator exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("paradox-dummy-password"), bcrypt.DefaultCost)
+
+func NewDashboardAuth(r redis.UniversalClient, cfg DashboardAuthConfig) *DashboardAuth {
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = defaultDashboardSessionTTL
+	}
+
+	operators := make(map[string]dashboardCredential, len(cfg.Operators))
+	for _, op := range cfg.Operators {
+		if op.Username == "" || op.PasswordHash == "" {
+			logger.ZSLogger.Warnw("skipping dashboard operator with empty username or password hash", "username", op.Username)
+			continue
+		}
+		role := op.Role
+		if role == "" {
+			role = RoleViewer
+		}
+		if !role.Valid() {
+			logger.ZSLogger.Warnw("skipping dashboard operator with unknown role", "username", op.Username, "role", op.Role)
+			continue
+		}
+		operators[op.Username] = dashboardCredential{hash: []byte(op.PasswordHash), role: role}
+	}
+
+	return &DashboardAuth{
+		redis:     r,
+		cfg:       cfg,
+		operators: operators,
+		limiter:   NewDashboardRateLimiter(NewRedisRateLimitBackend(r), cfg.RateLimit),
+	}
+}
+
+// UseRateLimitBackend swaps the Redis-backed limiter state, e.g. for
+// MemoryRateLimitBackend in tests.
+func (a *DashboardAuth) UseRateLimitBackend(b RateLimitBackend) {
+	a.limiter.backend = b
+}
+
+// HashDashboardPassword produces the value to put in DashboardOperator.PasswordHash.
+func HashDashboardPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Login checks the operator credentials and, on success, creates a new
+// server-side session. The returned token goes into the session cookie.
+// Wrong credentials return a nil session and a nil error.
+func (a *DashboardAuth) Login(ctx context.Context, username, password string) (string, *DashboardSession, error) {
+	cred, known := a.operators[username]
+	if !known {
+		cred.hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(cred.hash, []byte(password)) != nil || !known {
+		return "", nil, nil
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		return "", nil, err
+	}
+	csrf, err := newSessionToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	sess := &DashboardSession{
+		Operator:  username,
+		Role:      cred.role,
+		CSRFToken: csrf,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(a.cfg.SessionTTL).Unix(),
+	}
+	raw, err := json.Marshal(sess)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := a.redis.Set(ctx, sessionKey(token), raw, a.cfg.SessionTTL).Err(); err != nil {
+		return "", nil, err
+	}
+
+	return token, sess, nil
+}
+
+// Session resolves a cookie token to a live session. Expired, revoked or
+// unknown tokens all come back as nil.
+func (a *DashboardAuth) Session(ctx context.Context, token string) (*DashboardSession, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := a.redis.Get(ctx, sessionKey(token)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sess DashboardSession
+	if err := json.Unmarshal(raw, &sess); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() >= sess.ExpiresAt {
+		return nil, nil
+	}
+	return &sess, nil
+}
+
+// Revoke kills a session server-side. A stolen cookie stops working immediately.
+func (a *DashboardAuth) Revoke(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	return a.redis.Del(ctx, sessionKey(token)).Err()
+}
+
+func (a *DashboardAuth) setSessionCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     DashboardSessionCookie,
+		Value:    token,
+		Path:     "/",
+		Domain:   a.cfg.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   !a.cfg.InsecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// UnlockRequest is POST ?paradox=unlock.
+type UnlockRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (r UnlockRequest) Validate() error {
+	if r.Username == "" || r.Password == "" {
+		return newAPIError(400, "missing_credentials", "username and password are required")
+	}
+	return nil
+}
+
+// SessionResponse answers ?paradox=unlock and ?paradox=logout.
+type SessionResponse struct {
+	Status    string        `json:"status"` // "unlocked" or "logged_out"
+	Role      DashboardRole `json:"role,omitempty"`
+	ExpiresAt int64         `json:"expires_at,omitempty"`
+}
+
+// POST ?paradox=unlock { "username": "...", "password": "..." }
+func (a *DashboardAuth) handleUnlock(c *gin.Context) {
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+
+	if lock := a.limiter.unlockLockedFor(ctx, ip); lock > 0 {
+		rejectRateLimited(c, lock)
+		return
+	}
+	if ok, retry := a.limiter.allow(ctx, RateLimitUnlockRoute, "ip:"+ip); !ok {
+		rejectRateLimited(c, retry)
+		return
+	}
+
+	var req UnlockRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, sess, err := a.Login(ctx, req.Username, req.Password)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to create dashboard session", "username", req.Username, "error", err)
+		abortWithError(c, newAPIError(500, "session_store_failed", "could not open a session"))
+		return
+	}
+	if sess == nil {
+		logger.ZSLogger.Warnw("dashboard login rejected", "username", req.Username, "ip", ip)
+		if lock := a.limiter.unlockFailed(ctx, ip); lock > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(lock.Seconds())))
+		}
+		abortWithError(c, newAPIError(401, "invalid_credentials", "unknown operator or wrong password"))
+		return
+	}
+	a.limiter.unlockSucceeded(ctx, ip)
+
+	a.setSessionCookie(c, token, int(a.cfg.SessionTTL.Seconds()))
+	a.setCSRFCookie(c, sess.CSRFToken, int(a.cfg.SessionTTL.Seconds()))
+	logger.ZSLogger.Infow("dashboard session opened", "operator", sess.Operator, "role", sess.Role, "ip", ip)
+	c.JSON(200, SessionResponse{Status: "unlocked", Role: sess.Role, ExpiresAt: sess.ExpiresAt})
+}
+
+// POST ?paradox=logout
+func (a *DashboardAuth) handleLogout(c *gin.Context) {
+	token, _ := c.Cookie(DashboardSessionCookie)
+	if err := a.Revoke(c.Request.Context(), token); err != nil {
+		logger.ZSLogger.Errorw("failed to revoke dashboard session", "error", err)
+		abortWithError(c, newAPIError(500, "session_revoke_failed", "could not close the session"))
+		return
+	}
+
+	a.setSessionCookie(c, "", -1)
+	a.setCSRFCookie(c, "", -1)
+	c.JSON(200, SessionResponse{Status: "logged_out"})
+}
+
+// sessionFromRequest looks up the session behind the request's cookie.
+func (a *DashboardAuth) sessionFromRequest(c *gin.Context) *DashboardSession {
+	token, err := c.Cookie(DashboardSessionCookie)
+	if err != nil || token == "" {
+		return nil
+	}
+	sess, err := a.Session(c.Request.Context(), token)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to load dashboard session", "error", err)
+		return nil
+	}
+	return sess
+}
+
+// DashboardSessionFrom returns the session attached by ParadoxAuthMiddleware, if any.
+func DashboardSessionFrom(c *gin.Context) *DashboardSession {
+	v, ok := c.Get(ctxKeyDashboardSession)
+	if !ok {
+		return nil
+	}
+	sess, _ := v.(*DashboardSession)
+	return sess
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return keyspace.Session(hex.EncodeToString(sum[:]))
+}
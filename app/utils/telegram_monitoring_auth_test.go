@@ -0,0 +1,137 @@
+// logic/telegram_monitoring_auth_test.go
+package logic
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParadoxAuthMiddleware(t *testing.T) {
+	env := newHandlerEnv(t, true)
+	_, r := newSnapshotRedis(t)
+	ctx := context.Background()
+
+	hash := func(pw string) string {
+		h, err := HashDashboardPassword(pw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	auth := NewDashboardAuth(r, DashboardAuthConfig{
+		Operators: []DashboardOperator{
+			{Username: "vera", PasswordHash: hash("viewer-pw"), Role: RoleViewer},
+			{Username: "otto", PasswordHash: hash("operator-pw"), Role: RoleOperator},
+		},
+		InsecureCookie: true,
+	})
+	auth.UseRateLimitBackend(NewMemoryRateLimitBackend())
+
+	router := gin.New()
+	if err := env.logic.RegisterDashboardRoutes(router, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	viewerCookie, viewer, err := auth.Login(ctx, "vera", "viewer-pw")
+	if err != nil || viewer == nil {
+		t.Fatalf("login: %v", err)
+	}
+	operatorCookie, operator, _ := auth.Login(ctx, "otto", "operator-pw")
+	revokedCookie, _, _ := auth.Login(ctx, "otto", "operator-pw")
+	_ = auth.Revoke(ctx, revokedCookie)
+	viewerToken, _, err := auth.CreateAPIToken(ctx, "ci", RoleViewer, time.Hour, nil, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := func(token string) string { return DashboardSessionCookie + "=" + token }
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		headers   []string
+		wantCode  int
+		wantError string // JSON error; empty with a 403 means the lock screen
+	}{
+		{name: "no session", method: "GET", path: "/dashboard/api/me", wantCode: 403},
+		{name: "reentry shows the lock screen", method: "GET", path: "/dashboard?paradox=reentry", wantCode: 200},
+		{name: "unknown cookie", method: "GET", path: "/dashboard/api/me", headers: []string{"Cookie", session("forged")}, wantCode: 403},
+		{name: "revoked session", method: "GET", path: "/dashboard/api/me", headers: []string{"Cookie", session(revokedCookie)}, wantCode: 403},
+		{name: "viewer reads", method: "GET", path: "/dashboard/api/me", headers: []string{"Cookie", session(viewerCookie)}, wantCode: 200},
+		{
+			name: "viewer cannot write", method: "POST", path: "/dashboard/api/watch", body: `{"id":1,"action":true}`,
+			headers:  []string{"Cookie", session(viewerCookie), DashboardCSRFHeader, viewer.CSRFToken},
+			wantCode: 403, wantError: "forbidden",
+		},
+		{
+			name: "operator without csrf", method: "POST", path: "/dashboard/api/watch", body: `{"id":1,"action":true}`,
+			headers:  []string{"Cookie", session(operatorCookie)},
+			wantCode: 403, wantError: "csrf_token_invalid",
+		},
+		{
+			name: "operator with another session's csrf", method: "POST", path: "/dashboard/api/watch", body: `{"id":1,"action":true}`,
+			headers:  []string{"Cookie", session(operatorCookie), DashboardCSRFHeader, viewer.CSRFToken},
+			wantCode: 403, wantError: "csrf_token_invalid",
+		},
+		{
+			name: "operator writes", method: "POST", path: "/dashboard/api/watch", body: `{"id":1,"action":true}`,
+			headers:  []string{"Cookie", session(operatorCookie), DashboardCSRFHeader, operator.CSRFToken},
+			wantCode: 200,
+		},
+		{
+			name: "operator cannot reset", method: "POST", path: "/dashboard/api/reset", body: `{"scope":"feed"}`,
+			headers:  []string{"Cookie", session(operatorCookie), DashboardCSRFHeader, operator.CSRFToken},
+			wantCode: 403, wantError: "forbidden",
+		},
+		{name: "malformed bearer", method: "GET", path: "/dashboard/api/me", headers: []string{"Authorization", "Bearer nope"}, wantCode: 401, wantError: "malformed_token"},
+		{name: "unknown bearer", method: "GET", path: "/dashboard/api/me", headers: []string{"Authorization", "Bearer pxt_abc_def"}, wantCode: 401, wantError: "invalid_token"},
+		{name: "bearer reads", method: "GET", path: "/dashboard/api/me", headers: []string{"Authorization", "Bearer " + viewerToken}, wantCode: 200},
+		{
+			name: "bearer needs no csrf but keeps its role", method: "POST", path: "/dashboard/api/watch", body: `{"id":1,"action":true}`,
+			headers:  []string{"Authorization", "Bearer " + viewerToken},
+			wantCode: 403, wantError: "forbidden",
+		},
+		{
+			name: "unlock without csrf", method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"viewer-pw"}`,
+			wantCode: 403, wantError: "csrf_token_invalid",
+		},
+		{
+			name: "unlock without password", method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera"}`,
+			headers:  []string{"Cookie", DashboardCSRFCookie + "=pre", DashboardCSRFHeader, "pre"},
+			wantCode: 400, wantError: "missing_credentials",
+		},
+		{
+			name: "unlock with wrong password", method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"nope"}`,
+			headers:  []string{"Cookie", DashboardCSRFCookie + "=pre", DashboardCSRFHeader, "pre"},
+			wantCode: 401, wantError: "invalid_credentials",
+		},
+		{
+			name: "unlock", method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"viewer-pw"}`,
+			headers:  []string{"Cookie", DashboardCSRFCookie + "=pre", DashboardCSRFHeader, "pre"},
+			wantCode: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.path, tt.body, tt.headers...)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %.200s", w.Code, tt.wantCode, w.Body.String())
+			}
+			switch {
+			case tt.wantError != "":
+				if got := errorCode(t, w); got != tt.wantError {
+					t.Errorf("error = %v, want %q", got, tt.wantError)
+				}
+			case w.Code == 403 || tt.path == "/dashboard?paradox=reentry":
+				if !bytes.Contains(w.Body.Bytes(), []byte("Paradox Inertia")) {
+					t.Errorf("expected the lock screen, got %.200s", w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// logic/telegram_monitoring_classifier.go
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// --- DELETION ERROR CLASSIFIER ---
+//
+// Deciding whether an upstream error means "this account is gone" used to be
+// a chain of strings.Contains checks. It is now an ordered list of rules;
+// the first rule that matches decides:
+//
+//   definite   - the account is gone, strike with the rule's weight
+//   suspicious - probably gone, strike (usually with a lower weight)
+//   transient  - a hiccup (flood wait, timeout), no strike
+//   ignore     - not our business, no strike
+//
+// Rules load from a JSON file, so a new upstream error string is a config
+// change rather than a deploy.
+
+type DeletionVerdict string
+
+const (
+	VerdictDefinite   DeletionVerdict = "definite"
+	VerdictSuspicious DeletionVerdict = "suspicious"
+	VerdictTransient  DeletionVerdict = "transient"
+	VerdictIgnore     DeletionVerdict = "ignore"
+
+	// UnmatchedRuleID marks errors no rule recognised.
+	UnmatchedRuleID = "unknown"
+)
+
+func (v DeletionVerdict) Valid() bool {
+	switch v {
+	case VerdictDefinite, VerdictSuspicious, VerdictTransient, VerdictIgnore:
+		return true
+	}
+	return false
+}
+
+// Strikes reports whether errors with this verdict count against the account.
+func (v DeletionVerdict) Strikes() bool {
+	return v == VerdictDefinite || v == VerdictSuspicious
+}
+
+// DeletionClassification is what a classifier says about one error.
+type DeletionClassification struct {
+	RuleID  string          `json:"rule"`
+	Verdict DeletionVerdict `json:"verdict"`
+	Weight  float64         `json:"weight"` // 0 = use the policy default
+}
+
+// DeletionClassifier decides what an upstream error means for the account.
+// ok is false when nothing recognised the error.
+type DeletionClassifier interface {
+	Classify(err error) (c DeletionClassification, ok bool)
+}
+
+// RuleMatch holds exactly one way of recognising an error.
+type RuleMatch struct {
+	// Substring matches if the error message contains it.
+	Substring string `json:"substring,omitempty"`
+	// AllOf matches if the message contains every one of them.
+	AllOf []string `json:"all_of,omitempty"`
+	// Regex matches against the error message.
+	Regex string `json:"regex,omitempty"`
+	// Code matches the UpstreamError code (see AsUpstreamError).
+	Code string `json:"code,omitempty"`
+}
+
+type DeletionRule struct {
+	ID      string          `json:"id"`
+	Match   RuleMatch       `json:"match"`
+	Verdict DeletionVerdict `json:"verdict"`
+	Weight  float64         `json:"weight"`
+}
+
+// DefaultDeletionRules covers the errors IsDefiniteDeletionError used to
+// hard-code, by upstream code. TDLib's tdlib_not_found_the_user parses to
+// USER_NOT_FOUND, and Qt's "400 ... Not Found" to NOT_FOUND.
+func DefaultDeletionRules() []DeletionRule {
+	return []DeletionRule{
+		{ID: "peer_id_invalid", Match: RuleMatch{Code: CodePeerIDInvalid}, Verdict: VerdictDefinite, Weight: 1},
+		{ID: "user_not_found", Match: RuleMatch{Code: CodeUserNotFound}, Verdict: VerdictDefinite, Weight: 1},
+		{ID: "qt_400_not_found", Match: RuleMatch{Code: CodeNotFound}, Verdict: VerdictDefinite, Weight: 1},
+	}
+}
+
+type compiledRule struct {
+	DeletionRule
+	re *regexp.Regexp
+}
+
+func (r compiledRule) matches(err error, msg string) bool {
+	m := r.Match
+	switch {
+	case m.Substring != "":
+		return strings.Contains(msg, m.Substring)
+	case len(m.AllOf) > 0:
+		for _, s := range m.AllOf {
+			if !strings.Contains(msg, s) {
+				return false
+			}
+		}
+		return true
+	case r.re != nil:
+		return r.re.MatchString(msg)
+	case m.Code != "":
+		ue := AsUpstreamError(err)
+		return ue != nil && ue.Code == m.Code
+	}
+	return false
+}
+
+// RuleRegistry is the rule-based DeletionClassifier. First match wins.
+type RuleRegistry struct {
+	rules []compiledRule
+}
+
+func NewRuleRegistry(rules []DeletionRule) (*RuleRegistry, error) {
+	reg := &RuleRegistry{}
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d: id is required", i)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %q: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+		if !rule.Verdict.Valid() {
+			return nil, fmt.Errorf("rule %q: unknown verdict %q", rule.ID, rule.Verdict)
+		}
+		if rule.Weight < 0 {
+			return nil, fmt.Errorf("rule %q: weight must not be negative", rule.ID)
+		}
+
+		set := 0
+		for _, on := range []bool{rule.Match.Substring != "", len(rule.Match.AllOf) > 0, rule.Match.Regex != "", rule.Match.Code != ""} {
+			if on {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("rule %q: match needs exactly one of substring, all_of, regex, code", rule.ID)
+		}
+
+		cr := compiledRule{DeletionRule: rule}
+		if rule.Match.Regex != "" {
+			re, err := regexp.Compile(rule.Match.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+			}
+			cr.re = re
+		}
+		reg.rules = append(reg.rules, cr)
+	}
+	return reg, nil
+}
+
+func (reg *RuleRegistry) Classify(err error) (DeletionClassification, bool) {
+	if err == nil {
+		return DeletionClassification{}, false
+	}
+	msg := err.Error()
+	for _, r := range reg.rules {
+		if r.matches(err, msg) {
+			return DeletionClassification{RuleID: r.ID, Verdict: r.Verdict, Weight: r.Weight}, true
+		}
+	}
+	return DeletionClassification{}, false
+}
+
+func (reg *RuleRegistry) Rules() []DeletionRule {
+	out := make([]DeletionRule, len(reg.rules))
+	for i, r := range reg.rules {
+		out[i] = r.DeletionRule
+	}
+	return out
+}
+
+// --- Active classifier ---
+
+type classifierHolder struct {
+	mu         sync.RWMutex
+	classifier DeletionClassifier
+	path       string
+}
+
+var activeClassifier = func() *classifierHolder {
+	reg, err := NewRuleRegistry(DefaultDeletionRules())
+	if err != nil {
+		panic(err) // the built-in rules are broken; fail at startup, not on the first error
+	}
+	return &classifierHolder{classifier: reg}
+}()
+
+// CurrentDeletionClassifier returns the classifier in force right now.
+func CurrentDeletionClassifier() DeletionClassifier {
+	activeClassifier.mu.RLock()
+	defer activeClassifier.mu.RUnlock()
+	return activeClassifier.classifier
+}
+
+// SetDeletionClassifier swaps in another classifier (rules or custom).
+func SetDeletionClassifier(c DeletionClassifier) {
+	activeClassifier.mu.Lock()
+	activeClassifier.classifier = c
+	activeClassifier.mu.Unlock()
+}
+
+type deletionRulesFile struct {
+	Rules []DeletionRule `json:"rules"`
+}
+
+// LoadDeletionRulesFile replaces the rules with the ones in a JSON file
+// ({"rules": [...]}) and remembers the path for ReloadDeletionRules.
+func LoadDeletionRulesFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f deletionRulesFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("deletion rules %s: %w", path, err)
+	}
+	reg, err := NewRuleRegistry(f.Rules)
+	if err != nil {
+		return fmt.Errorf("deletion rules %s: %w", path, err)
+	}
+
+	activeClassifier.mu.Lock()
+	activeClassifier.classifier = reg
+	activeClassifier.path = path
+	activeClassifier.mu.Unlock()
+
+	logger.ZSLogger.Infow("deletion rules loaded", "path", path, "rules", len(f.Rules))
+	return nil
+}
+
+// ReloadDeletionRules re-reads the file given to LoadDeletionRulesFile.
+// Without one it is a no-op; on error the previous rules stay in force.
+func ReloadDeletionRules() error {
+	activeClassifier.mu.RLock()
+	path := activeClassifier.path
+	activeClassifier.mu.RUnlock()
+
+	if path == "" {
+		return nil
+	}
+	return LoadDeletionRulesFile(path)
+}
+
+// ClassifyDeletionError runs err through the active classifier. Errors no
+// rule recognises come back as a definite strike under UnmatchedRuleID, so
+// callers that already decided the error is a deletion keep counting it.
+func ClassifyDeletionError(err error) DeletionClassification {
+	if c, ok := CurrentDeletionClassifier().Classify(err); ok {
+		return c
+	}
+	return DeletionClassification{RuleID: UnmatchedRuleID, Verdict: VerdictDefinite}
+}
+
+// --- HTTP HANDLERS ---
+
+// DeletionRulesResponse lists the active rules. Custom is set, and Rules
+// empty, when a SetDeletionClassifier override is not a RuleRegistry.
+type DeletionRulesResponse struct {
+	Rules  []DeletionRule `json:"rules"`
+	Custom bool           `json:"custom,omitempty"`
+}
+
+// GET /dashboard/api/classifier/rules
+func (l TelegramMonitor) ServeDeletionRules(c *gin.Context) {
+	reg, ok := CurrentDeletionClassifier().(*RuleRegistry)
+	if !ok {
+		c.JSON(200, DeletionRulesResponse{Rules: []DeletionRule{}, Custom: true})
+		return
+	}
+	c.JSON(200, DeletionRulesResponse{Rules: reg.Rules()})
+}
@@ -0,0 +1,82 @@
+// logic/telegram_monitoring_csrf.go
+package logic
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- CSRF (Synchronizer Token) ---
+//
+// Logged in: the token is minted with the session, stored next to it in
+// Redis, and mirrored into a JS-readable cookie. Every non-GET request must
+// echo it in the X-CSRF-Token header, and we compare against the server copy.
+//
+// Logged out (the unlock POST): there is no session yet, so we fall back to
+// double-submit: the lock screen plants a random cookie and the unlock
+// request must echo it in the header.
+
+const (
+	DashboardCSRFCookie = "paradox_csrf"
+	DashboardCSRFHeader = "X-CSRF-Token"
+)
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+func (a *DashboardAuth) setCSRFCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     DashboardCSRFCookie,
+		Value:    token,
+		Path:     "/",
+		Domain:   a.cfg.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   !a.cfg.InsecureCookie,
+		HttpOnly: false, // the dashboard JS has to read it
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ensurePreSessionCSRF plants the double-submit cookie the lock screen needs
+// to POST ?paradox=unlock.
+func (a *DashboardAuth) ensurePreSessionCSRF(c *gin.Context) {
+	if v, err := c.Cookie(DashboardCSRFCookie); err == nil && v != "" {
+		return
+	}
+	token, err := newSessionToken()
+	if err != nil {
+		return
+	}
+	a.setCSRFCookie(c, token, 0)
+}
+
+// validCSRF checks the request header against the session token, or against
+// the double-submit cookie when there is no session. Bearer-token requests
+// are exempt: browsers never attach an Authorization header on their own.
+func validCSRF(c *gin.Context, sess *DashboardSession) bool {
+	if sess != nil && sess.TokenID != "" {
+		return true
+	}
+	header := c.GetHeader(DashboardCSRFHeader)
+	if header == "" {
+		return false
+	}
+
+	expected := ""
+	if sess != nil {
+		expected = sess.CSRFToken
+	} else {
+		expected, _ = c.Cookie(DashboardCSRFCookie)
+	}
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte(expected)) == 1
+}
+
+func rejectCSRF(c *gin.Context) {
+	abortWithError(c, newAPIError(403, "csrf_token_invalid", "missing or mismatched %s header", DashboardCSRFHeader))
+}
@@ -0,0 +1,544 @@
+// logic/telegram_monitoring_handlers_test.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+)
+
+// The handlers run against MemoryMonitorStore and the fake repos below. The
+// fakes and the harness are shared by the other telegram_monitoring tests.
+
+// --- Fakes ---
+
+type fakeTelegramUserRepo struct {
+	mu      sync.Mutex
+	deleted map[int64]bool
+	err     error
+}
+
+func (f *fakeTelegramUserRepo) UpdateIsDeletedByTelegramID(_ opentracing.Span, _ context.Context, telegramID int64, isDeleted bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted[telegramID] = isDeleted
+	return nil
+}
+
+func (f *fakeTelegramUserRepo) isDeleted(telegramID int64) (bool, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.deleted[telegramID]
+	return v, ok
+}
+
+type fakeTrackedRepo struct {
+	mu          sync.Mutex
+	identities  map[int64]*domain.TrackedIdentity
+	contacts    map[int64][]domain.TrackerContact
+	identityErr error
+	contactsErr error
+	updateErr   error
+	stopErr     error
+	stopped     map[int64]bool
+	statuses    map[int64]string // contact id -> last status written
+	queried     []int64
+}
+
+func (f *fakeTrackedRepo) StopTrackingForTelegramID(_ opentracing.Span, _ context.Context, telegramID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopErr != nil {
+		return f.stopErr
+	}
+	f.stopped[telegramID] = true
+	return nil
+}
+
+func (f *fakeTrackedRepo) ResumeTrackingForTelegramID(_ opentracing.Span, _ context.Context, telegramID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.stopped, telegramID)
+	return nil
+}
+
+func (f *fakeTrackedRepo) GetIdentityByTrackedTelegramID(_ opentracing.Span, _ context.Context, telegramID int64) (*domain.TrackedIdentity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queried = append(f.queried, telegramID)
+	if f.identityErr != nil {
+		return nil, f.identityErr
+	}
+	return f.identities[telegramID], nil
+}
+
+func (f *fakeTrackedRepo) GetTrackerContactsByTrackedTelegramID(_ opentracing.Span, _ context.Context, telegramID int64) ([]domain.TrackerContact, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.contactsErr != nil {
+		return nil, f.contactsErr
+	}
+	return f.contacts[telegramID], nil
+}
+
+func (f *fakeTrackedRepo) UpdateTrackerContactStatus(_ opentracing.Span, _ context.Context, id int64, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.updateErr != nil {
+		return f.updateErr
+	}
+	f.statuses[id] = status
+	return nil
+}
+
+func (f *fakeTrackedRepo) isStopped(telegramID int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopped[telegramID]
+}
+
+// --- Harness ---
+
+type handlerEnv struct {
+	logic   TelegramMonitor
+	store   *MemoryMonitorStore
+	users   *fakeTelegramUserRepo
+	tracked *fakeTrackedRepo
+	router  *gin.Engine
+}
+
+// newHandlerEnv wires a TelegramMonitor to a fresh in-memory store. withStore
+// false leaves both the store and telemetry unset, as on a misconfigured
+// replica.
+func newHandlerEnv(t *testing.T, withStore bool) *handlerEnv {
+	t.Helper()
+	env := &handlerEnv{
+		users: &fakeTelegramUserRepo{deleted: map[int64]bool{}},
+		tracked: &fakeTrackedRepo{
+			identities: map[int64]*domain.TrackedIdentity{},
+			contacts:   map[int64][]domain.TrackerContact{},
+			stopped:    map[int64]bool{},
+			statuses:   map[int64]string{},
+		},
+	}
+	logic := TelegramLogic{TelegramUserRepo: env.users, TrackedTelegramUserRepo: env.tracked}
+	if withStore {
+		env.store = NewMemoryMonitorStore()
+		env.logic = NewTelegramMonitor(logic, env.store, env.tracked)
+	} else {
+		env.logic = NewTelegramMonitor(logic, nil, env.tracked)
+	}
+	env.router = newTestRouter(env.logic, &DashboardSession{Operator: "tester", Role: RoleAdmin})
+	return env
+}
+
+// newTestRouter mounts every dashboard route with sess already attached, the
+// way RegisterDashboardRoutes does after auth has run.
+func newTestRouter(l TelegramMonitor, sess *DashboardSession) *gin.Engine {
+	r := gin.New()
+	g := r.Group("", func(c *gin.Context) {
+		if sess != nil {
+			c.Set(ctxKeyDashboardSession, sess)
+		}
+		c.Next()
+	})
+	for _, rt := range dashboardRoutes {
+		handler := rt.Handler
+		g.Handle(rt.Method, rt.Path, func(c *gin.Context) { handler(l, c) })
+	}
+	return r
+}
+
+func serve(h http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Add(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var out map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("response is not JSON (%d): %s", w.Code, w.Body.String())
+	}
+	return out
+}
+
+// errorCode returns the code of an APIError body, checking the envelope.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body APIErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code == "" {
+		t.Fatalf("not an error envelope (%d): %s", w.Code, w.Body.String())
+	}
+	if body.Error.Message == "" || body.Error.RequestID == "" || body.Error.RequestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("incomplete error envelope: %+v (X-Request-ID %q)", body.Error, w.Header().Get("X-Request-ID"))
+	}
+	return body.Error.Code
+}
+
+func strp(s string) *string { return &s }
+
+// withStrikePolicy swaps the policy for one test.
+func withStrikePolicy(t *testing.T, edit func(*StrikePolicy)) {
+	t.Helper()
+	prev := CurrentStrikePolicy()
+	p := DefaultStrikePolicy()
+	edit(&p)
+	if err := SetStrikePolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = SetStrikePolicy(prev) })
+}
+
+// --- Handlers ---
+
+func TestInspectEntity(t *testing.T) {
+	tests := []struct {
+		name      string
+		noStore   bool
+		query     string
+		seed      func(s *MemoryMonitorStore)
+		wantCode  int
+		wantType  string
+		watched   bool
+		related   []string
+		historyN  int
+		wantError string
+	}{
+		{name: "missing id", query: "", wantCode: 400, wantError: "missing_id"},
+		{name: "zero id", query: "?id=0", wantCode: 400, wantError: "missing_id"},
+		{name: "negative id", query: "?id=-5", wantCode: 400, wantError: "invalid_id"},
+		{name: "malformed id", query: "?id=abc", wantCode: 400, wantError: "invalid_id"},
+		{name: "fractional id", query: "?id=12.5", wantCode: 400, wantError: "invalid_id"},
+		{name: "no telemetry", noStore: true, query: "?id=1", wantCode: 503, wantError: "telemetry_unavailable"},
+		{name: "unknown id", query: "?id=1", wantCode: 200, wantType: "unknown", related: []string{}},
+		{
+			name:  "watched user with trackers",
+			query: "?id=100",
+			seed: func(s *MemoryMonitorStore) {
+				s.Relate(100, 7)
+				s.Relate(100, 8)
+				_ = s.SetWatched(context.Background(), 100, true)
+				s.AppendHistory(100, `{"s":"online"}`, `{"s":"offline"}`)
+			},
+			wantCode: 200, wantType: "user", watched: true, related: []string{"7", "8"}, historyN: 2,
+		},
+		{
+			name:     "tracker",
+			query:    "?id=7",
+			seed:     func(s *MemoryMonitorStore) { s.Relate(100, 7) },
+			wantCode: 200, wantType: "tracker", related: []string{"100"},
+		},
+		{
+			name:  "quarantine counts as watched",
+			query: "?id=55",
+			seed: func(s *MemoryMonitorStore) {
+				_, _ = s.ApplyStrike(context.Background(), 55, DeletionClassification{RuleID: "r"}, 1, time.Now(), DefaultStrikePolicy())
+				_ = s.SetWatched(context.Background(), 55, false)
+			},
+			wantCode: 200, wantType: "unknown", watched: true, related: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, !tt.noStore)
+			if tt.seed != nil {
+				tt.seed(env.store)
+			}
+			w := serve(env.router, "GET", "/dashboard/api/inspect"+tt.query, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantError != "" {
+				if got := errorCode(t, w); got != tt.wantError {
+					t.Errorf("error = %v, want %q", got, tt.wantError)
+				}
+				return
+			}
+			body := decodeBody(t, w)
+			if body["type"] != tt.wantType {
+				t.Errorf("type = %v, want %s", body["type"], tt.wantType)
+			}
+			if body["isWatched"] != tt.watched {
+				t.Errorf("isWatched = %v, want %v", body["isWatched"], tt.watched)
+			}
+			related, _ := json.Marshal(body["related"])
+			want, _ := json.Marshal(tt.related)
+			if string(related) != string(want) {
+				t.Errorf("related = %s, want %s", related, want)
+			}
+			history, _ := body["history"].([]interface{})
+			if len(history) != tt.historyN {
+				t.Errorf("history has %d entries, want %d", len(history), tt.historyN)
+			}
+		})
+	}
+}
+
+func TestToggleWatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		noStore   bool
+		body      string
+		wantCode  int
+		wantError string
+		id        int64
+		watched   bool
+	}{
+		{name: "invalid json", body: `{"id":`, wantCode: 400, wantError: "invalid_json"},
+		{name: "wrong field type", body: `{"id": 1, "action": "yes"}`, wantCode: 400, wantError: "invalid_json"},
+		{name: "id as number", body: `{"id": 1234567890123, "action": true}`, wantCode: 200, id: 1234567890123, watched: true},
+		{name: "id as string", body: `{"id": "42", "action": true}`, wantCode: 200, id: 42, watched: true},
+		{name: "unwatch", body: `{"id": 42, "action": false}`, wantCode: 200, id: 42, watched: false},
+		{name: "id beyond float precision", body: `{"id": 9007199254740993, "action": true}`, wantCode: 200, id: 9007199254740993, watched: true},
+		{name: "fractional id", body: `{"id": 1.5, "action": true}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "exponent id", body: `{"id": 1e9, "action": true}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "non-numeric string", body: `{"id": "abc", "action": true}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "bool id", body: `{"id": true, "action": true}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "negative id", body: `{"id": -1, "action": true}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "missing id", body: `{"action": true}`, wantCode: 400, wantError: "missing_id"},
+		{name: "empty body", body: "", wantCode: 400, wantError: "missing_id"},
+		{name: "no telemetry", noStore: true, body: `{"id": 1, "action": true}`, wantCode: 503, wantError: "telemetry_unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, !tt.noStore)
+			if env.store != nil {
+				_ = env.store.SetWatched(context.Background(), 42, true)
+			}
+			w := serve(env.router, "POST", "/dashboard/api/watch", tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantError != "" {
+				if got := errorCode(t, w); got != tt.wantError {
+					t.Errorf("error = %v, want %q", got, tt.wantError)
+				}
+				return
+			}
+			watched, _ := env.store.IsWatched(context.Background(), tt.id)
+			if watched != tt.watched {
+				t.Errorf("watched(%d) = %v, want %v", tt.id, watched, tt.watched)
+			}
+		})
+	}
+}
+
+func TestServeDashboardStats(t *testing.T) {
+	t.Run("no telemetry", func(t *testing.T) {
+		env := newHandlerEnv(t, false)
+		w := serve(env.router, "GET", "/dashboard/api/stats", "")
+		if w.Code != 503 || errorCode(t, w) != "telemetry_unavailable" {
+			t.Fatalf("got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	for _, top := range []string{"abc", "-1", "1000"} {
+		t.Run("top="+top, func(t *testing.T) {
+			env := newHandlerEnv(t, true)
+			w := serve(env.router, "GET", "/dashboard/api/stats?top="+top, "")
+			if w.Code != 400 || errorCode(t, w) != "invalid_top" {
+				t.Fatalf("got %d %s", w.Code, w.Body.String())
+			}
+		})
+	}
+	t.Run("top=0 is the default", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		if w := serve(env.router, "GET", "/dashboard/api/stats?top=0", ""); w.Code != 200 {
+			t.Fatalf("got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("empty store", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		body := decodeBody(t, serve(env.router, "GET", "/dashboard/api/stats", ""))
+		if body["rate"] != "100.0" || body["quarantine_count"] != 0.0 {
+			t.Errorf("rate = %v, quarantine_count = %v", body["rate"], body["quarantine_count"])
+		}
+		graph := body["graph"].(map[string]interface{})
+		if n := len(graph["labels"].([]interface{})); n != 30 {
+			t.Errorf("graph has %d labels, want 30", n)
+		}
+	})
+
+	t.Run("seeded", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		ctx := context.Background()
+		now := time.Now()
+		for i := 0; i < 8; i++ {
+			env.store.RecordLookup(now, i < 2)
+		}
+		env.store.PushFeed(`{"tg":1}`, `{"tg":2,"e":"PEER_ID_INVALID"}`)
+		env.store.SetTrackerHealth("7", 3)
+		env.store.SetTrackerHealth("8", 9)
+		_ = env.store.RecordErrorCode(ctx, CodePeerIDInvalid, now)
+		_, _ = env.store.ApplyStrike(ctx, 42, DeletionClassification{RuleID: "peer_id_invalid", Verdict: VerdictDefinite}, 2, now, CurrentStrikePolicy())
+		_, _ = env.store.EnqueueReview(ctx, PendingVerdict{TelegramID: 42, QueuedAt: now.Unix(), Score: 2})
+
+		body := decodeBody(t, serve(env.router, "GET", "/dashboard/api/stats?class="+CodePeerIDInvalid, ""))
+		if body["total_hits"] != 8.0 || body["total_errs"] != 2.0 || body["rate"] != "75.0" {
+			t.Errorf("hits/errs/rate = %v/%v/%v", body["total_hits"], body["total_errs"], body["rate"])
+		}
+		if body["quarantine_count"] != 1.0 || body["review_count"] != 1.0 {
+			t.Errorf("quarantine_count = %v, review_count = %v", body["quarantine_count"], body["review_count"])
+		}
+		entry := body["quarantine_list"].([]interface{})[0].(map[string]interface{})
+		if entry["id"] != 42.0 || entry["rule"] != "peer_id_invalid" || entry["review"] == nil {
+			t.Errorf("quarantine entry = %v", entry)
+		}
+		if s := entry["strikes"].(float64); math.Abs(s-2) > 0.01 {
+			t.Errorf("strikes = %v, want ~2", s)
+		}
+
+		feed := body["feed"].([]interface{})
+		if len(feed) != 2 || feed[0].(map[string]interface{})["ec"] != CodePeerIDInvalid {
+			t.Errorf("feed = %v, want newest first with its error code", feed)
+		}
+		worst := body["worst_trackers"].([]interface{})
+		if len(worst) != 2 || worst[0].(map[string]interface{})["Member"] != "8" {
+			t.Errorf("worst_trackers = %v", worst)
+		}
+
+		graph := body["graph"].(map[string]interface{})
+		errs := graph["errs"].([]interface{})
+		if graph["class"] != CodePeerIDInvalid || errs[len(errs)-1] != 1.0 {
+			t.Errorf("class series = %v (%v)", errs, graph["class"])
+		}
+		classes := body["error_classes"].([]interface{})
+		if len(classes) != 1 || classes[0].(map[string]interface{})["code"] != CodePeerIDInvalid {
+			t.Errorf("error_classes = %v", classes)
+		}
+	})
+}
+
+func TestGetDeepDetails(t *testing.T) {
+	identity := &domain.TrackedIdentity{
+		Fullname:           strp("Ada"),
+		Username:           strp("ada"),
+		Bio:                strp("hi"),
+		OnlineStatus:       "ONLINE",
+		ProfilePhotosCount: 3,
+		UpdatedAtStamp:     1700000000,
+	}
+	contacts := []domain.TrackerContact{
+		{ID: 1, TrackerPhoneID: 5, TrackedTelegramID: 42, TrackedPhoneNumber: "+100", Status: "active", CreatedAtStamp: 1690000000},
+	}
+
+	tests := []struct {
+		name         string
+		query        string
+		identityErr  error
+		contactsErr  error
+		wantQueried  int64
+		wantName     string
+		wantPhone    string
+		wantTrackers int
+	}{
+		{name: "found", query: "?id=42", wantQueried: 42, wantName: "Ada", wantPhone: "+100 (Detected)", wantTrackers: 1},
+		{name: "identity repo error", query: "?id=42", identityErr: errors.New("db down"), wantQueried: 42, wantName: "Unknown", wantPhone: "+100 (Detected)", wantTrackers: 1},
+		{name: "contacts repo error", query: "?id=42", contactsErr: errors.New("db down"), wantQueried: 42, wantName: "Ada", wantPhone: "N/A", wantTrackers: 0},
+		{name: "unknown id", query: "?id=7", wantQueried: 7, wantName: "Unknown", wantPhone: "N/A", wantTrackers: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, false) // the deep scan only reads the DB
+			env.tracked.identities[42] = identity
+			env.tracked.contacts[42] = contacts
+			env.tracked.identityErr = tt.identityErr
+			env.tracked.contactsErr = tt.contactsErr
+
+			w := serve(env.router, "GET", "/dashboard/api/relations/deep"+tt.query, "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			body := decodeBody(t, w)
+			id := body["identity"].(map[string]interface{})
+			if id["name"] != tt.wantName || id["phone"] != tt.wantPhone {
+				t.Errorf("identity = %v", id)
+			}
+			trackers, _ := body["trackers"].([]interface{})
+			if len(trackers) != tt.wantTrackers {
+				t.Errorf("trackers = %v, want %d", trackers, tt.wantTrackers)
+			}
+			if len(env.tracked.queried) != 1 || env.tracked.queried[0] != tt.wantQueried {
+				t.Errorf("queried %v, want [%d]", env.tracked.queried, tt.wantQueried)
+			}
+		})
+	}
+
+	// Bad IDs are rejected before the repo is asked about account 0.
+	for query, want := range map[string]string{"": "missing_id", "?id=abc": "invalid_id", "?id=-3": "invalid_id"} {
+		t.Run("rejects "+query, func(t *testing.T) {
+			env := newHandlerEnv(t, false)
+			w := serve(env.router, "GET", "/dashboard/api/relations/deep"+query, "")
+			if w.Code != 400 || errorCode(t, w) != want {
+				t.Fatalf("got %d %s, want 400 %s", w.Code, w.Body.String(), want)
+			}
+			if len(env.tracked.queried) != 0 {
+				t.Errorf("repo queried %v", env.tracked.queried)
+			}
+		})
+	}
+}
+
+func TestUpdateRelationStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		updateErr error
+		wantCode  int
+		wantError string
+	}{
+		{name: "invalid json", body: `{"id":`, wantCode: 400, wantError: "invalid_json"},
+		{name: "missing id", body: `{"status": "INACTIVE"}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "unknown status", body: `{"id": 1, "status": "blocked"}`, wantCode: 400, wantError: "invalid_status"},
+		{name: "malformed tracked id", body: `{"id": 1, "status": "INACTIVE", "tracked_telegram_id": "x"}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "repo error", body: `{"id": 1, "status": "INACTIVE"}`, updateErr: errors.New("db down"), wantCode: 500, wantError: "db_update_failed"},
+		{name: "ok", body: `{"id": 1, "status": "INACTIVE"}`, wantCode: 200},
+		{name: "ok with previous status", body: `{"id": 1, "status": "INACTIVE", "tracked_telegram_id": "42"}`, wantCode: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, false)
+			env.tracked.contacts[42] = []domain.TrackerContact{{ID: 1, Status: "ACTIVE"}}
+			env.tracked.updateErr = tt.updateErr
+
+			w := serve(env.router, "POST", "/dashboard/api/relations/update", tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantError != "" {
+				if got := errorCode(t, w); got != tt.wantError {
+					t.Errorf("error = %v, want %q", got, tt.wantError)
+				}
+				return
+			}
+			body := decodeBody(t, w)
+			if body["new_status"] != "INACTIVE" || env.tracked.statuses[1] != "INACTIVE" {
+				t.Errorf("body = %v, stored = %q", body, env.tracked.statuses[1])
+			}
+		})
+	}
+}
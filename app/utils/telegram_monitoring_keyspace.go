@@ -0,0 +1,34 @@
+// logic/telegram_monitoring_keyspace.go
+package logic
+
+import (
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// --- HTTP HANDLERS ---
+
+// KeysAuditResponse is keyspace.Audit's report plus the schema it checked.
+type KeysAuditResponse struct {
+	OK     bool                 `json:"ok"`
+	Report keyspace.AuditReport `json:"report"`
+	Schema []keyspace.Spec      `json:"schema"`
+}
+
+// GET /dashboard/api/admin/keys/audit
+//
+// Same report as `monitor keys audit` (keyspace.RunAuditCommand), as JSON.
+func (l TelegramMonitor) ServeKeysAudit(c *gin.Context) {
+	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	report, err := keyspace.Audit(c.Request.Context(), l.Telemetry.MonitorRedis)
+	if err != nil {
+		logger.ZSLogger.Errorw("keys audit failed", "error", err)
+		abortWithError(c, newAPIError(500, "keys_audit_failed", "could not audit the monitor keyspace"))
+		return
+	}
+	c.JSON(200, KeysAuditResponse{OK: report.OK(), Report: report, Schema: keyspace.Schema})
+}
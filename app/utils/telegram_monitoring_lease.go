@@ -0,0 +1,274 @@
+// logic/telegram_monitoring_lease.go
+package logic
+
+import (
+	"context"
+	stderrors "errors"
+	"expvar"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- VERDICT LEASES (per-ID lock with fencing tokens) ---
+//
+// Several replicas run TelegramLogic. Executing a verdict (kill, restore)
+// for one telegram ID takes a lease on "verdict:<id>" first, so those DB
+// writes never run in parallel for the same account.
+//
+// Every lease carries a fencing token that only ever grows. A holder that
+// stalled past its lease (GC pause, slow DB) finds its token superseded on
+// the next Check and stops before writing anything else.
+//
+// The token is only checked here, not passed to the DB: the repos take no
+// fencing token. A holder that stalls between a Check and the write after it
+// can still race the next holder; the window is one DB call wide. The kill
+// claim, not the lease, is what stops a second kill from writing at all.
+//
+//   lease:<name>   HASH { owner, token }  expires with the lease
+//   lease:fence    STRING counter the tokens come from
+
+var (
+	ErrLeaseHeld = stderrors.New("lease held by another owner")
+	// ErrLeaseLost is returned by work that stopped because its lease
+	// expired or was taken over before it finished.
+	ErrLeaseLost = stderrors.New("lease lost")
+)
+
+type Lease struct {
+	Name      string
+	Owner     string
+	Token     uint64
+	ExpiresAt time.Time
+}
+
+// LeaseLocker hands out leases. Implementations: RedisLeaseLocker for
+// production, MemoryLeaseLocker for tests and single-process setups.
+type LeaseLocker interface {
+	// Acquire returns ErrLeaseHeld while someone else holds name.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (*Lease, error)
+	// Check reports whether the lease is still ours (not expired, not taken over).
+	Check(ctx context.Context, lease *Lease) (bool, error)
+	// Release drops the lease; false means it had already expired.
+	Release(ctx context.Context, lease *Lease) (bool, error)
+}
+
+// --- Metrics ---
+
+// leaseMetrics is published on /debug/vars as "monitor_leases" and echoed
+// in the dashboard stats.
+var leaseMetrics = expvar.NewMap("monitor_leases")
+
+const (
+	leaseMetricAcquired  = "acquired"
+	leaseMetricContended = "contended" // Acquire found the lease held
+	leaseMetricExpired   = "expired"   // lease lost before Release (Check or Release said no)
+	leaseMetricReleased  = "released"
+	leaseMetricErrors    = "errors" // backend failures
+)
+
+func leaseMetricsSnapshot() map[string]int64 {
+	out := map[string]int64{}
+	leaseMetrics.Do(func(kv expvar.KeyValue) {
+		if v, ok := kv.Value.(*expvar.Int); ok {
+			out[kv.Key] = v.Value()
+		}
+	})
+	return out
+}
+
+// --- Redis ---
+
+var leaseAcquireScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return {0, redis.call('PTTL', KEYS[1])}
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'token', token)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return {1, token}
+`)
+
+var leaseReleaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'token') == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type RedisLeaseLocker struct {
+	redis redis.Cmdable
+	owner string
+}
+
+// NewRedisLeaseLocker uses owner to tell holders apart in logs; empty picks
+// hostname:pid.
+func NewRedisLeaseLocker(r redis.Cmdable, owner string) *RedisLeaseLocker {
+	if owner == "" {
+		host, _ := os.Hostname()
+		owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return &RedisLeaseLocker{redis: r, owner: owner}
+}
+
+func (l *RedisLeaseLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lease, error) {
+	res, err := leaseAcquireScript.Run(ctx, l.redis, []string{keyspace.Lease(name), keyspace.LeaseFence}, l.owner, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 2 {
+		return nil, fmt.Errorf("lease script: unexpected reply %v", res)
+	}
+	if res[0] == 0 {
+		return nil, ErrLeaseHeld
+	}
+	return &Lease{Name: name, Owner: l.owner, Token: uint64(res[1]), ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+func (l *RedisLeaseLocker) Check(ctx context.Context, lease *Lease) (bool, error) {
+	token, err := l.redis.HGet(ctx, keyspace.Lease(lease.Name), "token").Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return token == strconv.FormatUint(lease.Token, 10), nil
+}
+
+func (l *RedisLeaseLocker) Release(ctx context.Context, lease *Lease) (bool, error) {
+	n, err := leaseReleaseScript.Run(ctx, l.redis, []string{keyspace.Lease(lease.Name)}, strconv.FormatUint(lease.Token, 10)).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// --- In-memory ---
+
+type memoryLease struct {
+	token     uint64
+	expiresAt time.Time
+}
+
+type MemoryLeaseLocker struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+	fence  uint64
+	owner  string
+	// Now is the clock; tests move it forward to expire leases.
+	Now func() time.Time
+}
+
+func NewMemoryLeaseLocker(owner string) *MemoryLeaseLocker {
+	return &MemoryLeaseLocker{leases: map[string]memoryLease{}, owner: owner, Now: time.Now}
+}
+
+func (m *MemoryLeaseLocker) Acquire(_ context.Context, name string, ttl time.Duration) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.Now()
+	if cur, ok := m.leases[name]; ok && now.Before(cur.expiresAt) {
+		return nil, ErrLeaseHeld
+	}
+	m.fence++
+	l := memoryLease{token: m.fence, expiresAt: now.Add(ttl)}
+	m.leases[name] = l
+	return &Lease{Name: name, Owner: m.owner, Token: l.token, ExpiresAt: l.expiresAt}, nil
+}
+
+func (m *MemoryLeaseLocker) Check(_ context.Context, lease *Lease) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.leases[lease.Name]
+	return ok && cur.token == lease.Token && m.Now().Before(cur.expiresAt), nil
+}
+
+func (m *MemoryLeaseLocker) Release(_ context.Context, lease *Lease) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.leases[lease.Name]
+	if !ok || cur.token != lease.Token {
+		return false, nil
+	}
+	delete(m.leases, lease.Name)
+	return m.Now().Before(cur.expiresAt), nil
+}
+
+// --- Verdict execution ---
+
+// verdictLease holds the per-ID lease for one verdict execution.
+type verdictLease struct {
+	locker LeaseLocker
+	lease  *Lease
+	lost   bool
+}
+
+// acquireVerdictLease takes "verdict:<id>" for StrikePolicy.VerdictLease.
+// ErrLeaseHeld means someone else is executing; any other error is the
+// backend's. Both are logged. Without a monitor store it returns
+// errTelemetryUnavailable.
+func (l TelegramMonitor) acquireVerdictLease(ctx context.Context, telegramID int64) (*verdictLease, error) {
+	store := l.monitorStore()
+	if store == nil {
+		logger.ZSLogger.Warnw("verdict lease skipped: no monitor store", "telegram_id", telegramID)
+		return nil, errTelemetryUnavailable
+	}
+	locker := store.Leases()
+	name := "verdict:" + strconv.FormatInt(telegramID, 10)
+
+	lease, err := locker.Acquire(ctx, name, CurrentStrikePolicy().VerdictLease.Std())
+	if err == ErrLeaseHeld {
+		leaseMetrics.Add(leaseMetricContended, 1)
+		logger.ZSLogger.Infow("verdict lease contended, another replica is executing", "telegram_id", telegramID)
+		return nil, err
+	}
+	if err != nil {
+		leaseMetrics.Add(leaseMetricErrors, 1)
+		logger.ZSLogger.Errorw("failed to acquire verdict lease", "telegram_id", telegramID, "error", err)
+		return nil, err
+	}
+	leaseMetrics.Add(leaseMetricAcquired, 1)
+	return &verdictLease{locker: locker, lease: lease}, nil
+}
+
+// held is the fencing check: call it right before each side effect. It
+// narrows the window for a stale holder but cannot close it, since the
+// write itself does not carry the token.
+func (v *verdictLease) held(ctx context.Context) bool {
+	ok, err := v.locker.Check(ctx, v.lease)
+	if err != nil {
+		leaseMetrics.Add(leaseMetricErrors, 1)
+		return false
+	}
+	if !ok && !v.lost {
+		v.lost = true
+		leaseMetrics.Add(leaseMetricExpired, 1)
+		logger.ZSLogger.Warnw("verdict lease lost before side effect", "lease", v.lease.Name, "token", v.lease.Token)
+	}
+	return ok
+}
+
+func (v *verdictLease) release(ctx context.Context) {
+	ok, err := v.locker.Release(ctx, v.lease)
+	switch {
+	case err != nil:
+		leaseMetrics.Add(leaseMetricErrors, 1)
+	case !ok && v.lost:
+		// already counted when held() noticed
+	case !ok:
+		leaseMetrics.Add(leaseMetricExpired, 1)
+		logger.ZSLogger.Warnw("verdict lease expired before release", "lease", v.lease.Name, "token", v.lease.Token)
+	default:
+		leaseMetrics.Add(leaseMetricReleased, 1)
+	}
+}
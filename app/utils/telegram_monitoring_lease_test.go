@@ -0,0 +1,158 @@
+// logic/telegram_monitoring_lease_test.go
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const leaseTestTTL = time.Minute
+
+// memoryLeaseClock is a MemoryLeaseLocker on a clock the test moves.
+func memoryLeaseClock() (*MemoryLeaseLocker, func(time.Duration)) {
+	now := time.Now()
+	m := NewMemoryLeaseLocker("shared")
+	m.Now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLeaseContention(t *testing.T) {
+	ctx := context.Background()
+	_, r := newSnapshotRedis(t)
+	mem, _ := memoryLeaseClock()
+	tests := []struct {
+		name string
+		a, b LeaseLocker // two replicas on one backend
+	}{
+		{"redis", NewRedisLeaseLocker(r, "a"), NewRedisLeaseLocker(r, "b")},
+		{"memory", mem, mem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			held, err := tt.a.Acquire(ctx, "verdict:1", leaseTestTTL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tt.b.Acquire(ctx, "verdict:1", leaseTestTTL); err != ErrLeaseHeld {
+				t.Fatalf("second acquire: err = %v, want ErrLeaseHeld", err)
+			}
+			if _, err := tt.b.Acquire(ctx, "verdict:2", leaseTestTTL); err != nil {
+				t.Errorf("another name is contended too: %v", err)
+			}
+			if ok, _ := tt.a.Check(ctx, held); !ok {
+				t.Error("holder lost its lease to a refused acquire")
+			}
+		})
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newSnapshotRedis(t)
+	mem, advanceMem := memoryLeaseClock()
+	tests := []struct {
+		name    string
+		a, b    LeaseLocker
+		advance func(time.Duration)
+	}{
+		{"redis", NewRedisLeaseLocker(r, "a"), NewRedisLeaseLocker(r, "b"), mr.FastForward},
+		{"memory", mem, mem, advanceMem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale, _ := tt.a.Acquire(ctx, "verdict:1", leaseTestTTL)
+			tt.advance(leaseTestTTL + time.Second)
+			if ok, _ := tt.a.Check(ctx, stale); ok {
+				t.Fatal("expired lease still checks out")
+			}
+			fresh, err := tt.b.Acquire(ctx, "verdict:1", leaseTestTTL)
+			if err != nil {
+				t.Fatalf("acquire after expiry: %v", err)
+			}
+			if ok, _ := tt.a.Check(ctx, stale); ok {
+				t.Error("stale holder passes Check after a takeover")
+			}
+			if ok, _ := tt.a.Release(ctx, stale); ok {
+				t.Error("stale holder released the new lease")
+			}
+			if ok, _ := tt.b.Check(ctx, fresh); !ok {
+				t.Error("new holder lost its lease to a stale release")
+			}
+		})
+	}
+}
+
+func TestLeaseRelease(t *testing.T) {
+	ctx := context.Background()
+	_, r := newSnapshotRedis(t)
+	mem, _ := memoryLeaseClock()
+	tests := []struct {
+		name string
+		a, b LeaseLocker
+	}{
+		{"redis", NewRedisLeaseLocker(r, "a"), NewRedisLeaseLocker(r, "b")},
+		{"memory", mem, mem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			held, _ := tt.a.Acquire(ctx, "verdict:1", leaseTestTTL)
+			if ok, err := tt.a.Release(ctx, held); !ok || err != nil {
+				t.Fatalf("release = %v, %v", ok, err)
+			}
+			if ok, _ := tt.a.Release(ctx, held); ok {
+				t.Error("released twice")
+			}
+			if _, err := tt.b.Acquire(ctx, "verdict:1", leaseTestTTL); err != nil {
+				t.Errorf("acquire after release: %v", err)
+			}
+		})
+	}
+}
+
+func TestLeaseTokensOnlyGrow(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newSnapshotRedis(t)
+	mem, advanceMem := memoryLeaseClock()
+	tests := []struct {
+		name    string
+		a, b    LeaseLocker
+		advance func(time.Duration)
+	}{
+		{"redis", NewRedisLeaseLocker(r, "a"), NewRedisLeaseLocker(r, "b"), mr.FastForward},
+		{"memory", mem, mem, advanceMem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Alternate replicas; even rounds release, odd rounds let the lease expire.
+			var last uint64
+			for i := 0; i < 5; i++ {
+				locker := tt.a
+				if i%2 == 1 {
+					locker = tt.b
+				}
+				lease, err := locker.Acquire(ctx, "verdict:1", leaseTestTTL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if lease.Token <= last {
+					t.Fatalf("token %d after %d", lease.Token, last)
+				}
+				last = lease.Token
+				if i%2 == 0 {
+					_, _ = locker.Release(ctx, lease)
+				} else {
+					tt.advance(leaseTestTTL + time.Second)
+				}
+			}
+		})
+	}
+}
+
+func TestVerdictLeaseWithoutStore(t *testing.T) {
+	l := NewTelegramMonitor(TelegramLogic{}, nil, nil)
+	_, err := l.acquireVerdictLease(context.Background(), 1)
+	if e, ok := err.(APIError); !ok || e.Code != errTelemetryUnavailable.Code {
+		t.Fatalf("err = %v, want %v", err, errTelemetryUnavailable)
+	}
+}
@@ -0,0 +1,365 @@
+// logic/telegram_monitoring_openapi.go
+package logic
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- OPENAPI DOCUMENT ---
+//
+// The document is generated, not written: paths and roles come from
+// dashboardRoutes, parameters from the request structs' uri/query tags and
+// schemas from the json tags of the request and response types. The only
+// hand-kept part is dashboardAPIDocs, which says which types a route uses.
+// TestOpenAPIContract fails when a route has no entry there or a handler
+// answers with something its schema does not describe.
+
+// apiDoc is what reflection cannot learn about a route.
+type apiDoc struct {
+	Summary  string
+	Params   interface{} // struct with uri/query tags
+	Body     interface{} // JSON request body
+	Response interface{} // JSON body of the success response
+	Status   int         // success status, 200 if zero
+	// Non-JSON bodies, by content type.
+	RequestContent  string
+	ResponseContent string
+	// Events maps Server-Sent Event names to their data, for streams.
+	Events map[string]interface{}
+}
+
+// paradoxActionParams documents the query string ParadoxAuthMiddleware reads
+// on POST /dashboard.
+type paradoxActionParams struct {
+	Paradox string `query:"paradox"` // "unlock" or "logout"
+}
+
+// tokenIDParams documents the path parameter of RevokeAPIToken, which reads
+// c.Param directly.
+type tokenIDParams struct {
+	ID string `uri:"id"`
+}
+
+var dashboardAPIDocs = map[string]apiDoc{
+	"GET /dashboard":  {Summary: "Dashboard UI", ResponseContent: "text/html"},
+	"POST /dashboard": {Summary: "Unlock with ?paradox=unlock or log out with ?paradox=logout", Params: paradoxActionParams{}, Body: UnlockRequest{}, Response: SessionResponse{}},
+
+	"GET /dashboard/api/me":    {Summary: "Current operator and role", Response: DashboardIdentityResponse{}},
+	"GET /dashboard/api/stats": {Summary: "Counters, graph, feed and quarantine for the dashboard", Params: StatsRequest{}, Response: StatsResponse{}},
+	"GET /dashboard/api/stream": {
+		Summary: "Live feed, counter deltas and quarantine changes as Server-Sent Events; resume with Last-Event-ID",
+		Params:  StreamRequest{}, ResponseContent: "text/event-stream",
+		Events: map[string]interface{}{
+			"ready":      StreamReady{},
+			"feed":       LookupLogEntry{},
+			"counters":   StreamCounters{},
+			"quarantine": QuarantineEvent{},
+			"reset":      ResetEvent{},
+			"resync":     StreamResync{},
+		},
+	},
+	"GET /dashboard/api/inspect":               {Summary: "History and relations of one ID", Params: InspectRequest{}, Response: InspectResponse{}},
+	"GET /dashboard/api/policy":                {Summary: "Active strike policy", Response: StrikePolicy{}},
+	"GET /dashboard/api/shadow":                {Summary: "Shadow-mode verdicts and their outcomes", Response: ShadowVerdictsResponse{}},
+	"POST /dashboard/api/shadow/reconcile":     {Summary: "Confirm pending shadow verdicts the DB has as deleted", Response: ShadowReconcileResponse{}},
+	"GET /dashboard/api/review":                {Summary: "Kills waiting for a human", Response: ReviewQueueResponse{}},
+	"POST /dashboard/api/review/:id/approve":   {Summary: "Approve a pending kill", Params: ReviewDecisionRequest{}, Response: ReviewDecisionResponse{}},
+	"POST /dashboard/api/review/:id/reject":    {Summary: "Reject a pending kill", Params: ReviewDecisionRequest{}, Response: ReviewDecisionResponse{}},
+	"GET /dashboard/api/verdicts":              {Summary: "Kill verdicts, newest first", Params: ListVerdictsRequest{}, Response: VerdictListResponse{}},
+	"POST /dashboard/api/verdicts/:id/restore": {Summary: "Undo a kill verdict", Params: RestoreVerdictRequest{}, Response: VerdictRecord{}},
+	"POST /dashboard/api/policy/reload":        {Summary: "Reload the strike policy and deletion rules", Response: StrikePolicy{}},
+	"GET /dashboard/api/classifier/rules":      {Summary: "Deletion classifier rules", Response: DeletionRulesResponse{}},
+	"GET /dashboard/api/relations/deep":        {Summary: "PII deep scan of one tracked account", Params: DeepDetailsRequest{}, Response: DeepDetailsResponse{}},
+	"POST /dashboard/api/watch":                {Summary: "Start or stop watching an ID", Body: ToggleWatchRequest{}, Response: StatusResponse{}},
+	"POST /dashboard/api/relations/update":     {Summary: "Change a tracker contact's status", Body: RelationStatusRequest{}, Response: RelationStatusResponse{}},
+	"POST /dashboard/api/reset":                {Summary: "Start a background reset; scope all needs a confirmation round trip", Body: ResetRequest{}, Response: ResetJob{}, Status: 202},
+	"GET /dashboard/api/reset/:id":             {Summary: "Progress of a reset job", Params: ResetJobRequest{}, Response: ResetJob{}},
+
+	"POST /dashboard/api/admin/quarantine/migrate": {Summary: "Move quarantine off the legacy hash", Params: MigrateQuarantineRequest{}, Response: QuarantineMigration{}},
+	"GET /dashboard/api/admin/keys/audit":          {Summary: "Compare the keyspace with its schema", Response: KeysAuditResponse{}},
+	"GET /dashboard/api/admin/snapshot":            {Summary: "Download a snapshot of monitor state", ResponseContent: "application/gzip"},
+	"POST /dashboard/api/admin/snapshot/restore":   {Summary: "Restore an uploaded snapshot", Params: RestoreSnapshotRequest{}, RequestContent: "application/gzip", Response: RestoreReport{}},
+
+	"GET /dashboard/api/audit":         {Summary: "Audit log entries, newest first", Params: AuditFilter{}, Response: AuditLogResponse{}},
+	"GET /dashboard/api/audit/verify":  {Summary: "Check the audit hash chain", Response: AuditVerification{}},
+	"GET /dashboard/api/tokens":        {Summary: "API tokens, without secrets", Response: APITokenListResponse{}},
+	"POST /dashboard/api/tokens":       {Summary: "Issue an API token; the secret is shown once", Body: CreateAPITokenRequest{}, Response: CreateAPITokenResponse{}},
+	"DELETE /dashboard/api/tokens/:id": {Summary: "Revoke an API token", Params: tokenIDParams{}, Response: StatusResponse{}},
+
+	"GET /dashboard/api/openapi.json": {Summary: "This document", Response: map[string]interface{}{}},
+}
+
+var (
+	dashboardOpenAPIOnce   sync.Once
+	dashboardOpenAPIDoc    map[string]interface{}
+	dashboardOpenAPIRoutes []dashboardRoute
+)
+
+// dashboardRoutes lists ServeOpenAPI, which reads dashboardRoutes; handing
+// the table over at init breaks the initialization cycle.
+func init() { dashboardOpenAPIRoutes = dashboardRoutes }
+
+// DashboardOpenAPI returns the OpenAPI 3 document for the dashboard API.
+// It is built on first use and shared; callers must not modify it.
+func DashboardOpenAPI() map[string]interface{} {
+	dashboardOpenAPIOnce.Do(func() {
+		dashboardOpenAPIDoc = buildDashboardOpenAPI(dashboardOpenAPIRoutes, dashboardAPIDocs)
+	})
+	return dashboardOpenAPIDoc
+}
+
+// GET /dashboard/api/openapi.json
+func (l TelegramMonitor) ServeOpenAPI(c *gin.Context) {
+	c.JSON(200, DashboardOpenAPI())
+}
+
+func buildDashboardOpenAPI(routes []dashboardRoute, docs map[string]apiDoc) map[string]interface{} {
+	g := &openAPISchemas{components: map[string]interface{}{}}
+	errorResponse := map[string]interface{}{
+		"description": "Error envelope",
+		"content":     jsonContent(g.schemaFor(reflect.TypeOf(APIErrorResponse{}))),
+	}
+
+	paths := map[string]interface{}{}
+	for _, rt := range routes {
+		doc := docs[rt.Method+" "+rt.Path]
+		op := map[string]interface{}{
+			"operationId":     handlerName(rt.Handler),
+			"summary":         doc.Summary,
+			"x-required-role": rt.Role,
+		}
+		if doc.Params != nil {
+			op["parameters"] = g.parameters(reflect.TypeOf(doc.Params))
+		}
+		switch {
+		case doc.Body != nil:
+			op["requestBody"] = map[string]interface{}{"content": jsonContent(g.schemaFor(reflect.TypeOf(doc.Body)))}
+		case doc.RequestContent != "":
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{doc.RequestContent: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}},
+			}
+		}
+
+		status := doc.Status
+		if status == 0 {
+			status = 200
+		}
+		ok := map[string]interface{}{"description": doc.Summary}
+		switch {
+		case doc.Response != nil:
+			ok["content"] = jsonContent(g.schemaFor(reflect.TypeOf(doc.Response)))
+		case doc.ResponseContent != "":
+			ok["content"] = map[string]interface{}{doc.ResponseContent: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}}
+		}
+		if len(doc.Events) > 0 {
+			events := map[string]interface{}{}
+			for name, data := range doc.Events {
+				events[name] = g.schemaFor(reflect.TypeOf(data))
+			}
+			ok["x-events"] = events
+		}
+		op["responses"] = map[string]interface{}{strconv.Itoa(status): ok, "default": errorResponse}
+
+		path := openAPIPath(rt.Path)
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Paradox monitoring dashboard",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": DashboardSessionCookie},
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"session": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+		},
+	}
+}
+
+// openAPIPath turns gin's /tokens/:id into /tokens/{id}.
+func openAPIPath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// handlerName turns the method expression TelegramMonitor.ServeStats into
+// "ServeStats".
+func handlerName(h func(TelegramMonitor, *gin.Context)) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// --- SCHEMAS ---
+
+// openAPISchemas collects named struct types under components/schemas.
+type openAPISchemas struct {
+	components map[string]interface{}
+}
+
+var (
+	typeTelegramID     = reflect.TypeOf(TelegramID(0))
+	typeLooseString    = reflect.TypeOf(looseString(""))
+	typeJSONNumber     = reflect.TypeOf(json.Number(""))
+	typeRawMessage     = reflect.TypeOf(json.RawMessage(nil))
+	typePolicyDuration = reflect.TypeOf(PolicyDuration(0))
+	typeDashboardRole  = reflect.TypeOf(DashboardRole(""))
+)
+
+// schemaFor describes how encoding/json writes t. Types with their own
+// MarshalJSON, or a lenient UnmarshalJSON, are listed explicitly.
+func (g *openAPISchemas) schemaFor(t reflect.Type) map[string]interface{} {
+	switch t {
+	case typeTelegramID:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Requests may also send the ID as a string of digits."}
+	case typeLooseString:
+		return map[string]interface{}{"type": "string"}
+	case typeJSONNumber:
+		return map[string]interface{}{"type": "number"}
+	case typeRawMessage:
+		return map[string]interface{}{}
+	case typePolicyDuration:
+		return map[string]interface{}{"type": "string", "example": "168h"}
+	case typeDashboardRole:
+		return map[string]interface{}{"type": "string", "enum": []string{string(RoleViewer), string(RoleOperator), string(RoleAdmin)}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schemaFor(t.Elem())
+		if _, ok := s["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			g.components[t.Name()] = nil // placeholder for recursive types
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		s := map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+		if t.Kind() == reflect.Slice {
+			s["nullable"] = true
+		}
+		return s
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem()), "nullable": true}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	panic("openapi: no schema for " + t.String())
+}
+
+func (g *openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	g.addFields(t, props, &required)
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields follows encoding/json: unexported and "-" fields are skipped,
+// untagged embedded structs are flattened, omitempty fields are optional.
+func (g *openAPISchemas) addFields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(f.Type, props, required)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// parameters lists t's uri and query fields as OpenAPI parameters.
+func (g *openAPISchemas) parameters(t reflect.Type) []interface{} {
+	var params []interface{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		p := map[string]interface{}{"schema": g.schemaFor(f.Type)}
+		if name := f.Tag.Get("uri"); name != "" {
+			p["name"], p["in"], p["required"] = name, "path", true
+		} else if name := f.Tag.Get("query"); name != "" {
+			p["name"], p["in"] = name, "query"
+		} else {
+			continue
+		}
+		params = append(params, p)
+	}
+	return params
+}
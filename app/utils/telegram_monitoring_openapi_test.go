@@ -0,0 +1,481 @@
+// logic/telegram_monitoring_openapi_test.go
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/domain"
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/service/telemetry"
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	routes := map[string]bool{}
+	for _, rt := range dashboardRoutes {
+		key := rt.Method + " " + rt.Path
+		routes[key] = true
+		if _, ok := dashboardAPIDocs[key]; !ok {
+			t.Errorf("%s has no dashboardAPIDocs entry", key)
+		}
+	}
+	for key := range dashboardAPIDocs {
+		if !routes[key] {
+			t.Errorf("dashboardAPIDocs documents %s, which is not in dashboardRoutes", key)
+		}
+	}
+
+	doc := openAPIDocument(t, DashboardOpenAPI())
+	var refs []string
+	collectRefs(doc, &refs)
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, ref := range refs {
+		if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			t.Errorf("dangling $ref %s", ref)
+		}
+	}
+}
+
+// TestOpenAPIContract drives every route through the real middleware and
+// checks each response against the schema the document gives its status.
+// It fails when a handler's output drifts from the spec, and when a route
+// is never answered with its documented success status.
+func TestOpenAPIContract(t *testing.T) {
+	withStrikePolicy(t, func(p *StrikePolicy) {
+		p.Threshold = 1
+		p.HalfLife = 0
+	})
+	env := newHandlerEnv(t, false) // the Redis store, as in production
+	_, r := newSnapshotRedis(t)
+	env.logic.Telemetry = &telemetry.Service{MonitorRedis: r}
+	env.logic = NewTelegramMonitor(env.logic.TelegramLogic, nil, env.tracked)
+	ctx := context.Background()
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+
+	// State for every list to have at least one item.
+	seedMonitor(t, r)
+	item := `{"id":"a1","t":1700000000,"s":"ERR","tr":"9","tg":42,"ms":12.5,"e":"tdlib error 400: PEER_ID_INVALID"}`
+	if err := r.LPush(ctx, keyspace.LiveFeed, item, `{"t":"1700000001","s":"OK","tg":"43","ms":3}`).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LPush(ctx, keyspace.History(42), item).Err(); err != nil {
+		t.Fatal(err)
+	}
+	env.tracked.identities[42] = &domain.TrackedIdentity{Fullname: strp("Ada"), Username: strp("ada"), OnlineStatus: "ONLINE", ProfilePhotosCount: 1}
+	env.tracked.contacts[42] = []domain.TrackerContact{{ID: 5, TrackerPhoneID: 9, TrackedTelegramID: 42, TrackedPhoneNumber: "+100", Status: "ACTIVE", CreatedAtStamp: 1690000000}}
+
+	deletion := errors.New("PEER_ID_INVALID")
+	env.logic.ProcessDeletionError(span, ctx, 77, deletion) // enforced kill -> verdict
+	withStrikePolicy(t, func(p *StrikePolicy) {
+		p.Threshold = 1
+		p.Mode = StrikeModeShadow
+	})
+	env.logic.ProcessDeletionError(span, ctx, 79, deletion) // shadow verdict
+	withStrikePolicy(t, func(p *StrikePolicy) {
+		p.Threshold = 1
+		p.Review.Enabled = true
+	})
+	env.logic.ProcessDeletionError(span, ctx, 78, deletion) // pending reviews
+	env.logic.ProcessDeletionError(span, ctx, 82, deletion)
+	// Leave the policy behind a file so reload has something to read.
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte(`{"threshold":5}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadStrikePolicyFile(policyFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		activeStrikePolicy.mu.Lock()
+		activeStrikePolicy.path = ""
+		activeStrikePolicy.mu.Unlock()
+	})
+	env.logic.ProcessDeletionError(span, ctx, 80, deletion) // quarantined, below threshold
+
+	hash, err := HashDashboardPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewDashboardAuth(r, DashboardAuthConfig{
+		Operators:      []DashboardOperator{{Username: "ada", PasswordHash: hash, Role: RoleAdmin}},
+		InsecureCookie: true,
+	})
+	auth.UseRateLimitBackend(NewMemoryRateLimitBackend())
+	router := gin.New()
+	if err := env.logic.RegisterDashboardRoutes(router, auth); err != nil {
+		t.Fatal(err)
+	}
+	// The stream only ends when the client leaves: leave after a heartbeat.
+	prevStream := CurrentStreamConfig()
+	streamCfg := prevStream
+	streamCfg.Heartbeat = 20 * time.Millisecond
+	SetStreamConfig(streamCfg)
+	t.Cleanup(func() { SetStreamConfig(prevStream) })
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/dashboard/api/stream" {
+			ctx, cancel := context.WithTimeout(req.Context(), 100*time.Millisecond)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+		router.ServeHTTP(w, req)
+	})
+	if err := PublishLookupEvent(ctx, r, []byte(item), true); err != nil {
+		t.Fatal(err)
+	}
+
+	admin, _, err := auth.CreateAPIToken(ctx, "contract", RoleAdmin, time.Hour, nil, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, spare, err := auth.CreateAPIToken(ctx, "spare", RoleViewer, time.Hour, nil, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logoutCookie, logoutSession, err := auth.Login(ctx, "ada", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bearer := []string{"Authorization", "Bearer " + admin}
+	spec := openAPIDocument(t, decodeBody(t, serve(router, "GET", "/dashboard/api/openapi.json", "", bearer...)))
+	check := schemaChecker{schemas: spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})}
+	covered := map[string]bool{}
+
+	// call serves one request, checks the response against the spec and
+	// returns the body.
+	call := func(route, path, body string, wantCode int, headers ...string) []byte {
+		t.Helper()
+		method := route[:strings.IndexByte(route, ' ')]
+		if headers == nil {
+			headers = bearer
+		}
+		w := serve(handler, method, path, body, headers...)
+		if w.Code != wantCode {
+			t.Fatalf("%s %s: status %d, want %d: %s", method, path, w.Code, wantCode, w.Body.String())
+		}
+		op, _ := openAPIPathItem(spec, route)[strings.ToLower(method)].(map[string]interface{})
+		if op == nil {
+			t.Fatalf("%s is not in the document", route)
+		}
+		responses := op["responses"].(map[string]interface{})
+		resp, documented := responses[strconv.Itoa(w.Code)].(map[string]interface{})
+		if documented {
+			covered[route] = true
+		} else {
+			resp = responses["default"].(map[string]interface{})
+		}
+
+		content, _ := resp["content"].(map[string]interface{})
+		media, isJSON := content["application/json"].(map[string]interface{})
+		if !isJSON {
+			for ct := range content {
+				if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, ct) {
+					t.Errorf("%s %s: Content-Type %q, documented %q", method, path, got, ct)
+				}
+			}
+			if events, ok := resp["x-events"].(map[string]interface{}); ok {
+				for _, problem := range check.checkEvents(events, w.Body.String()) {
+					t.Errorf("%s %s: %s", method, path, problem)
+				}
+			}
+			return w.Body.Bytes()
+		}
+		dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("%s %s: response is not JSON: %s", method, path, w.Body.String())
+		}
+		for _, problem := range check.check(media["schema"].(map[string]interface{}), v, "body") {
+			t.Errorf("%s %s (%d): %s", method, path, w.Code, problem)
+		}
+		return w.Body.Bytes()
+	}
+	id := func(body []byte, field string) string {
+		var m map[string]interface{}
+		_ = json.Unmarshal(body, &m)
+		return fmt.Sprint(m[field])
+	}
+	preCSRF := []string{"Cookie", DashboardCSRFCookie + "=pre", DashboardCSRFHeader, "pre"}
+
+	call("GET /dashboard", "/dashboard", "", 200)
+	call("POST /dashboard", "/dashboard?paradox=unlock", `{"username":"ada","password":"nope"}`, 401, preCSRF...)
+	call("POST /dashboard", "/dashboard?paradox=unlock", `{"username":"ada","password":"pw"}`, 200, preCSRF...)
+	call("POST /dashboard", "/dashboard?paradox=logout", "", 200,
+		"Cookie", DashboardSessionCookie+"="+logoutCookie, DashboardCSRFHeader, logoutSession.CSRFToken)
+	call("GET /dashboard/api/me", "/dashboard/api/me", "", 200)
+	call("GET /dashboard/api/openapi.json", "/dashboard/api/openapi.json", "", 200)
+	call("GET /dashboard/api/stats", "/dashboard/api/stats", "", 200)
+	call("GET /dashboard/api/stream", "/dashboard/api/stream", "", 200)
+	call("GET /dashboard/api/stream", "/dashboard/api/stream?last_event_id=0-0", "", 200)
+	call("GET /dashboard/api/stream", "/dashboard/api/stream", "", 400, append([]string{"Last-Event-ID", "nope"}, bearer...)...)
+	call("GET /dashboard/api/stats", "/dashboard/api/stats?class=PEER_ID_INVALID&top=3", "", 200)
+	call("GET /dashboard/api/stats", "/dashboard/api/stats?top=-1", "", 400)
+	call("GET /dashboard/api/inspect", "/dashboard/api/inspect?id=42", "", 200)
+	call("GET /dashboard/api/inspect", "/dashboard/api/inspect", "", 400)
+	call("GET /dashboard/api/policy", "/dashboard/api/policy", "", 200)
+	call("GET /dashboard/api/shadow", "/dashboard/api/shadow", "", 200)
+	call("POST /dashboard/api/shadow/reconcile", "/dashboard/api/shadow/reconcile", "", 200)
+	call("GET /dashboard/api/review", "/dashboard/api/review", "", 200)
+	call("POST /dashboard/api/review/:id/approve", "/dashboard/api/review/78/approve", "", 200)
+	call("POST /dashboard/api/review/:id/reject", "/dashboard/api/review/82/reject", "", 200)
+	call("POST /dashboard/api/review/:id/reject", "/dashboard/api/review/78/reject", "", 404)
+	verdicts := call("GET /dashboard/api/verdicts", "/dashboard/api/verdicts?telegram_id=77&limit=5", "", 200)
+	var list VerdictListResponse
+	if err := json.Unmarshal(verdicts, &list); err != nil || len(list.Verdicts) != 1 {
+		t.Fatalf("verdicts for 77: %s", verdicts)
+	}
+	call("GET /dashboard/api/verdicts", "/dashboard/api/verdicts", "", 200)
+	call("POST /dashboard/api/verdicts/:id/restore", "/dashboard/api/verdicts/"+list.Verdicts[0].ID+"/restore", "", 200)
+	call("POST /dashboard/api/verdicts/:id/restore", "/dashboard/api/verdicts/"+list.Verdicts[0].ID+"/restore", "", 409)
+	call("POST /dashboard/api/verdicts/:id/restore", "/dashboard/api/verdicts/nope/restore", "", 404)
+	call("POST /dashboard/api/policy/reload", "/dashboard/api/policy/reload", "", 200)
+	call("GET /dashboard/api/classifier/rules", "/dashboard/api/classifier/rules", "", 200)
+	call("GET /dashboard/api/relations/deep", "/dashboard/api/relations/deep?id=42", "", 200)
+	call("POST /dashboard/api/watch", "/dashboard/api/watch", `{"id":"42","action":true}`, 200)
+	call("POST /dashboard/api/watch", "/dashboard/api/watch", `{"id":4.2}`, 400)
+	call("POST /dashboard/api/relations/update", "/dashboard/api/relations/update", `{"id":5,"status":"INACTIVE","tracked_telegram_id":42}`, 200)
+	call("POST /dashboard/api/admin/quarantine/migrate", "/dashboard/api/admin/quarantine/migrate?dry_run=true", "", 200)
+	call("GET /dashboard/api/admin/keys/audit", "/dashboard/api/admin/keys/audit", "", 200)
+	snapshot := call("GET /dashboard/api/admin/snapshot", "/dashboard/api/admin/snapshot", "", 200)
+	call("POST /dashboard/api/admin/snapshot/restore", "/dashboard/api/admin/snapshot/restore", string(snapshot), 200)
+	call("POST /dashboard/api/admin/snapshot/restore", "/dashboard/api/admin/snapshot/restore", "not gzip", 400)
+	call("GET /dashboard/api/audit", "/dashboard/api/audit?actor=ada&limit=10", "", 200)
+	call("GET /dashboard/api/audit", "/dashboard/api/audit", "", 200)
+	call("GET /dashboard/api/audit/verify", "/dashboard/api/audit/verify", "", 200)
+	call("GET /dashboard/api/tokens", "/dashboard/api/tokens", "", 200)
+	call("POST /dashboard/api/tokens", "/dashboard/api/tokens", `{"name":"ci","role":"viewer","ttl_hours":1,"allowed_ips":["10.0.0.0/8"]}`, 200)
+	call("POST /dashboard/api/tokens", "/dashboard/api/tokens", `{"name":"ci","role":"root"}`, 400)
+	call("DELETE /dashboard/api/tokens/:id", "/dashboard/api/tokens/"+spare.ID, "", 200)
+	call("POST /dashboard/api/reset", "/dashboard/api/reset", `{"scope":"all"}`, 428)
+	job := call("POST /dashboard/api/reset", "/dashboard/api/reset", `{"scope":"feed"}`, 202)
+	call("GET /dashboard/api/reset/:id", "/dashboard/api/reset/"+id(job, "id"), "", 200)
+	call("GET /dashboard/api/reset/:id", "/dashboard/api/reset/nope", "", 404)
+	call("GET /dashboard/api/me", "/dashboard/api/me", "", 401, "Authorization", "Bearer nope")
+
+	for _, rt := range dashboardRoutes {
+		if key := rt.Method + " " + rt.Path; !covered[key] {
+			t.Errorf("%s was never answered with a documented success status", key)
+		}
+	}
+}
+
+// openAPIDocument round-trips doc through JSON so it has the shape a client
+// sees.
+func openAPIDocument(t *testing.T, doc map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("document does not marshal: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func openAPIPathItem(spec map[string]interface{}, route string) map[string]interface{} {
+	path := route[strings.IndexByte(route, ' ')+1:]
+	item, _ := spec["paths"].(map[string]interface{})[openAPIPath(path)].(map[string]interface{})
+	return item
+}
+
+func collectRefs(v interface{}, refs *[]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if ref, ok := child.(string); ok && k == "$ref" {
+				*refs = append(*refs, ref)
+			}
+			collectRefs(child, refs)
+		}
+	case []interface{}:
+		for _, child := range v {
+			collectRefs(child, refs)
+		}
+	}
+}
+
+// schemaChecker validates decoded JSON against the subset of OpenAPI 3.0
+// schema the generator emits.
+type schemaChecker struct {
+	schemas map[string]interface{}
+}
+
+func (c schemaChecker) check(schema map[string]interface{}, v interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return c.check(c.schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{}), v, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		var problems []string
+		for _, s := range all {
+			problems = append(problems, c.check(s.(map[string]interface{}), v, at)...)
+		}
+		return problems
+	}
+
+	var problems []string
+	wrong := func(want string) []string { return []string{fmt.Sprintf("%s: want %s, got %T", at, want, v)} }
+	switch schema["type"] {
+	case nil:
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return wrong("object")
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := m[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %q", at, name))
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]interface{}); ok {
+				problems = append(problems, c.check(ps, m[k], at+"."+k)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					problems = append(problems, fmt.Sprintf("%s: undocumented property %q", at, k))
+				}
+			case map[string]interface{}:
+				problems = append(problems, c.check(extra, m[k], at+"."+k)...)
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return wrong("array")
+		}
+		for i, item := range items {
+			problems = append(problems, c.check(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return wrong("string")
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok {
+			found := false
+			for _, e := range enum {
+				found = found || e == s
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s: %q is not one of %v", at, s, enum))
+			}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return wrong("integer")
+		}
+		if _, err := n.Int64(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s is not an integer", at, n))
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return wrong("number")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return wrong("boolean")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unknown schema type %v", at, schema["type"]))
+	}
+	return problems
+}
+
+// checkEvents validates every event in an SSE body against the schema for
+// its name.
+func (c schemaChecker) checkEvents(schemas map[string]interface{}, body string) []string {
+	var problems []string
+	for _, block := range strings.Split(body, "\n\n") {
+		var name, data string
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		if name == "" {
+			continue // comment or id-only block
+		}
+		schema, ok := schemas[name].(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("undocumented event %q", name))
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(data))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			problems = append(problems, fmt.Sprintf("event %s: data is not JSON: %s", name, data))
+			continue
+		}
+		problems = append(problems, c.check(schema, v, "event "+name)...)
+	}
+	return problems
+}
+
+// The checker itself must reject drift, or the contract test proves nothing.
+func TestSchemaCheckerRejectsDrift(t *testing.T) {
+	g := &openAPISchemas{components: map[string]interface{}{}}
+	schema := g.schemaFor(reflect.TypeOf(StatusResponse{}))
+	spec := openAPIDocument(t, map[string]interface{}{"schema": schema, "components": g.components})
+	check := schemaChecker{schemas: spec["components"].(map[string]interface{})}
+	s := spec["schema"].(map[string]interface{})
+
+	tests := []struct {
+		body string
+		ok   bool
+	}{
+		{`{"status":"ok"}`, true},
+		{`{}`, false},
+		{`{"status":1}`, false},
+		{`{"status":"ok","extra":true}`, false},
+		{`null`, false},
+	}
+	for _, tt := range tests {
+		dec := json.NewDecoder(strings.NewReader(tt.body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if problems := check.check(s, v, "body"); (len(problems) == 0) != tt.ok {
+			t.Errorf("%s: problems %v, want ok=%v", tt.body, problems, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// logic/telegram_monitoring_policy.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// --- STRIKE POLICY ---
+//
+// Everything the kill switch used to hard-code: how many (weighted) strikes
+// condemn an account, how long strikes are remembered, how long the evidence
+// must span, and how much each error class counts. Loaded from a JSON file
+// and reloadable at runtime without a deploy.
+
+// PolicyDuration is a time.Duration that reads and writes as "168h".
+type PolicyDuration time.Duration
+
+func (d PolicyDuration) Std() time.Duration { return time.Duration(d) }
+
+func (d PolicyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *PolicyDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"168h\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = PolicyDuration(v)
+	return nil
+}
+
+type StrikePolicy struct {
+	// Threshold is the weighted strike total that fires the kill switch.
+	Threshold float64 `json:"threshold"`
+	// TTL is how long a strike counter survives without a new strike.
+	TTL PolicyDuration `json:"ttl"`
+	// MinSpan, if set, holds the kill switch until the first and latest
+	// strike are at least this far apart, so one burst cannot condemn anyone.
+	MinSpan PolicyDuration `json:"min_span"`
+	// Weights per classifier rule ID, overriding the rule's own weight.
+	// Rules without a weight of their own count DefaultWeight.
+	Weights       map[string]float64 `json:"weights"`
+	DefaultWeight float64            `json:"default_weight"`
+	// HalfLife is how long it takes a strike score to lose half its value.
+	// Zero disables decay.
+	HalfLife PolicyDuration `json:"half_life"`
+	// HealWeight is subtracted from the score on every successful lookup.
+	HealWeight float64 `json:"heal_weight"`
+	// MaxSignals caps the raw signal history kept per ID.
+	MaxSignals int `json:"max_signals"`
+	// Mode is "enforce" (kill for real) or "shadow" (only log would-kills).
+	Mode string `json:"mode"`
+	// Review, if enabled, holds enforced kills for an operator's approval.
+	Review ReviewPolicy `json:"review"`
+	// VerdictLease is how long one replica may hold an ID while executing a
+	// kill or restore. It must cover the DB writes with room to spare.
+	VerdictLease PolicyDuration `json:"verdict_lease"`
+}
+
+func DefaultStrikePolicy() StrikePolicy {
+	return StrikePolicy{
+		Threshold:     10,
+		TTL:           PolicyDuration(7 * 24 * time.Hour),
+		Weights:       map[string]float64{},
+		DefaultWeight: 1,
+		HalfLife:      PolicyDuration(48 * time.Hour),
+		HealWeight:    3,
+		MaxSignals:    50,
+		Mode:          StrikeModeEnforce,
+		VerdictLease:  PolicyDuration(30 * time.Second),
+	}
+}
+
+func (p StrikePolicy) Validate() error {
+	if p.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	if p.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+	if p.MinSpan < 0 || p.MinSpan.Std() >= p.TTL.Std() {
+		return fmt.Errorf("min_span must be between 0 and ttl")
+	}
+	if p.DefaultWeight < 0 {
+		return fmt.Errorf("default_weight must not be negative")
+	}
+	if p.HalfLife < 0 {
+		return fmt.Errorf("half_life must not be negative")
+	}
+	if p.HealWeight < 0 {
+		return fmt.Errorf("heal_weight must not be negative")
+	}
+	if p.MaxSignals <= 0 {
+		return fmt.Errorf("max_signals must be positive")
+	}
+	if p.Mode != StrikeModeEnforce && p.Mode != StrikeModeShadow {
+		return fmt.Errorf("mode must be %q or %q", StrikeModeEnforce, StrikeModeShadow)
+	}
+	if p.VerdictLease <= 0 {
+		return fmt.Errorf("verdict_lease must be positive")
+	}
+	if p.Review.AutoApproveAfter < 0 {
+		return fmt.Errorf("review.auto_approve_after must not be negative")
+	}
+	for class, w := range p.Weights {
+		if w < 0 {
+			return fmt.Errorf("weight for %q must not be negative", class)
+		}
+	}
+	return nil
+}
+
+// WeightFor returns how many strikes one signal matched by the given rule is worth.
+func (p StrikePolicy) WeightFor(match DeletionClassification) float64 {
+	if w, ok := p.Weights[match.RuleID]; ok {
+		return w
+	}
+	if match.Weight > 0 {
+		return match.Weight
+	}
+	return p.DefaultWeight
+}
+
+// strikePolicyHolder keeps the live policy and where it came from.
+type strikePolicyHolder struct {
+	mu     sync.RWMutex
+	policy StrikePolicy
+	path   string
+}
+
+var activeStrikePolicy = &strikePolicyHolder{policy: DefaultStrikePolicy()}
+
+// CurrentStrikePolicy returns the policy in force right now.
+func CurrentStrikePolicy() StrikePolicy {
+	activeStrikePolicy.mu.RLock()
+	defer activeStrikePolicy.mu.RUnlock()
+	return activeStrikePolicy.policy
+}
+
+// SetStrikePolicy replaces the policy in force after validating it.
+func SetStrikePolicy(p StrikePolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.Weights == nil {
+		p.Weights = map[string]float64{}
+	}
+	activeStrikePolicy.mu.Lock()
+	activeStrikePolicy.policy = p
+	activeStrikePolicy.mu.Unlock()
+	return nil
+}
+
+// LoadStrikePolicyFile reads a JSON policy and remembers the path so
+// ReloadStrikePolicy can pick up later edits. Fields missing from the file
+// keep their defaults.
+func LoadStrikePolicyFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	p := DefaultStrikePolicy()
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("strike policy %s: %w", path, err)
+	}
+	if err := SetStrikePolicy(p); err != nil {
+		return fmt.Errorf("strike policy %s: %w", path, err)
+	}
+
+	activeStrikePolicy.mu.Lock()
+	activeStrikePolicy.path = path
+	activeStrikePolicy.mu.Unlock()
+
+	logger.ZSLogger.Infow("strike policy loaded", "path", path, "threshold", p.Threshold, "ttl", p.TTL.Std().String(), "mode", p.Mode)
+	return nil
+}
+
+// ReloadStrikePolicy re-reads the file given to LoadStrikePolicyFile.
+// On error the previous policy stays in force.
+func ReloadStrikePolicy() error {
+	activeStrikePolicy.mu.RLock()
+	path := activeStrikePolicy.path
+	activeStrikePolicy.mu.RUnlock()
+
+	if path == "" {
+		return fmt.Errorf("no strike policy file configured")
+	}
+	return LoadStrikePolicyFile(path)
+}
+
+// WatchStrikePolicySignals reloads the policy and deletion rules files on
+// SIGHUP until ctx ends.
+func WatchStrikePolicySignals(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				if err := ReloadStrikePolicy(); err != nil {
+					logger.ZSLogger.Errorw("strike policy reload failed", "error", err)
+				}
+				if err := ReloadDeletionRules(); err != nil {
+					logger.ZSLogger.Errorw("deletion rules reload failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// --- HTTP HANDLERS ---
+
+// GET /dashboard/api/policy
+func (l TelegramMonitor) ServeStrikePolicy(c *gin.Context) {
+	c.JSON(200, CurrentStrikePolicy())
+}
+
+// POST /dashboard/api/policy/reload
+func (l TelegramMonitor) ServeStrikePolicyReload(c *gin.Context) {
+	before := CurrentStrikePolicy()
+	if err := ReloadStrikePolicy(); err != nil {
+		logger.ZSLogger.Errorw("strike policy reload failed", "error", err)
+		abortWithError(c, newAPIError(422, "invalid_policy", "%s", err))
+		return
+	}
+	if err := ReloadDeletionRules(); err != nil {
+		logger.ZSLogger.Errorw("deletion rules reload failed", "error", err)
+		abortWithError(c, newAPIError(422, "invalid_rules", "%s", err))
+		return
+	}
+
+	after := CurrentStrikePolicy()
+	l.auditRequest(c, AuditActionPolicyReload, "strike_policy", before, after)
+	c.JSON(200, after)
+}
@@ -0,0 +1,300 @@
+// logic/telegram_monitoring_quarantine.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- QUARANTINE ---
+//
+// An ID enters quarantine on its first deletion strike and leaves it when
+// it heals, is killed, or an operator rejects the pending verdict.
+//
+//   keyspace.Quarantine       ZSET id -> unix seconds it entered
+//   keyspace.QuarantineMeta   HASH id -> QuarantineMeta JSON
+//
+// Older deployments wrote the key as a plain SET, and some wrote both shapes,
+// so every write hit WRONGTYPE on one path or another. Reads below accept
+// either shape; writes keep whatever shape the key already has until
+// MigrateQuarantine converts it.
+
+const AuditActionQuarantineMigrate = "quarantine.migrate"
+
+// QuarantineMeta is what we know about why an ID is in quarantine.
+type QuarantineMeta struct {
+	EnteredAt int64           `json:"entered_at"` // unix seconds
+	Rule      string          `json:"rule,omitempty"`
+	Verdict   DeletionVerdict `json:"verdict,omitempty"`
+}
+
+type QuarantineEntry struct {
+	TelegramID int64
+	EnteredAt  int64 // 0 if a legacy SET member has no meta
+	Meta       *QuarantineMeta
+}
+
+func quarantineKeyType(ctx context.Context, r redis.Cmdable) (string, error) {
+	return r.Type(ctx, keyspace.Quarantine).Result()
+}
+
+// readQuarantine lists everyone in quarantine, newest first, whatever shape
+// the key is in.
+func readQuarantine(ctx context.Context, r redis.Cmdable) ([]QuarantineEntry, error) {
+	kind, err := quarantineKeyType(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []QuarantineEntry
+	switch kind {
+	case "none":
+		return []QuarantineEntry{}, nil
+	case "zset":
+		zs, err := r.ZRevRangeWithScores(ctx, keyspace.Quarantine, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range zs {
+			id, err := strconv.ParseInt(fmt.Sprint(z.Member), 10, 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, QuarantineEntry{TelegramID: id, EnteredAt: int64(z.Score)})
+		}
+	case "set":
+		members, err := r.SMembers(ctx, keyspace.Quarantine).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			id, err := strconv.ParseInt(m, 10, 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, QuarantineEntry{TelegramID: id})
+		}
+	default:
+		return nil, fmt.Errorf("%s: unexpected key type %q", keyspace.Quarantine, kind)
+	}
+
+	meta, err := r.HGetAll(ctx, keyspace.QuarantineMeta).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		raw, ok := meta[strconv.FormatInt(entries[i].TelegramID, 10)]
+		if !ok {
+			continue
+		}
+		var m QuarantineMeta
+		if json.Unmarshal([]byte(raw), &m) != nil {
+			continue
+		}
+		entries[i].Meta = &m
+		if entries[i].EnteredAt == 0 {
+			entries[i].EnteredAt = m.EnteredAt
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].EnteredAt > entries[j].EnteredAt })
+	return entries, nil
+}
+
+// isQuarantined checks membership in either shape.
+func isQuarantined(ctx context.Context, r redis.Cmdable, telegramID int64) (bool, error) {
+	kind, err := quarantineKeyType(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	id := strconv.FormatInt(telegramID, 10)
+	switch kind {
+	case "zset":
+		err := r.ZScore(ctx, keyspace.Quarantine, id).Err()
+		if err == redis.Nil {
+			return false, nil
+		}
+		return err == nil, err
+	case "set":
+		return r.SIsMember(ctx, keyspace.Quarantine, id).Result()
+	}
+	return false, nil
+}
+
+// dequarantineScript drops an ID from quarantine in either shape, together
+// with its meta and any further keys passed (strikes, signals), atomically.
+//
+//	KEYS: quarantine, meta, extra keys to delete...
+//	ARGV: id
+var dequarantineScript = redis.NewScript(`
+local qtype = redis.call('TYPE', KEYS[1]).ok
+if qtype == 'zset' then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+elseif qtype == 'set' then
+	redis.call('SREM', KEYS[1], ARGV[1])
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+for i = 3, #KEYS do
+	redis.call('DEL', KEYS[i])
+end
+return 1
+`)
+
+func dequarantine(ctx context.Context, r redis.Cmdable, telegramID int64, alsoDelete ...string) error {
+	keys := append([]string{keyspace.Quarantine, keyspace.QuarantineMeta}, alsoDelete...)
+	return dequarantineScript.Run(ctx, r, keys, strconv.FormatInt(telegramID, 10)).Err()
+}
+
+// --- Migration ---
+
+// QuarantineMigration reports what MigrateQuarantine did (or would do).
+type QuarantineMigration struct {
+	From     string `json:"from"` // key type before: none, set, zset
+	Members  int    `json:"members"`
+	Migrated bool   `json:"migrated"`
+	DryRun   bool   `json:"dry_run"`
+	// Backfilled counts members whose entry time had to be guessed from
+	// their oldest strike signal (or now) because no meta existed.
+	Backfilled int `json:"backfilled"`
+}
+
+// migrateQuarantineScript rewrites the SET as a ZSET in one step. Members
+// added to the SET after the caller read it get now_s.
+//
+//	KEYS: quarantine, meta, scratch
+//	ARGV: now_s, then id/entered_at pairs
+var migrateQuarantineScript = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok ~= 'set' then
+	return 0
+end
+local now_s = tonumber(ARGV[1])
+local given = {}
+for i = 2, #ARGV, 2 do
+	given[ARGV[i]] = tonumber(ARGV[i + 1])
+end
+redis.call('DEL', KEYS[3])
+for _, id in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	local at = given[id] or now_s
+	redis.call('ZADD', KEYS[3], at, id)
+	redis.call('HSETNX', KEYS[2], id, cjson.encode({entered_at = at}))
+end
+redis.call('DEL', KEYS[1])
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('RENAME', KEYS[3], KEYS[1])
+end
+return 1
+`)
+
+// MigrateQuarantine converts a legacy SET quarantine key to the ZSET + meta
+// model. It is safe to run more than once and while the service is live;
+// a key that is already a ZSET (or absent) is left alone. Entry times come
+// from existing meta, then the member's oldest strike signal, then now.
+// Either way it records keyspace.SchemaVersion when it is done.
+//
+// Run it once per environment, from the admin endpoint or a one-off binary:
+//
+//	report, err := logic.MigrateQuarantine(ctx, monitorRedis, false)
+func MigrateQuarantine(ctx context.Context, r redis.Cmdable, dryRun bool) (QuarantineMigration, error) {
+	report := QuarantineMigration{DryRun: dryRun}
+	kind, err := quarantineKeyType(ctx, r)
+	if err != nil {
+		return report, err
+	}
+	report.From = kind
+	if kind != "set" {
+		if kind == "zset" {
+			report.Members = int(r.ZCard(ctx, keyspace.Quarantine).Val())
+		}
+		if !dryRun {
+			err = keyspace.MarkVersion(ctx, r, keyspace.SchemaVersion)
+		}
+		return report, err
+	}
+
+	entries, err := readQuarantine(ctx, r)
+	if err != nil {
+		return report, err
+	}
+	report.Members = len(entries)
+
+	now := time.Now().Unix()
+	args := []interface{}{now}
+	for _, e := range entries {
+		at := e.EnteredAt
+		if at == 0 {
+			at = oldestSignalAt(ctx, r, e.TelegramID)
+			report.Backfilled++
+		}
+		if at == 0 {
+			at = now
+		}
+		args = append(args, strconv.FormatInt(e.TelegramID, 10), at)
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	keys := []string{keyspace.Quarantine, keyspace.QuarantineMeta, keyspace.Quarantine + ":migrating"}
+	done, err := migrateQuarantineScript.Run(ctx, r, keys, args...).Int()
+	if err != nil {
+		return report, err
+	}
+	report.Migrated = done == 1
+	if err := keyspace.MarkVersion(ctx, r, keyspace.SchemaVersion); err != nil {
+		return report, err
+	}
+	logger.ZSLogger.Infow("quarantine migrated to zset", "members", report.Members, "backfilled", report.Backfilled)
+	return report, nil
+}
+
+// oldestSignalAt is the timestamp of the oldest strike signal still kept
+// for telegramID, 0 if none.
+func oldestSignalAt(ctx context.Context, r redis.Cmdable, telegramID int64) int64 {
+	raw, err := r.LIndex(ctx, keyspace.Signals(telegramID), -1).Result()
+	if err != nil {
+		return 0
+	}
+	var s StrikeSignal
+	if json.Unmarshal([]byte(raw), &s) != nil {
+		return 0
+	}
+	return s.At
+}
+
+// --- HTTP HANDLERS ---
+
+// MigrateQuarantineRequest is POST /dashboard/api/admin/quarantine/migrate.
+type MigrateQuarantineRequest struct {
+	DryRun bool `query:"dry_run"`
+}
+
+// POST /dashboard/api/admin/quarantine/migrate?dry_run=1
+func (l TelegramMonitor) MigrateQuarantineKeyspace(c *gin.Context) {
+	var req MigrateQuarantineRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+
+	report, err := MigrateQuarantine(c.Request.Context(), l.Telemetry.MonitorRedis, req.DryRun)
+	if err != nil {
+		logger.ZSLogger.Errorw("quarantine migration failed", "error", err)
+		abortWithError(c, newAPIError(500, "migration_failed", "%s", err))
+		return
+	}
+	if report.Migrated {
+		l.auditRequest(c, AuditActionQuarantineMigrate, keyspace.Quarantine, gin.H{"type": report.From}, report)
+	}
+	c.JSON(200, report)
+}
@@ -0,0 +1,413 @@
+// logic/telegram_monitoring_ratelimit.go
+package logic
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- RATE LIMITING & UNLOCK LOCKOUT ---
+//
+// Token buckets keyed by client IP and by session, with limits per route.
+// Failed unlocks additionally earn an exponential lockout per IP.
+// The state lives behind RateLimitBackend: Redis in production so every
+// replica shares the same buckets, memory for tests.
+
+const (
+	// RateLimitUnlockRoute is the RateLimitConfig.Routes key for ?paradox=unlock.
+	RateLimitUnlockRoute = "unlock"
+)
+
+// RateLimit is a token bucket: Rate tokens per second, at most Burst saved up.
+type RateLimit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+type LockoutPolicy struct {
+	FreeAttempts int           `json:"free_attempts" yaml:"free_attempts"` // failures before lockout kicks in
+	Base         time.Duration `json:"base" yaml:"base"`                   // first lockout, doubled per further failure
+	Max          time.Duration `json:"max" yaml:"max"`
+	Window       time.Duration `json:"window" yaml:"window"` // failures are forgotten after this
+}
+
+// RateLimitConfig is merged over DefaultRateLimitConfig field by field: a
+// zero rate, burst or lockout setting takes the default rather than
+// switching the limit off, and routes not listed keep their default limits.
+type RateLimitConfig struct {
+	// Routes is keyed by "METHOD /full/path" as registered, or RateLimitUnlockRoute.
+	Routes  map[string]RateLimit `json:"routes" yaml:"routes"`
+	Default RateLimit            `json:"default" yaml:"default"`
+	Unlock  LockoutPolicy        `json:"unlock_lockout" yaml:"unlock_lockout"`
+}
+
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Routes: map[string]RateLimit{
+			RateLimitUnlockRoute: {Rate: 5.0 / 60, Burst: 5},
+			// The UI polls every 2s; anything much faster is a script gone wrong.
+			"GET /dashboard/api/stats":  {Rate: 1, Burst: 5},
+			"POST /dashboard/api/reset": {Rate: 1.0 / 60, Burst: 2},
+		},
+		Default: RateLimit{Rate: 5, Burst: 20},
+		Unlock: LockoutPolicy{
+			FreeAttempts: 3,
+			Base:         30 * time.Second,
+			Max:          time.Hour,
+			Window:       24 * time.Hour,
+		},
+	}
+}
+
+// withDefaults fills what c leaves zero from DefaultRateLimitConfig. A route
+// without a default of its own fills from Default.
+func (c RateLimitConfig) withDefaults() RateLimitConfig {
+	def := DefaultRateLimitConfig()
+	out := RateLimitConfig{
+		Routes:  make(map[string]RateLimit, len(def.Routes)+len(c.Routes)),
+		Default: c.Default.or(def.Default),
+		Unlock:  c.Unlock.or(def.Unlock),
+	}
+	for route, lim := range def.Routes {
+		out.Routes[route] = lim
+	}
+	for route, lim := range c.Routes {
+		base, ok := def.Routes[route]
+		if !ok {
+			base = out.Default
+		}
+		out.Routes[route] = lim.or(base)
+	}
+	return out
+}
+
+func (l RateLimit) or(def RateLimit) RateLimit {
+	if l.Rate <= 0 {
+		l.Rate = def.Rate
+	}
+	if l.Burst <= 0 {
+		l.Burst = def.Burst
+	}
+	return l
+}
+
+func (p LockoutPolicy) or(def LockoutPolicy) LockoutPolicy {
+	if p.FreeAttempts <= 0 {
+		p.FreeAttempts = def.FreeAttempts
+	}
+	if p.Base <= 0 {
+		p.Base = def.Base
+	}
+	if p.Max <= 0 {
+		p.Max = def.Max
+	}
+	if p.Window <= 0 {
+		p.Window = def.Window
+	}
+	return p
+}
+
+// RateLimitBackend stores bucket and lockout state.
+type RateLimitBackend interface {
+	// Take spends one token from the bucket at key. When the bucket is empty
+	// it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error)
+	// RecordFailure counts a failure at key and returns the new total.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Lock blocks key for d. LockedFor returns the remaining lock, or 0.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets failures and any lock at key.
+	Reset(ctx context.Context, key string) error
+}
+
+type DashboardRateLimiter struct {
+	backend RateLimitBackend
+	cfg     RateLimitConfig
+}
+
+func NewDashboardRateLimiter(backend RateLimitBackend, cfg RateLimitConfig) *DashboardRateLimiter {
+	return &DashboardRateLimiter{backend: backend, cfg: cfg.withDefaults()}
+}
+
+func (rl *DashboardRateLimiter) limitFor(route string) RateLimit {
+	if lim, ok := rl.cfg.Routes[route]; ok {
+		return lim
+	}
+	return rl.cfg.Default
+}
+
+// allow checks every key against the route's bucket; all must have a token.
+func (rl *DashboardRateLimiter) allow(ctx context.Context, route string, keys ...string) (bool, time.Duration) {
+	lim := rl.limitFor(route)
+	for _, k := range keys {
+		ok, retry, err := rl.backend.Take(ctx, route+"|"+k, lim)
+		if err != nil {
+			// Fail open: a Redis hiccup must not lock operators out of the dashboard.
+			logger.ZSLogger.Errorw("rate limiter backend failed", "route", route, "error", err)
+			return true, 0
+		}
+		if !ok {
+			return false, retry
+		}
+	}
+	return true, 0
+}
+
+// unlockLockedFor reports the remaining lockout for an IP after failed unlocks.
+func (rl *DashboardRateLimiter) unlockLockedFor(ctx context.Context, ip string) time.Duration {
+	d, err := rl.backend.LockedFor(ctx, "unlock|"+ip)
+	if err != nil {
+		logger.ZSLogger.Errorw("rate limiter backend failed", "route", RateLimitUnlockRoute, "error", err)
+		return 0
+	}
+	return d
+}
+
+// unlockFailed records a bad login and locks the IP out once the free
+// attempts are used: Base, 2*Base, 4*Base ... capped at Max.
+func (rl *DashboardRateLimiter) unlockFailed(ctx context.Context, ip string) time.Duration {
+	p := rl.cfg.Unlock
+	failures, err := rl.backend.RecordFailure(ctx, "unlock|"+ip, p.Window)
+	if err != nil {
+		logger.ZSLogger.Errorw("rate limiter backend failed", "route", RateLimitUnlockRoute, "error", err)
+		return 0
+	}
+	over := failures - int64(p.FreeAttempts)
+	if over <= 0 {
+		return 0
+	}
+
+	lock := time.Duration(float64(p.Base) * math.Pow(2, float64(over-1)))
+	if p.Max > 0 && (lock > p.Max || lock <= 0) {
+		lock = p.Max
+	}
+	if err := rl.backend.Lock(ctx, "unlock|"+ip, lock); err != nil {
+		logger.ZSLogger.Errorw("rate limiter backend failed", "route", RateLimitUnlockRoute, "error", err)
+		return 0
+	}
+	logger.ZSLogger.Warnw("dashboard unlock locked out", "ip", ip, "failures", failures, "lockout", lock.String())
+	return lock
+}
+
+func (rl *DashboardRateLimiter) unlockSucceeded(ctx context.Context, ip string) {
+	_ = rl.backend.Reset(ctx, "unlock|"+ip)
+}
+
+func rejectRateLimited(c *gin.Context, retry time.Duration) {
+	secs := int(math.Ceil(retry.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(secs))
+	abortWithError(c, newAPIError(429, "rate_limited", "too many requests, retry in %ds", secs).With("retry_after", secs))
+}
+
+// DashboardRateLimitMiddleware limits authenticated dashboard routes per
+// client IP and per session. It runs after ParadoxAuthMiddleware.
+func DashboardRateLimitMiddleware(rl *DashboardRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		keys := []string{"ip:" + c.ClientIP()}
+		if sess := DashboardSessionFrom(c); sess != nil {
+			if sess.TokenID != "" {
+				keys = append(keys, "token:"+sess.TokenID)
+			} else {
+				keys = append(keys, "operator:"+sess.Operator)
+			}
+		}
+
+		if ok, retry := rl.allow(c.Request.Context(), route, keys...); !ok {
+			rejectRateLimited(c, retry)
+			return
+		}
+		c.Next()
+	}
+}
+
+// --- Redis backend ---
+
+// redisTokenBucketScript refills the bucket for the time elapsed since the
+// last call, then tries to spend one token. The caller's clock is used so
+// the script stays deterministic for replication.
+//
+// KEYS[1] bucket hash, ARGV: rate/s, burst, now_ms
+// Returns {allowed (0/1), retry_after_ms}
+var redisTokenBucketScript = redis.NewScript(`
+local rate  = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now   = tonumber(ARGV[3])
+
+local state  = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts     = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, retry}
+`)
+
+type RedisRateLimitBackend struct {
+	redis redis.UniversalClient
+}
+
+func NewRedisRateLimitBackend(r redis.UniversalClient) *RedisRateLimitBackend {
+	return &RedisRateLimitBackend{redis: r}
+}
+
+func (b *RedisRateLimitBackend) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	res, err := redisTokenBucketScript.Run(ctx, b.redis, []string{keyspace.RateLimitBucket(key)},
+		limit.Rate, limit.Burst, time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	allowed, _ := res[0].(int64)
+	retryMs, _ := res[1].(int64)
+	return allowed == 1, time.Duration(retryMs) * time.Millisecond, nil
+}
+
+func (b *RedisRateLimitBackend) RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	k := keyspace.RateLimitFail(key)
+	var incr *redis.IntCmd
+	_, err := b.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, k)
+		pipe.Expire(ctx, k, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (b *RedisRateLimitBackend) Lock(ctx context.Context, key string, d time.Duration) error {
+	return b.redis.Set(ctx, keyspace.RateLimitLock(key), 1, d).Err()
+}
+
+func (b *RedisRateLimitBackend) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := b.redis.PTTL(ctx, keyspace.RateLimitLock(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 { // -2 missing, -1 no expiry (never set by us)
+		return 0, nil
+	}
+	return d, nil
+}
+
+func (b *RedisRateLimitBackend) Reset(ctx context.Context, key string) error {
+	return b.redis.Del(ctx, keyspace.RateLimitFail(key), keyspace.RateLimitLock(key)).Err()
+}
+
+// --- Memory backend (tests, single-process dev) ---
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+type memoryFailures struct {
+	count   int64
+	expires time.Time
+}
+
+type MemoryRateLimitBackend struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	buckets  map[string]*memoryBucket
+	failures map[string]*memoryFailures
+	locks    map[string]time.Time
+}
+
+func NewMemoryRateLimitBackend() *MemoryRateLimitBackend {
+	return &MemoryRateLimitBackend{
+		now:      time.Now,
+		buckets:  map[string]*memoryBucket{},
+		failures: map[string]*memoryFailures{},
+		locks:    map[string]time.Time{},
+	}
+}
+
+func (b *MemoryRateLimitBackend) Take(_ context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(limit.Burst), ts: now}
+		b.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.ts).Seconds()*limit.Rate)
+	bucket.ts = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	retry := time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+	return false, retry, nil
+}
+
+func (b *MemoryRateLimitBackend) RecordFailure(_ context.Context, key string, window time.Duration) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	f, ok := b.failures[key]
+	if !ok || now.After(f.expires) {
+		f = &memoryFailures{}
+		b.failures[key] = f
+	}
+	f.count++
+	f.expires = now.Add(window)
+	return f.count, nil
+}
+
+func (b *MemoryRateLimitBackend) Lock(_ context.Context, key string, d time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.locks[key] = b.now().Add(d)
+	return nil
+}
+
+func (b *MemoryRateLimitBackend) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	if d := until.Sub(b.now()); d > 0 {
+		return d, nil
+	}
+	delete(b.locks, key)
+	return 0, nil
+}
+
+func (b *MemoryRateLimitBackend) Reset(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+	delete(b.locks, key)
+	return nil
+}
@@ -0,0 +1,234 @@
+// logic/telegram_monitoring_ratelimit_test.go
+package logic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// memoryRateLimitClock is a MemoryRateLimitBackend on a clock the test moves.
+func memoryRateLimitClock() (*MemoryRateLimitBackend, func(time.Duration)) {
+	now := time.Unix(1700000000, 0)
+	b := NewMemoryRateLimitBackend()
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	type take struct {
+		after     time.Duration // clock moves this much first
+		wantOK    bool
+		wantRetry time.Duration
+	}
+	tests := []struct {
+		name  string
+		limit RateLimit
+		takes []take
+	}{
+		{
+			name:  "burst then empty",
+			limit: RateLimit{Rate: 1, Burst: 2},
+			takes: []take{{0, true, 0}, {0, true, 0}, {0, false, time.Second}},
+		},
+		{
+			name:  "refills at rate",
+			limit: RateLimit{Rate: 2, Burst: 1},
+			takes: []take{{0, true, 0}, {100 * time.Millisecond, false, 400 * time.Millisecond}, {400 * time.Millisecond, true, 0}},
+		},
+		{
+			name:  "refill capped at burst",
+			limit: RateLimit{Rate: 10, Burst: 2},
+			takes: []take{{0, true, 0}, {0, true, 0}, {time.Hour, true, 0}, {0, true, 0}, {0, false, 100 * time.Millisecond}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, advance := memoryRateLimitClock()
+			for i, tk := range tt.takes {
+				advance(tk.after)
+				ok, retry, err := b.Take(context.Background(), "k", tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != tk.wantOK || (retry-tk.wantRetry).Abs() > time.Millisecond {
+					t.Errorf("take %d = %v, retry %v; want %v, retry %v", i, ok, retry, tk.wantOK, tk.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestUnlockLockout(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 2, Base: 10 * time.Second, Max: 40 * time.Second, Window: time.Hour}
+	tests := []struct {
+		name     string
+		after    time.Duration // clock moves this much before the failure
+		wantLock time.Duration
+	}{
+		{"first free attempt", 0, 0},
+		{"second free attempt", 0, 0},
+		{"base lockout", 0, 10 * time.Second},
+		{"doubled", 0, 20 * time.Second},
+		{"doubled again", 0, 40 * time.Second},
+		{"capped at max", 0, 40 * time.Second},
+		{"window forgets failures", 2 * time.Hour, 0},
+	}
+	b, advance := memoryRateLimitClock()
+	rl := NewDashboardRateLimiter(b, RateLimitConfig{Unlock: policy})
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advance(tt.after)
+			if got := rl.unlockFailed(ctx, "10.0.0.1"); got != tt.wantLock {
+				t.Fatalf("lockout = %v, want %v", got, tt.wantLock)
+			}
+			if got := rl.unlockLockedFor(ctx, "10.0.0.1"); got != tt.wantLock {
+				t.Errorf("locked for %v, want %v", got, tt.wantLock)
+			}
+		})
+	}
+
+	rl.unlockSucceeded(ctx, "10.0.0.1")
+	if got := rl.unlockLockedFor(ctx, "10.0.0.1"); got != 0 {
+		t.Errorf("a successful unlock left a %v lockout", got)
+	}
+}
+
+func TestDashboardRateLimitResponses(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { r.Close() })
+	ctx := context.Background()
+	hash, err := HashDashboardPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewDashboardAuth(r, DashboardAuthConfig{
+		Operators:      []DashboardOperator{{Username: "vera", PasswordHash: hash, Role: RoleViewer}},
+		InsecureCookie: true,
+		RateLimit: RateLimitConfig{
+			Routes: map[string]RateLimit{
+				RateLimitUnlockRoute:    {Rate: 100, Burst: 100},
+				"GET /dashboard/api/me": {Rate: 0.5, Burst: 1},
+			},
+			Unlock: LockoutPolicy{FreeAttempts: 1, Base: 30 * time.Second, Max: time.Minute, Window: time.Hour},
+		},
+	})
+	backend, advance := memoryRateLimitClock()
+	auth.UseRateLimitBackend(backend)
+	router := gin.New()
+	if err := NewTelegramMonitor(TelegramLogic{}, nil, &fakeTrackedRepo{}).RegisterDashboardRoutes(router, auth); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := auth.CreateAPIToken(ctx, "ci", RoleViewer, time.Hour, nil, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bearer := http.Header{"Authorization": {"Bearer " + token}}
+	csrf := http.Header{"Cookie": {DashboardCSRFCookie + "=pre"}, DashboardCSRFHeader: {"pre"}}
+	tests := []struct {
+		name           string
+		after          time.Duration
+		method, path   string
+		body           string
+		header         http.Header
+		wantCode       int
+		wantRetryAfter string // "" when the header must be absent
+	}{
+		{name: "within the burst", method: "GET", path: "/dashboard/api/me", header: bearer, wantCode: 200},
+		{name: "bucket empty", method: "GET", path: "/dashboard/api/me", header: bearer, wantCode: 429, wantRetryAfter: "2"},
+		{name: "refilled", after: 2 * time.Second, method: "GET", path: "/dashboard/api/me", header: bearer, wantCode: 200},
+		{name: "free failed unlock", method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"nope"}`, header: csrf, wantCode: 401},
+		{name: "failed unlock locks out", method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"nope"}`, header: csrf, wantCode: 401, wantRetryAfter: "30"},
+		{name: "locked out even with the password", after: 10 * time.Second, method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"pw"}`, header: csrf, wantCode: 429, wantRetryAfter: "20"},
+		{name: "lockout over", after: 20 * time.Second, method: "POST", path: "/dashboard?paradox=unlock", body: `{"username":"vera","password":"pw"}`, header: csrf, wantCode: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advance(tt.after)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, vs := range tt.header {
+				for _, v := range vs {
+					req.Header.Add(k, v)
+				}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %.200s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if w.Code == 429 {
+				if code := errorCode(t, w); code != "rate_limited" {
+					t.Errorf("error = %v, want rate_limited", code)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitConfigDefaults(t *testing.T) {
+	def := DefaultRateLimitConfig()
+	tests := []struct {
+		name       string
+		cfg        RateLimitConfig
+		route      string
+		wantLimit  RateLimit
+		wantUnlock LockoutPolicy
+	}{
+		{
+			name:       "empty",
+			route:      "GET /dashboard/api/me",
+			wantLimit:  def.Default,
+			wantUnlock: def.Unlock,
+		},
+		{
+			name:       "partial lockout keeps the base",
+			cfg:        RateLimitConfig{Unlock: LockoutPolicy{FreeAttempts: 1}},
+			route:      RateLimitUnlockRoute,
+			wantLimit:  def.Routes[RateLimitUnlockRoute],
+			wantUnlock: LockoutPolicy{FreeAttempts: 1, Base: def.Unlock.Base, Max: def.Unlock.Max, Window: def.Unlock.Window},
+		},
+		{
+			name:       "route rate only takes the default burst",
+			cfg:        RateLimitConfig{Routes: map[string]RateLimit{RateLimitUnlockRoute: {Rate: 100}}},
+			route:      RateLimitUnlockRoute,
+			wantLimit:  RateLimit{Rate: 100, Burst: def.Routes[RateLimitUnlockRoute].Burst},
+			wantUnlock: def.Unlock,
+		},
+		{
+			name:       "new route fills from the default limit",
+			cfg:        RateLimitConfig{Routes: map[string]RateLimit{"GET /dashboard/api/me": {Burst: 1}}, Default: RateLimit{Rate: 2}},
+			route:      "GET /dashboard/api/me",
+			wantLimit:  RateLimit{Rate: 2, Burst: 1},
+			wantUnlock: def.Unlock,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg.withDefaults()
+			lim, ok := cfg.Routes[tt.route]
+			if !ok {
+				lim = cfg.Default
+			}
+			if lim != tt.wantLimit {
+				t.Errorf("%s limit = %+v, want %+v", tt.route, lim, tt.wantLimit)
+			}
+			if cfg.Unlock != tt.wantUnlock {
+				t.Errorf("unlock = %+v, want %+v", cfg.Unlock, tt.wantUnlock)
+			}
+		})
+	}
+}
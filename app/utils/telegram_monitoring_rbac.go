@@ -0,0 +1,152 @@
+// logic/telegram_monitoring_rbac.go
+package logic
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// --- DASHBOARD ROLES & ROUTE PERMISSIONS ---
+
+type DashboardRole string
+
+const (
+	RoleViewer   DashboardRole = "viewer"   // read-only telemetry
+	RoleOperator DashboardRole = "operator" // watchlist, relation status, PII deep scan
+	RoleAdmin    DashboardRole = "admin"    // destructive actions
+)
+
+var dashboardRoleRank = map[DashboardRole]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func (r DashboardRole) Valid() bool {
+	_, ok := dashboardRoleRank[r]
+	return ok
+}
+
+// Allows reports whether r is at least as privileged as required.
+func (r DashboardRole) Allows(required DashboardRole) bool {
+	have, ok := dashboardRoleRank[r]
+	if !ok {
+		return false
+	}
+	return have >= dashboardRoleRank[required]
+}
+
+// dashboardRoute is one row of the permission table. The same table drives
+// route registration and enforcement, so a route cannot exist without a role.
+type dashboardRoute struct {
+	Method  string
+	Path    string
+	Role    DashboardRole
+	Handler func(TelegramMonitor, *gin.Context)
+}
+
+var dashboardRoutes = []dashboardRoute{
+	{"GET", "/dashboard", RoleViewer, TelegramMonitor.ServeDashboardUI},
+	// ?paradox=unlock and ?paradox=logout are answered by ParadoxAuthMiddleware,
+	// but the group only runs it for routes that exist.
+	{"POST", "/dashboard", RoleViewer, TelegramMonitor.ServeDashboardUI},
+	{"GET", "/dashboard/api/me", RoleViewer, TelegramMonitor.ServeDashboardIdentity},
+	{"GET", "/dashboard/api/openapi.json", RoleViewer, TelegramMonitor.ServeOpenAPI},
+	{"GET", "/dashboard/api/stats", RoleViewer, TelegramMonitor.ServeDashboardStats},
+	{"GET", "/dashboard/api/stream", RoleViewer, TelegramMonitor.StreamDashboard},
+	{"GET", "/dashboard/api/inspect", RoleViewer, TelegramMonitor.InspectEntity},
+	{"GET", "/dashboard/api/policy", RoleViewer, TelegramMonitor.ServeStrikePolicy},
+	{"GET", "/dashboard/api/shadow", RoleViewer, TelegramMonitor.ServeShadowVerdicts},
+	{"POST", "/dashboard/api/shadow/reconcile", RoleOperator, TelegramMonitor.ReconcileShadowVerdicts},
+	{"GET", "/dashboard/api/review", RoleViewer, TelegramMonitor.ServeReviewQueue},
+	{"POST", "/dashboard/api/review/:id/approve", RoleOperator, TelegramMonitor.ApproveReview},
+	{"POST", "/dashboard/api/review/:id/reject", RoleOperator, TelegramMonitor.RejectReview},
+	{"GET", "/dashboard/api/verdicts", RoleViewer, TelegramMonitor.ListVerdicts},
+	{"POST", "/dashboard/api/verdicts/:id/restore", RoleOperator, TelegramMonitor.RestoreVerdict},
+	{"POST", "/dashboard/api/policy/reload", RoleAdmin, TelegramMonitor.ServeStrikePolicyReload},
+	{"GET", "/dashboard/api/classifier/rules", RoleViewer, TelegramMonitor.ServeDeletionRules},
+	{"GET", "/dashboard/api/relations/deep", RoleOperator, TelegramMonitor.GetDeepDetails},
+	{"POST", "/dashboard/api/watch", RoleOperator, TelegramMonitor.ToggleWatch},
+	{"POST", "/dashboard/api/relations/update", RoleOperator, TelegramMonitor.UpdateRelationStatus},
+	{"POST", "/dashboard/api/reset", RoleAdmin, TelegramMonitor.ClearMonitoringData},
+	{"GET", "/dashboard/api/reset/:id", RoleAdmin, TelegramMonitor.ServeResetJob},
+	{"POST", "/dashboard/api/admin/quarantine/migrate", RoleAdmin, TelegramMonitor.MigrateQuarantineKeyspace},
+	{"GET", "/dashboard/api/admin/keys/audit", RoleAdmin, TelegramMonitor.ServeKeysAudit},
+	{"GET", "/dashboard/api/admin/snapshot", RoleAdmin, TelegramMonitor.ExportSnapshot},
+	{"POST", "/dashboard/api/admin/snapshot/restore", RoleAdmin, TelegramMonitor.RestoreSnapshotUpload},
+	{"GET", "/dashboard/api/audit", RoleAdmin, TelegramMonitor.ServeAuditLog},
+	{"GET", "/dashboard/api/audit/verify", RoleAdmin, TelegramMonitor.VerifyAuditLog},
+	{"GET", "/dashboard/api/tokens", RoleAdmin, TelegramMonitor.ListAPITokens},
+	{"POST", "/dashboard/api/tokens", RoleAdmin, TelegramMonitor.CreateAPIToken},
+	{"DELETE", "/dashboard/api/tokens/:id", RoleAdmin, TelegramMonitor.RevokeAPIToken},
+}
+
+var dashboardRoutePermissions = func() map[string]DashboardRole {
+	perms := make(map[string]DashboardRole, len(dashboardRoutes))
+	for _, rt := range dashboardRoutes {
+		perms[rt.Method+" "+rt.Path] = rt.Role
+	}
+	return perms
+}()
+
+// RegisterDashboardRoutes mounts the dashboard and its API behind
+// ParadoxAuthMiddleware, DashboardRateLimitMiddleware and DashboardRBACMiddleware.
+// It mounts nothing and returns ErrRedisCluster when auth runs on Redis
+// Cluster: token writes and the audit chain span keys, so that should stop
+// startup rather than fail on the first login. Likewise it returns
+// ErrNoTrackingResumer when l was built without one, rather than refusing
+// every restore later.
+func (l TelegramMonitor) RegisterDashboardRoutes(r gin.IRouter, auth *DashboardAuth) error {
+	if isRedisCluster(auth.redis) {
+		return ErrRedisCluster
+	}
+	if l.tracking == nil {
+		return ErrNoTrackingResumer
+	}
+	guarded := r.Group("",
+		ParadoxAuthMiddleware(auth),
+		DashboardRateLimitMiddleware(auth.limiter),
+		DashboardRBACMiddleware(),
+	)
+	for _, rt := range dashboardRoutes {
+		handler := rt.Handler
+		guarded.Handle(rt.Method, rt.Path, func(c *gin.Context) { handler(l, c) })
+	}
+	return nil
+}
+
+// DashboardRBACMiddleware enforces dashboardRoutes against the session role.
+// Routes missing from the table are denied rather than left open.
+func DashboardRBACMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		required, ok := dashboardRoutePermissions[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			abortWithError(c, newAPIError(403, "route_not_permitted", "route has no permission entry"))
+			return
+		}
+
+		sess := DashboardSessionFrom(c)
+		if sess == nil || !sess.Role.Allows(required) {
+			abortWithError(c, newAPIError(403, "forbidden", "this route requires the %s role", required).With("required_role", required))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// DashboardIdentityResponse is who the caller is signed in as.
+type DashboardIdentityResponse struct {
+	Operator  string        `json:"operator"` // "token:<name>" for API tokens
+	Role      DashboardRole `json:"role"`
+	ExpiresAt int64         `json:"expires_at"`
+}
+
+// GET /dashboard/api/me
+func (l TelegramMonitor) ServeDashboardIdentity(c *gin.Context) {
+	sess := DashboardSessionFrom(c)
+	c.JSON(200, DashboardIdentityResponse{
+		Operator:  sess.Operator,
+		Role:      sess.Role,
+		ExpiresAt: sess.ExpiresAt,
+	})
+}
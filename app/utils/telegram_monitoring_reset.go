@@ -0,0 +1,327 @@
+// logic/telegram_monitoring_reset.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- SCOPED RESETS ---
+//
+// POST /dashboard/api/reset used to run KEYS monitor:* and DEL everything in
+// one Lua call, blocking Redis for as long as that took and taking the
+// quarantine with it. A reset is now a background job with a scope:
+//
+//   feed        the live feed
+//   timeseries  the per-minute traffic and error-code buckets
+//   history     the deep log of one ID
+//   all         every monitor:* key (snapshot first, confirmation required)
+//
+// The job SCANs in batches and UNLINKs what it finds, pausing between
+// batches, and records its progress in dashboard:reset:job:<id>.
+
+const (
+	ResetScopeFeed       = "feed"
+	ResetScopeTimeSeries = "timeseries"
+	ResetScopeHistory    = "history"
+	ResetScopeAll        = "all"
+
+	ResetJobRunning = "running"
+	ResetJobDone    = "done"
+	ResetJobFailed  = "failed"
+
+	resetJobTTL     = 24 * time.Hour
+	resetConfirmTTL = 2 * time.Minute
+	resetScanCount  = 500
+	resetBatchPause = 10 * time.Millisecond
+)
+
+type ResetJob struct {
+	ID         string        `json:"id"`
+	Scope      string        `json:"scope"`
+	TelegramID int64         `json:"telegram_id,omitempty"` // history scope only
+	Patterns   []string      `json:"patterns"`
+	State      string        `json:"state"`
+	Actor      string        `json:"actor"`
+	RequestID  string        `json:"request_id,omitempty"`
+	Scanned    int64         `json:"scanned"`
+	Deleted    int64         `json:"deleted"`
+	Snapshot   *SnapshotInfo `json:"snapshot,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	StartedAt  int64         `json:"started_at"`
+	FinishedAt int64         `json:"finished_at,omitempty"`
+}
+
+// resetPatterns lists the SCAN patterns (or exact keys) a scope covers.
+func resetPatterns(scope string, telegramID int64) ([]string, error) {
+	switch scope {
+	case ResetScopeFeed:
+		return []string{keyspace.LiveFeed}, nil
+	case ResetScopeTimeSeries:
+		return []string{
+			keyspace.ScanPattern("ts_hits"),
+			keyspace.ScanPattern("ts_errors"),
+			keyspace.ScanPattern("ts_error_code"),
+		}, nil
+	case ResetScopeHistory:
+		if telegramID <= 0 {
+			return nil, fmt.Errorf("history reset needs an id")
+		}
+		return []string{keyspace.History(telegramID)}, nil
+	case ResetScopeAll:
+		return []string{keyspace.All}, nil
+	}
+	return nil, fmt.Errorf("unknown reset scope %q", scope)
+}
+
+func saveResetJob(ctx context.Context, r redis.Cmdable, job *ResetJob) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return r.Set(ctx, keyspace.ResetJob(job.ID), raw, resetJobTTL).Err()
+}
+
+func loadResetJob(ctx context.Context, r redis.Cmdable, id string) (*ResetJob, error) {
+	raw, err := r.Get(ctx, keyspace.ResetJob(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job ResetJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// runResetJob does the deleting. It runs detached from the request, so it
+// gets its own context.
+func runResetJob(ctx context.Context, store MonitorStore, job *ResetJob) {
+	// A lost save leaves GET /dashboard/api/reset/:id showing stale progress;
+	// the reset itself goes on.
+	save := func() {
+		if err := store.SaveResetJob(ctx, job); err != nil {
+			logger.ZSLogger.Errorw("failed to save reset job", "job_id", job.ID, "state", job.State, "error", err)
+		}
+	}
+	fail := func(err error) {
+		job.State = ResetJobFailed
+		job.Error = err.Error()
+		job.FinishedAt = time.Now().Unix()
+		save()
+		logger.ZSLogger.Errorw("monitor reset failed", "job_id", job.ID, "scope", job.Scope, "deleted", job.Deleted, "error", err)
+	}
+
+	if s, ok := store.(monitorSnapshotter); ok && job.Scope == ResetScopeAll {
+		info, err := s.Snapshot(ctx)
+		if err != nil {
+			fail(fmt.Errorf("snapshot before reset: %w", err))
+			return
+		}
+		job.Snapshot = &info
+		save()
+		logger.ZSLogger.Infow("monitor snapshot written before reset", "job_id", job.ID, "path", info.Path, "keys", info.Keys)
+	}
+
+	if err := store.Reset(ctx, job); err != nil {
+		fail(err)
+		return
+	}
+
+	job.State = ResetJobDone
+	job.FinishedAt = time.Now().Unix()
+	save()
+	publishMonitorEvent(ctx, store, MonitorEventReset, ResetEvent{JobID: job.ID, Scope: job.Scope})
+	logger.ZSLogger.Infow("monitor reset finished", "job_id", job.ID, "scope", job.Scope, "scanned", job.Scanned, "deleted", job.Deleted)
+}
+
+func resetPattern(ctx context.Context, r redis.Cmdable, job *ResetJob, pattern string) error {
+	if !strings.ContainsAny(pattern, "*?[") {
+		n, err := r.Unlink(ctx, pattern).Result()
+		job.Scanned++
+		job.Deleted += n
+		return err
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := r.Scan(ctx, cursor, pattern, resetScanCount).Result()
+		if err != nil {
+			return err
+		}
+		job.Scanned += int64(len(keys))
+		if len(keys) > 0 {
+			n, err := r.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+			job.Deleted += n
+			_ = saveResetJob(ctx, r, job)
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+		time.Sleep(resetBatchPause)
+	}
+}
+
+// issueResetConfirmation hands out the one-time token an "all" reset must
+// echo back. It is bound to the actor who asked for it.
+func issueResetConfirmation(ctx context.Context, r redis.Cmdable, actor string) (string, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	return token, r.Set(ctx, keyspace.ResetConfirm(token), actor, resetConfirmTTL).Err()
+}
+
+// consumeResetConfirmation burns token and reports whether actor issued it.
+func consumeResetConfirmation(ctx context.Context, r redis.Cmdable, token, actor string) (bool, error) {
+	var get *redis.StringCmd
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, keyspace.ResetConfirm(token))
+		pipe.Del(ctx, keyspace.ResetConfirm(token))
+		return nil
+	})
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return get.Val() == actor, nil
+}
+
+// --- HTTP HANDLERS ---
+
+// ResetRequest is POST /dashboard/api/reset. An empty scope means "all".
+type ResetRequest struct {
+	Scope   string     `json:"scope"`
+	ID      TelegramID `json:"id"` // history scope only
+	Confirm string     `json:"confirm"`
+}
+
+func (r ResetRequest) scope() string {
+	if r.Scope == "" {
+		return ResetScopeAll
+	}
+	return r.Scope
+}
+
+func (r ResetRequest) Validate() error {
+	if _, err := resetPatterns(r.scope(), int64(r.ID)); err != nil {
+		return newAPIError(400, "invalid_scope", "%s", err)
+	}
+	return nil
+}
+
+// POST /dashboard/api/reset { "scope": "feed|timeseries|history|all", "id": 123, "confirm": "<token>" }
+//
+// Without a body the scope is "all". An "all" request without a confirm
+// token gets 428 and a token to send back within two minutes.
+func (l TelegramMonitor) ClearMonitoringData(c *gin.Context) {
+	var req ResetRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	ctx := c.Request.Context()
+	scope := req.scope()
+	patterns, _ := resetPatterns(scope, int64(req.ID))
+
+	actor := dashboardActor(c)
+	if scope == ResetScopeAll {
+		if req.Confirm == "" {
+			token, err := store.IssueResetConfirmation(ctx, actor)
+			if err != nil {
+				abortWithError(c, newAPIError(500, "confirmation_failed", "could not issue a confirmation token"))
+				return
+			}
+			abortWithError(c, newAPIError(428, "confirmation_required", "resend with confirm set to the token within %s", resetConfirmTTL).
+				With("confirm_token", token).
+				With("expires_in", int(resetConfirmTTL.Seconds())))
+			return
+		}
+		ok, err := store.ConsumeResetConfirmation(ctx, req.Confirm, actor)
+		if err != nil {
+			abortWithError(c, newAPIError(500, "confirmation_failed", "could not check the confirmation token"))
+			return
+		}
+		if !ok {
+			abortWithError(c, newAPIError(403, "invalid_confirmation", "confirmation token is unknown, used or issued to someone else"))
+			return
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		abortWithError(c, newAPIError(500, "job_id_failed", "could not allocate a job ID"))
+		return
+	}
+	job := &ResetJob{
+		ID:         id,
+		Scope:      scope,
+		TelegramID: int64(req.ID),
+		Patterns:   patterns,
+		State:      ResetJobRunning,
+		Actor:      actor,
+		RequestID:  dashboardRequestID(c),
+		StartedAt:  time.Now().Unix(),
+	}
+	if err := store.SaveResetJob(ctx, job); err != nil {
+		logger.ZSLogger.Errorw("failed to create reset job", "error", err)
+		abortWithError(c, newAPIError(500, "job_create_failed", "could not record the reset job"))
+		return
+	}
+
+	logger.ZSLogger.Infow("monitor reset started", "job_id", job.ID, "scope", job.Scope, "actor", actor)
+	l.auditRequest(c, AuditActionReset, strings.Join(patterns, ","), nil, gin.H{"job_id": job.ID, "scope": job.Scope})
+
+	c.JSON(202, job) // before the job starts mutating it
+	go runResetJob(context.Background(), store, job)
+}
+
+// ResetJobRequest is GET /dashboard/api/reset/:id.
+type ResetJobRequest struct {
+	ID string `uri:"id"`
+}
+
+// GET /dashboard/api/reset/:id
+func (l TelegramMonitor) ServeResetJob(c *gin.Context) {
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	var req ResetJobRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	job, err := store.LoadResetJob(c.Request.Context(), req.ID)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read reset job", "job_id", req.ID, "error", err)
+		abortWithError(c, newAPIError(500, "job_read_failed", "could not read the reset job"))
+		return
+	}
+	if job == nil {
+		abortWithError(c, newAPIError(404, "job_not_found", "no reset job %q", req.ID))
+		return
+	}
+	c.JSON(200, job)
+}
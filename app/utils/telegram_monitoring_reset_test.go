@@ -0,0 +1,136 @@
+// logic/telegram_monitoring_reset_test.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestClearMonitoringData(t *testing.T) {
+	tests := []struct {
+		name      string
+		noStore   bool
+		body      string
+		wantCode  int
+		wantError string
+	}{
+		{name: "no telemetry", noStore: true, body: `{"scope":"feed"}`, wantCode: 503, wantError: "telemetry_unavailable"},
+		{name: "invalid body", body: `{"scope":`, wantCode: 400, wantError: "invalid_json"},
+		{name: "malformed history id", body: `{"scope":"history","id":"x"}`, wantCode: 400, wantError: "invalid_id"},
+		{name: "unknown scope", body: `{"scope":"everything"}`, wantCode: 400, wantError: "invalid_scope"},
+		{name: "history without id", body: `{"scope":"history"}`, wantCode: 400, wantError: "invalid_scope"},
+		{name: "all needs confirmation", body: `{"scope":"all"}`, wantCode: 428, wantError: "confirmation_required"},
+		{name: "empty body means all", body: "", wantCode: 428, wantError: "confirmation_required"},
+		{name: "unknown confirmation", body: `{"scope":"all","confirm":"nope"}`, wantCode: 403, wantError: "invalid_confirmation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, !tt.noStore)
+			w := serve(env.router, "POST", "/dashboard/api/reset", tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := errorCode(t, w); got != tt.wantError {
+				t.Errorf("error = %v, want %q", got, tt.wantError)
+			}
+		})
+	}
+
+	t.Run("scoped resets", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		ctx := context.Background()
+		env.store.PushFeed(`{"tg":1}`)
+		env.store.RecordLookup(time.Now(), false)
+		env.store.AppendHistory(9, `{"s":"online"}`)
+		env.store.AppendHistory(10, `{"s":"online"}`)
+
+		job := runReset(t, env, `{"scope":"feed"}`)
+		if stats, _ := env.store.Stats(ctx, StatsQuery{Now: time.Now(), Minutes: 1, FeedLimit: 10}); len(stats.Feed) != 0 || stats.Hits != 1 {
+			t.Errorf("feed reset left feed=%v hits=%d", stats.Feed, stats.Hits)
+		}
+		if job["deleted"] != 1.0 {
+			t.Errorf("feed job = %v", job)
+		}
+
+		runReset(t, env, `{"scope":"history","id":9}`)
+		if h, _ := env.store.History(ctx, 9, 10); len(h) != 0 {
+			t.Errorf("history 9 survived: %v", h)
+		}
+		if h, _ := env.store.History(ctx, 10, 10); len(h) != 1 {
+			t.Errorf("history 10 was touched: %v", h)
+		}
+	})
+
+	t.Run("all with confirmation", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		ctx := context.Background()
+		_, _ = env.store.ApplyStrike(ctx, 42, DeletionClassification{RuleID: "r"}, 1, time.Now(), CurrentStrikePolicy())
+
+		token := resetConfirmToken(t, env)
+
+		// A token only works for the operator it was issued to.
+		other := newTestRouter(env.logic, &DashboardSession{Operator: "someone-else", Role: RoleAdmin})
+		if w := serve(other, "POST", "/dashboard/api/reset", `{"scope":"all","confirm":"`+token+`"}`); w.Code != 403 {
+			t.Fatalf("foreign token: status %d", w.Code)
+		}
+		// ...and only once: the failed attempt burnt it.
+		if w := serve(env.router, "POST", "/dashboard/api/reset", `{"scope":"all","confirm":"`+token+`"}`); w.Code != 403 {
+			t.Fatalf("reused token: status %d", w.Code)
+		}
+
+		job := runReset(t, env, `{"scope":"all","confirm":"`+resetConfirmToken(t, env)+`"}`)
+		if job["scope"] != ResetScopeAll {
+			t.Errorf("job = %v", job)
+		}
+		if q, _ := env.store.IsQuarantined(ctx, 42); q {
+			t.Error("quarantine survived an all reset")
+		}
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		w := serve(env.router, "GET", "/dashboard/api/reset/nope", "")
+		if w.Code != 404 || errorCode(t, w) != "job_not_found" {
+			t.Errorf("got %d %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+// resetConfirmToken asks for an "all" reset and returns the token from the 428.
+func resetConfirmToken(t *testing.T, env *handlerEnv) string {
+	t.Helper()
+	w := serve(env.router, "POST", "/dashboard/api/reset", `{"scope":"all"}`)
+	var body APIErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	token, _ := body.Error.Details["confirm_token"].(string)
+	if w.Code != 428 || token == "" {
+		t.Fatalf("no confirm token: %d %s", w.Code, w.Body.String())
+	}
+	return token
+}
+
+// runReset starts a reset and polls its job until it is no longer running.
+func runReset(t *testing.T, env *handlerEnv, body string) map[string]interface{} {
+	t.Helper()
+	w := serve(env.router, "POST", "/dashboard/api/reset", body)
+	if w.Code != 202 {
+		t.Fatalf("reset %s: status %d: %s", body, w.Code, w.Body.String())
+	}
+	id := decodeBody(t, w)["id"].(string)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job := decodeBody(t, serve(env.router, "GET", "/dashboard/api/reset/"+id, ""))
+		if job["state"] != ResetJobRunning {
+			if job["state"] != ResetJobDone {
+				t.Fatalf("reset job ended %v", job)
+			}
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("reset job %s still running", id)
+	return nil
+}
@@ -0,0 +1,302 @@
+// logic/telegram_monitoring_review.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+)
+
+// --- REVIEW QUEUE (Pending Verdicts) ---
+//
+// With StrikePolicy.Review.Enabled, crossing the threshold parks the account
+// in a review queue instead of writing to the database. An operator approves
+// (the kill goes ahead) or rejects (strikes are cleared) it from the
+// quarantine view. If Review.AutoApproveAfter is set, verdicts nobody looked
+// at are approved once they are that old.
+//
+// Whoever removes the entry from the hash owns the decision, so an operator
+// click and the auto-approver can never both act on the same verdict. An
+// approval whose kill does not run puts the entry back.
+
+const (
+	AuditActionReviewApprove  = "review.approve"
+	AuditActionReviewReject   = "review.reject"
+	AuditActionReviewWithdraw = "review.withdraw"
+
+	AuditActorAutoApprove = "system:auto_approve"
+)
+
+type ReviewPolicy struct {
+	Enabled bool `json:"enabled"`
+	// AutoApproveAfter approves a pending verdict nobody decided on after
+	// this long. Zero keeps it pending until an operator acts.
+	AutoApproveAfter PolicyDuration `json:"auto_approve_after"`
+}
+
+type PendingVerdict struct {
+	TelegramID int64   `json:"id"`
+	QueuedAt   int64   `json:"queued_at"`
+	Score      float64 `json:"score"`
+	Threshold  float64 `json:"threshold"`
+	Rule       string  `json:"rule"`
+	// AutoApproveAt is 0 when auto-approval is off.
+	AutoApproveAt int64 `json:"auto_approve_at,omitempty"`
+}
+
+// enqueueReview parks a verdict. An ID already waiting keeps its original
+// place (and auto-approve deadline).
+func enqueueReview(ctx context.Context, r redis.Cmdable, v PendingVerdict) (bool, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return r.HSetNX(ctx, keyspace.ReviewPending, strconv.FormatInt(v.TelegramID, 10), raw).Result()
+}
+
+// claimReview removes a pending verdict and returns it. Nil means it was
+// already decided (or never queued).
+func claimReview(ctx context.Context, r redis.Cmdable, telegramID int64) (*PendingVerdict, error) {
+	field := strconv.FormatInt(telegramID, 10)
+	var getCmd *redis.StringCmd
+	var delCmd *redis.IntCmd
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		getCmd = pipe.HGet(ctx, keyspace.ReviewPending, field)
+		delCmd = pipe.HDel(ctx, keyspace.ReviewPending, field)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if delCmd.Val() == 0 {
+		return nil, nil
+	}
+	var v PendingVerdict
+	if err := json.Unmarshal([]byte(getCmd.Val()), &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func loadPendingReviews(ctx context.Context, r redis.Cmdable) (map[int64]PendingVerdict, error) {
+	all, err := r.HGetAll(ctx, keyspace.ReviewPending).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64]PendingVerdict, len(all))
+	for _, raw := range all {
+		var v PendingVerdict
+		if json.Unmarshal([]byte(raw), &v) == nil {
+			out[v.TelegramID] = v
+		}
+	}
+	return out, nil
+}
+
+// withdrawReview drops a pending verdict when the account recovered on its
+// own before anyone decided.
+func (l TelegramMonitor) withdrawReview(ctx context.Context, store MonitorStore, telegramID int64, score float64) {
+	v, err := store.ClaimReview(ctx, telegramID)
+	if err != nil || v == nil {
+		return
+	}
+	logger.ZSLogger.Infow("pending verdict withdrawn: strikes fell below threshold", "telegram_id", telegramID, "score", score)
+	l.audit(ctx, AuditActorSystem, AuditActionReviewWithdraw, strconv.FormatInt(telegramID, 10), "", v, gin.H{"score": score})
+}
+
+// RunReviewAutoApprover approves expired pending verdicts every interval
+// until ctx ends. Auto-approval is off unless the policy sets a timeout.
+func (l TelegramMonitor) RunReviewAutoApprover(ctx context.Context, interval time.Duration) {
+	store := l.monitorStore()
+	if store == nil {
+		logger.ZSLogger.Warn("review auto-approver not started: telemetry service is nil")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.autoApproveExpiredReviews(ctx, store)
+			}
+		}
+	}()
+}
+
+func (l TelegramMonitor) autoApproveExpiredReviews(ctx context.Context, store MonitorStore) {
+	pending, err := store.PendingReviews(ctx)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read review queue", "error", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for id, v := range pending {
+		if v.AutoApproveAt == 0 || v.AutoApproveAt > now {
+			continue
+		}
+		claimed, err := store.ClaimReview(ctx, id)
+		if err != nil || claimed == nil {
+			continue
+		}
+
+		span := opentracing.StartSpan("Logic.TelegramMonitoring.AutoApproveReview")
+		err = l.executeKill(span, ctx, store, id, claimed.Score, AuditActorAutoApprove, "")
+		span.Finish()
+		if err != nil {
+			logger.ZSLogger.Warnw("auto-approved verdict not executed", "telegram_id", id, "error", err)
+			requeueReview(ctx, store, *claimed, err)
+			continue
+		}
+		logger.ZSLogger.Warnw("pending verdict auto-approved", "telegram_id", id, "queued_at", claimed.QueuedAt)
+		l.audit(ctx, AuditActorAutoApprove, AuditActionReviewApprove, strconv.FormatInt(id, 10), "", claimed, gin.H{"decision": "approved"})
+	}
+}
+
+// requeueReview puts a claimed verdict back after its kill did not run, so
+// the decision is not lost. A kill that already ran settles the verdict.
+func requeueReview(ctx context.Context, store ReviewStore, v PendingVerdict, cause error) bool {
+	if stderrors.Is(cause, errKillClaimed) {
+		return false
+	}
+	if _, err := store.EnqueueReview(ctx, v); err != nil {
+		logger.ZSLogger.Errorw("failed to requeue pending verdict", "telegram_id", v.TelegramID, "error", err)
+		return false
+	}
+	return true
+}
+
+// killNotRunError is the reply to an approval whose kill did not run.
+func killNotRunError(cause error, requeued bool) APIError {
+	var e APIError
+	switch {
+	case stderrors.Is(cause, errKillClaimed):
+		e = newAPIError(409, "already_killed", "the kill for this account already ran")
+	case stderrors.Is(cause, ErrLeaseHeld), stderrors.Is(cause, ErrLeaseLost):
+		e = newAPIError(409, "verdict_busy", "another kill or restore holds the account; try again")
+	default:
+		e = newAPIError(500, "kill_failed", "the kill did not run")
+	}
+	return e.With("requeued", requeued)
+}
+
+// --- HTTP HANDLERS ---
+
+// ReviewQueueResponse lists verdicts waiting for an operator, oldest first.
+type ReviewQueueResponse struct {
+	Pending []PendingVerdict `json:"pending"`
+	Policy  ReviewPolicy     `json:"policy"`
+}
+
+// ReviewDecisionResponse acknowledges an approve or reject.
+type ReviewDecisionResponse struct {
+	Status string `json:"status"` // "approved" or "rejected"
+	ID     int64  `json:"id"`
+}
+
+// GET /dashboard/api/review
+func (l TelegramMonitor) ServeReviewQueue(c *gin.Context) {
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	pending, err := store.PendingReviews(c.Request.Context())
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read review queue", "error", err)
+		abortWithError(c, newAPIError(500, "review_read_failed", "could not read the review queue"))
+		return
+	}
+
+	list := make([]PendingVerdict, 0, len(pending))
+	for _, v := range pending {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].QueuedAt < list[j].QueuedAt })
+	c.JSON(200, ReviewQueueResponse{Pending: list, Policy: CurrentStrikePolicy().Review})
+}
+
+// POST /dashboard/api/review/:id/approve
+func (l TelegramMonitor) ApproveReview(c *gin.Context) {
+	l.decideReview(c, true)
+}
+
+// POST /dashboard/api/review/:id/reject
+func (l TelegramMonitor) RejectReview(c *gin.Context) {
+	l.decideReview(c, false)
+}
+
+// ReviewDecisionRequest is POST /dashboard/api/review/:id/{approve,reject}.
+type ReviewDecisionRequest struct {
+	ID TelegramID `uri:"id"`
+}
+
+func (r ReviewDecisionRequest) Validate() error { return requireTelegramID("id", r.ID) }
+
+func (l TelegramMonitor) decideReview(c *gin.Context, approve bool) {
+	var req ReviewDecisionRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	telegramID := int64(req.ID)
+
+	ctx := c.Request.Context()
+	v, err := store.ClaimReview(ctx, telegramID)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to claim pending verdict", "telegram_id", telegramID, "error", err)
+		abortWithError(c, newAPIError(500, "review_claim_failed", "could not claim the pending verdict"))
+		return
+	}
+	if v == nil {
+		abortWithError(c, newAPIError(404, "not_pending", "no verdict pending review for %d", telegramID))
+		return
+	}
+
+	actor := dashboardActor(c)
+	target := strconv.FormatInt(telegramID, 10)
+
+	if approve {
+		span := opentracing.StartSpan("Dashboard.ApproveReview")
+		defer span.Finish()
+		if err := l.executeKill(span, ctx, store, telegramID, v.Score, actor, dashboardRequestID(c)); err != nil {
+			logger.ZSLogger.Warnw("approved verdict not executed", "telegram_id", telegramID, "operator", actor, "error", err)
+			abortWithError(c, killNotRunError(err, requeueReview(ctx, store, *v, err)))
+			return
+		}
+		logger.ZSLogger.Warnw("pending verdict approved", "telegram_id", telegramID, "operator", actor)
+		l.auditRequest(c, AuditActionReviewApprove, target, v, gin.H{"decision": "approved"})
+		c.JSON(200, ReviewDecisionResponse{Status: "approved", ID: telegramID})
+		return
+	}
+
+	// Rejected: the operator vouches for the account, so its record starts over.
+	if err := store.Dequarantine(ctx, telegramID); err != nil {
+		logger.ZSLogger.Errorw("rejected verdict not cleared", "telegram_id", telegramID, "operator", actor, "error", err)
+		requeued := requeueReview(ctx, store, *v, err)
+		abortWithError(c, newAPIError(500, "dequarantine_failed", "the account's strikes were not cleared").With("requeued", requeued))
+		return
+	}
+	publishMonitorEvent(ctx, store, MonitorEventQuarantine, QuarantineEvent{
+		TelegramID: telegramID, Change: QuarantineCleared, Reason: "review", At: time.Now().Unix(),
+	})
+	logger.ZSLogger.Infow("pending verdict rejected", "telegram_id", telegramID, "operator", actor)
+	l.auditRequest(c, AuditActionReviewReject, target, v, gin.H{"decision": "rejected"})
+	c.JSON(200, ReviewDecisionResponse{Status: "rejected", ID: telegramID})
+}
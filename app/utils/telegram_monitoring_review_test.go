@@ -0,0 +1,60 @@
+// logic/telegram_monitoring_review_test.go
+package logic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// dequarantineFailingStore is a memory store whose Dequarantine always fails.
+type dequarantineFailingStore struct{ *MemoryMonitorStore }
+
+func (dequarantineFailingStore) Dequarantine(context.Context, int64) error {
+	return errors.New("redis: connection refused")
+}
+
+func TestRejectReview(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name         string
+		failing      bool
+		wantCode     int
+		wantPending  bool
+		wantErrorKey string
+	}{
+		{name: "cleared", wantCode: 200},
+		{name: "dequarantine fails", failing: true, wantCode: 500, wantPending: true, wantErrorKey: "dequarantine_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, true)
+			var store MonitorStore = env.store
+			if tt.failing {
+				store = dequarantineFailingStore{env.store}
+			}
+			router := newTestRouter(NewTelegramMonitor(env.logic.TelegramLogic, store, env.tracked), &DashboardSession{Operator: "tester", Role: RoleAdmin})
+			now := time.Now()
+			_, _ = env.store.ApplyStrike(ctx, 42, DeletionClassification{RuleID: "r", Verdict: VerdictDefinite}, 5, now, CurrentStrikePolicy())
+			_, _ = env.store.EnqueueReview(ctx, PendingVerdict{TelegramID: 42, QueuedAt: now.Unix(), Score: 5})
+
+			w := serve(router, "POST", "/dashboard/api/review/42/reject", "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantErrorKey != "" {
+				if code := errorCode(t, w); code != tt.wantErrorKey {
+					t.Errorf("error = %s, want %s", code, tt.wantErrorKey)
+				}
+			}
+			pending, _ := env.store.PendingReviews(ctx)
+			if _, ok := pending[42]; ok != tt.wantPending {
+				t.Errorf("pending after reject = %v, want %v", ok, tt.wantPending)
+			}
+			if q, _ := env.store.IsQuarantined(ctx, 42); q != tt.failing {
+				t.Errorf("quarantined = %v, want %v", q, tt.failing)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+// logic/telegram_monitoring_shadow.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+)
+
+// --- SHADOW MODE (Would-Kill Log) ---
+//
+// With StrikePolicy.Mode = "shadow" the kill switch only writes down what it
+// would have done. Later evidence settles each verdict:
+//   - the account answers again        -> false_positive
+//   - it is killed for real / found deleted -> confirmed
+// The ratio tells us what a threshold would cost before we enforce it.
+//
+// Accounts deleted by other means are found by reconciling against the DB
+// (POST /dashboard/api/shadow/reconcile or RunShadowReconciler), never by
+// the GET, so reading the verdicts costs no DB calls and writes nothing.
+
+const (
+	StrikeModeEnforce = "enforce"
+	StrikeModeShadow  = "shadow"
+
+	ShadowOutcomePending       = "pending"
+	ShadowOutcomeFalsePositive = "false_positive"
+	ShadowOutcomeConfirmed     = "confirmed"
+)
+
+type ShadowVerdict struct {
+	TelegramID int64    `json:"id"`
+	At         int64    `json:"ts"`
+	Score      float64  `json:"score"`
+	Threshold  float64  `json:"threshold"`
+	Rule       string   `json:"rule"`
+	WouldDo    []string `json:"would_do"`
+	Outcome    string   `json:"outcome"`
+	OutcomeAt  int64    `json:"outcome_at,omitempty"`
+	OutcomeBy  string   `json:"outcome_by,omitempty"` // which evidence settled it
+}
+
+type ShadowSummary struct {
+	Total             int     `json:"total"`
+	Pending           int     `json:"pending"`
+	FalsePositives    int     `json:"false_positives"`
+	Confirmed         int     `json:"confirmed"`
+	FalsePositiveRate float64 `json:"false_positive_rate"` // of settled verdicts, 0-100
+}
+
+// recordShadowScript writes a verdict unless the ID already has a pending
+// one, in one step so two replicas cannot both record it.
+var recordShadowScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], ARGV[1])
+if cur then
+	local ok, v = pcall(cjson.decode, cur)
+	if ok and v.outcome == ARGV[3] then
+		return 0
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+// settleShadowScript replaces a verdict only if it is still the one the
+// caller read.
+var settleShadowScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+return 1
+`)
+
+const settleShadowAttempts = 3
+
+// recordShadowVerdict logs a would-kill. An ID keeps its first pending
+// verdict; repeated threshold crossings do not pile up duplicates.
+func recordShadowVerdict(ctx context.Context, r redis.Cmdable, v ShadowVerdict) (bool, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	field := strconv.FormatInt(v.TelegramID, 10)
+	n, err := recordShadowScript.Run(ctx, r, []string{keyspace.ShadowVerdicts},
+		field, raw, ShadowOutcomePending, keyspace.ShadowVerdictsTTL.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func loadShadowVerdict(ctx context.Context, r redis.Cmdable, telegramID int64) (*ShadowVerdict, error) {
+	raw, err := r.HGet(ctx, keyspace.ShadowVerdicts, strconv.FormatInt(telegramID, 10)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v ShadowVerdict
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func loadShadowVerdicts(ctx context.Context, r redis.Cmdable) ([]ShadowVerdict, error) {
+	all, err := r.HGetAll(ctx, keyspace.ShadowVerdicts).Result()
+	if err != nil {
+		return nil, err
+	}
+	verdicts := make([]ShadowVerdict, 0, len(all))
+	for _, raw := range all {
+		var v ShadowVerdict
+		if json.Unmarshal([]byte(raw), &v) == nil {
+			verdicts = append(verdicts, v)
+		}
+	}
+	return verdicts, nil
+}
+
+// settleShadowVerdict records the real outcome of a pending verdict, if any.
+// A verdict rewritten between the read and the write is read again.
+func settleShadowVerdict(ctx context.Context, r redis.Cmdable, telegramID int64, outcome, evidence string, at time.Time) (bool, error) {
+	field := strconv.FormatInt(telegramID, 10)
+	for i := 0; i < settleShadowAttempts; i++ {
+		cur, err := r.HGet(ctx, keyspace.ShadowVerdicts, field).Result()
+		if err == redis.Nil {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		var v ShadowVerdict
+		if err := json.Unmarshal([]byte(cur), &v); err != nil {
+			return false, err
+		}
+		if v.Outcome != ShadowOutcomePending {
+			return false, nil
+		}
+		v.Outcome = outcome
+		v.OutcomeAt = at.Unix()
+		v.OutcomeBy = evidence
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return false, err
+		}
+		n, err := settleShadowScript.Run(ctx, r, []string{keyspace.ShadowVerdicts}, field, cur, raw).Int()
+		if err != nil {
+			return false, err
+		}
+		if n == 1 {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("shadow verdict %d kept changing while settling it", telegramID)
+}
+
+// settleShadow settles telegramID's pending verdict through store and logs it.
+func settleShadow(ctx context.Context, store VerdictStore, telegramID int64, outcome, evidence string) {
+	settled, err := store.SettleShadowVerdict(ctx, telegramID, outcome, evidence, time.Now())
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to settle shadow verdict", "telegram_id", telegramID, "error", err)
+		return
+	}
+	if settled {
+		logger.ZSLogger.Infow("shadow verdict settled", "telegram_id", telegramID, "outcome", outcome, "evidence", evidence)
+	}
+}
+
+// ShadowReconcileResponse reports one pass over the pending verdicts.
+type ShadowReconcileResponse struct {
+	Checked   int `json:"checked"`   // pending verdicts looked up in the DB
+	Confirmed int `json:"confirmed"` // found deleted there and settled
+}
+
+// reconcileShadowVerdicts confirms pending verdicts whose account the DB
+// already has as deleted. It makes one DB call per pending verdict.
+func (l TelegramMonitor) reconcileShadowVerdicts(ctx context.Context, store MonitorStore) (ShadowReconcileResponse, error) {
+	var res ShadowReconcileResponse
+	verdicts, err := store.ShadowVerdicts(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	span := opentracing.StartSpan("Logic.TelegramMonitoring.ReconcileShadowVerdicts")
+	defer span.Finish()
+
+	for _, v := range verdicts {
+		if v.Outcome != ShadowOutcomePending {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		res.Checked++
+		identity, err := l.TrackedTelegramUserRepo.GetIdentityByTrackedTelegramID(span, ctx, v.TelegramID)
+		if err != nil || identity == nil || !identity.IsDeleted {
+			continue
+		}
+		settled, err := store.SettleShadowVerdict(ctx, v.TelegramID, ShadowOutcomeConfirmed, "db_is_deleted", time.Now())
+		if err != nil {
+			logger.ZSLogger.Errorw("failed to settle shadow verdict", "telegram_id", v.TelegramID, "error", err)
+			continue
+		}
+		if settled {
+			res.Confirmed++
+			logger.ZSLogger.Infow("shadow verdict settled", "telegram_id", v.TelegramID, "outcome", ShadowOutcomeConfirmed, "evidence", "db_is_deleted")
+		}
+	}
+	return res, nil
+}
+
+// RunShadowReconciler reconciles pending shadow verdicts against the DB
+// every interval until ctx ends.
+func (l TelegramMonitor) RunShadowReconciler(ctx context.Context, interval time.Duration) {
+	store := l.monitorStore()
+	if store == nil {
+		logger.ZSLogger.Warn("shadow reconciler not started: telemetry service is nil")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := l.reconcileShadowVerdicts(ctx, store); err != nil && ctx.Err() == nil {
+					logger.ZSLogger.Errorw("failed to reconcile shadow verdicts", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func summarizeShadowVerdicts(verdicts []ShadowVerdict) ShadowSummary {
+	s := ShadowSummary{Total: len(verdicts)}
+	for _, v := range verdicts {
+		switch v.Outcome {
+		case ShadowOutcomePending:
+			s.Pending++
+		case ShadowOutcomeFalsePositive:
+			s.FalsePositives++
+		case ShadowOutcomeConfirmed:
+			s.Confirmed++
+		}
+	}
+	if settled := s.FalsePositives + s.Confirmed; settled > 0 {
+		s.FalsePositiveRate = float64(s.FalsePositives) / float64(settled) * 100
+	}
+	return s
+}
+
+// --- HTTP HANDLERS ---
+
+// ShadowVerdictsResponse lists shadow-mode would-kills, newest first.
+type ShadowVerdictsResponse struct {
+	Mode     string          `json:"mode"`
+	Summary  ShadowSummary   `json:"summary"`
+	Verdicts []ShadowVerdict `json:"verdicts"`
+}
+
+// GET /dashboard/api/shadow
+func (l TelegramMonitor) ServeShadowVerdicts(c *gin.Context) {
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	ctx := c.Request.Context()
+
+	verdicts, err := store.ShadowVerdicts(ctx)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read shadow verdicts", "error", err)
+		abortWithError(c, newAPIError(500, "shadow_read_failed", "could not read shadow verdicts"))
+		return
+	}
+	sort.Slice(verdicts, func(i, j int) bool { return verdicts[i].At > verdicts[j].At })
+
+	c.JSON(200, ShadowVerdictsResponse{
+		Mode:     CurrentStrikePolicy().Mode,
+		Summary:  summarizeShadowVerdicts(verdicts),
+		Verdicts: verdicts,
+	})
+}
+
+// POST /dashboard/api/shadow/reconcile
+func (l TelegramMonitor) ReconcileShadowVerdicts(c *gin.Context) {
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	res, err := l.reconcileShadowVerdicts(c.Request.Context(), store)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to reconcile shadow verdicts", "error", err)
+		abortWithError(c, newAPIError(500, "shadow_reconcile_failed", "could not reconcile shadow verdicts").With("checked", res.Checked))
+		return
+	}
+	c.JSON(200, res)
+}
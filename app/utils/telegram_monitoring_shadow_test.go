@@ -0,0 +1,39 @@
+// logic/telegram_monitoring_shadow_test.go
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+)
+
+func TestRedisShadowVerdicts(t *testing.T) {
+	ctx := context.Background()
+	_, r := newSnapshotRedis(t)
+	store := NewRedisMonitorStore(r)
+	first := ShadowVerdict{TelegramID: 42, At: 1, Outcome: ShadowOutcomePending}
+
+	if ok, err := store.RecordShadowVerdict(ctx, first); !ok || err != nil {
+		t.Fatalf("record = %v, %v", ok, err)
+	}
+	if ok, _ := store.RecordShadowVerdict(ctx, ShadowVerdict{TelegramID: 42, At: 2, Outcome: ShadowOutcomePending}); ok {
+		t.Error("a second pending verdict replaced the first")
+	}
+	if ok, err := store.SettleShadowVerdict(ctx, 42, ShadowOutcomeFalsePositive, "heal", time.Unix(3, 0)); !ok || err != nil {
+		t.Fatalf("settle = %v, %v", ok, err)
+	}
+	if ok, _ := store.SettleShadowVerdict(ctx, 42, ShadowOutcomeConfirmed, "kill_switch", time.Unix(4, 0)); ok {
+		t.Error("a settled verdict was settled again")
+	}
+	if ok, _ := store.RecordShadowVerdict(ctx, ShadowVerdict{TelegramID: 42, At: 5, Outcome: ShadowOutcomePending}); !ok {
+		t.Error("a settled verdict blocked a new one")
+	}
+	if ttl := r.PTTL(ctx, keyspace.ShadowVerdicts).Val(); ttl <= 0 {
+		t.Errorf("shadow verdicts ttl = %v", ttl)
+	}
+}
+
+// The INFO half of the check needs a real server; miniredis has no cluster
+// section.
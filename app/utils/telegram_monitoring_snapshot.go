@@ -0,0 +1,517 @@
+// logic/telegram_monitoring_snapshot.go
+package logic
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- MONITOR SNAPSHOTS ---
+//
+// A snapshot is every monitor:* key, with its value and remaining TTL, as
+// gzipped JSON lines: one header line, then one line per key. Values are
+// read by type (not DUMP), so the file is readable and portable across
+// Redis versions.
+//
+// The header carries two versions: Version is the file layout (bumped if
+// the line format changes), SchemaVersion the keyspace it was taken from.
+// RestoreSnapshot refuses files newer than this build on either count.
+//
+// TTLs are stored as they were when the snapshot was taken; a restore
+// starts them counting again from that value.
+//
+// A restore reads and checks the whole file before writing: every key must
+// match a keyspace.Schema pattern (and, for a current-schema file, its
+// type). A file that fails the check writes nothing; a Redis error after
+// that leaves the keys restored so far in place and says so in the report.
+
+const (
+	snapshotFormat        = "monitor-snapshot"
+	snapshotFormatVersion = 1
+	snapshotScanCount     = 500
+	// snapshotUploadMaxBytes caps an uploaded (gzipped) snapshot;
+	// snapshotMaxInflatedBytes caps what any snapshot inflates to, since a
+	// restore holds the whole file in memory while checking it.
+	snapshotUploadMaxBytes   = 64 << 20
+	snapshotMaxInflatedBytes = 512 << 20
+
+	AuditActionSnapshotExport  = "snapshot.export"
+	AuditActionSnapshotRestore = "snapshot.restore"
+)
+
+type snapshotHeader struct {
+	Format        string `json:"format"`
+	Version       int    `json:"version"`
+	SchemaVersion int    `json:"schema_version"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+type snapshotEntry struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	TTLMs int64           `json:"ttl_ms,omitempty"` // 0 = no expiry
+	Value json.RawMessage `json:"value"`
+}
+
+type snapshotZMember struct {
+	Member string  `json:"m"`
+	Score  float64 `json:"s"`
+}
+
+type SnapshotInfo struct {
+	Path      string `json:"path,omitempty"`
+	Keys      int    `json:"keys"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+var snapshotDir struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// SetSnapshotDir sets where snapshot files go. Default: <tmp>/monitor-snapshots.
+func SetSnapshotDir(dir string) {
+	snapshotDir.mu.Lock()
+	snapshotDir.dir = dir
+	snapshotDir.mu.Unlock()
+}
+
+func currentSnapshotDir() string {
+	snapshotDir.mu.RLock()
+	defer snapshotDir.mu.RUnlock()
+	if snapshotDir.dir != "" {
+		return snapshotDir.dir
+	}
+	return filepath.Join(os.TempDir(), "monitor-snapshots")
+}
+
+// snapshotToFile writes a snapshot of monitor:* into the snapshot dir.
+func snapshotToFile(ctx context.Context, r redis.Cmdable) (SnapshotInfo, error) {
+	dir := currentSnapshotDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return SnapshotInfo{}, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("monitor-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	info, err := WriteSnapshot(ctx, r, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return SnapshotInfo{}, err
+	}
+	info.Path = path
+	return info, nil
+}
+
+// WriteSnapshot streams every monitor:* key to w.
+func WriteSnapshot(ctx context.Context, r redis.Cmdable, w io.Writer) (SnapshotInfo, error) {
+	info := SnapshotInfo{CreatedAt: time.Now().Unix()}
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(snapshotHeader{Format: snapshotFormat, Version: snapshotFormatVersion, SchemaVersion: keyspace.SchemaVersion, CreatedAt: info.CreatedAt}); err != nil {
+		return info, err
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := r.Scan(ctx, cursor, keyspace.All, snapshotScanCount).Result()
+		if err != nil {
+			return info, err
+		}
+		for _, key := range keys {
+			entry, ok, err := readSnapshotEntry(ctx, r, key)
+			if err != nil {
+				return info, fmt.Errorf("snapshot %s: %w", key, err)
+			}
+			if !ok {
+				continue // expired while we scanned
+			}
+			if err := enc.Encode(entry); err != nil {
+				return info, err
+			}
+			info.Keys++
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return info, zw.Close()
+}
+
+func readSnapshotEntry(ctx context.Context, r redis.Cmdable, key string) (snapshotEntry, bool, error) {
+	entry := snapshotEntry{Key: key}
+	kind, err := r.Type(ctx, key).Result()
+	if err != nil || kind == "none" {
+		return entry, false, err
+	}
+	entry.Type = kind
+
+	var value interface{}
+	switch kind {
+	case "string":
+		value, err = r.Get(ctx, key).Result()
+	case "list":
+		value, err = r.LRange(ctx, key, 0, -1).Result()
+	case "set":
+		value, err = r.SMembers(ctx, key).Result()
+	case "hash":
+		value, err = r.HGetAll(ctx, key).Result()
+	case "zset":
+		var zs []redis.Z
+		zs, err = r.ZRangeWithScores(ctx, key, 0, -1).Result()
+		members := make([]snapshotZMember, len(zs))
+		for i, z := range zs {
+			members[i] = snapshotZMember{Member: fmt.Sprint(z.Member), Score: z.Score}
+		}
+		value = members
+	default:
+		return entry, false, fmt.Errorf("unsupported type %q", kind)
+	}
+	if err == redis.Nil {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+	if entry.Value, err = json.Marshal(value); err != nil {
+		return entry, false, err
+	}
+
+	if ttl, err := r.PTTL(ctx, key).Result(); err == nil && ttl > 0 {
+		entry.TTLMs = ttl.Milliseconds()
+	}
+	return entry, true, nil
+}
+
+// --- Restore ---
+
+type RestoreOptions struct {
+	// Replace overwrites keys that already exist; otherwise they are skipped.
+	Replace bool
+}
+
+type RestoreReport struct {
+	Version       int   `json:"version"`
+	SchemaVersion int   `json:"schema_version"`
+	CreatedAt     int64 `json:"created_at"`
+	Restored      int   `json:"restored"`
+	Skipped       int   `json:"skipped"` // already present and Replace was off
+	// Partial is set when the restore failed after writing some keys; the
+	// Restored keys are in Redis, the rest of the file is not.
+	Partial bool `json:"partial"`
+}
+
+// InvalidSnapshotError is a file RestoreSnapshot refused before writing
+// anything. Any other error came from Redis.
+type InvalidSnapshotError struct {
+	Err error
+}
+
+func (e InvalidSnapshotError) Error() string { return e.Err.Error() }
+func (e InvalidSnapshotError) Unwrap() error { return e.Err }
+
+func invalidSnapshot(format string, args ...interface{}) error {
+	return InvalidSnapshotError{Err: fmt.Errorf(format, args...)}
+}
+
+// snapshotWrite restores one entry inside its MULTI.
+type snapshotWrite func(ctx context.Context, pipe redis.Pipeliner)
+
+// RestoreSnapshot loads a snapshot written by WriteSnapshot into r. Each key
+// is written in one MULTI (value and TTL together). A snapshot from an older
+// schema restores as-is; run the migrations (MigrateQuarantine) afterwards.
+func RestoreSnapshot(ctx context.Context, r redis.Cmdable, rd io.Reader, opts RestoreOptions) (RestoreReport, error) {
+	var report RestoreReport
+	zr, err := gzip.NewReader(rd)
+	if err != nil {
+		return report, invalidSnapshot("snapshot: %w", err)
+	}
+	defer zr.Close()
+	inflated := &io.LimitedReader{R: zr, N: snapshotMaxInflatedBytes + 1}
+	dec := json.NewDecoder(inflated)
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return report, invalidSnapshot("snapshot header: %w", err)
+	}
+	if header.Format != snapshotFormat {
+		return report, invalidSnapshot("snapshot: not a %s file (format %q)", snapshotFormat, header.Format)
+	}
+	if header.Version < 1 || header.Version > snapshotFormatVersion {
+		return report, invalidSnapshot("snapshot: format version %d, this build reads up to %d", header.Version, snapshotFormatVersion)
+	}
+	if header.SchemaVersion > keyspace.SchemaVersion {
+		return report, invalidSnapshot("snapshot: schema version %d is newer than this build's %d", header.SchemaVersion, keyspace.SchemaVersion)
+	}
+	report.Version = header.Version
+	report.SchemaVersion = header.SchemaVersion
+	report.CreatedAt = header.CreatedAt
+
+	// Check the whole file first, so a bad line cannot leave half of it
+	// restored.
+	var entries []snapshotEntry
+	var writes []snapshotWrite
+	for {
+		var entry snapshotEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if inflated.N <= 0 {
+			return report, invalidSnapshot("snapshot: more than %d bytes uncompressed", snapshotMaxInflatedBytes)
+		}
+		if err != nil {
+			return report, invalidSnapshot("snapshot entry %d: %w", len(entries)+1, err)
+		}
+		write, err := decodeSnapshotEntry(entry, header.SchemaVersion)
+		if err != nil {
+			return report, invalidSnapshot("snapshot entry %d (%s): %w", len(entries)+1, entry.Key, err)
+		}
+		entries = append(entries, entry)
+		writes = append(writes, write)
+	}
+
+	for i, entry := range entries {
+		if !opts.Replace {
+			n, err := r.Exists(ctx, entry.Key).Result()
+			if err != nil {
+				report.Partial = report.Restored > 0
+				return report, err
+			}
+			if n > 0 {
+				report.Skipped++
+				continue
+			}
+		}
+		if err := restoreSnapshotEntry(ctx, r, entry, writes[i]); err != nil {
+			report.Partial = report.Restored > 0
+			return report, fmt.Errorf("restore %s: %w", entry.Key, err)
+		}
+		report.Restored++
+	}
+	return report, nil
+}
+
+// decodeSnapshotEntry checks e against the keyspace and returns the write
+// that restores it, nil for an empty value. Types are only checked against
+// a current-schema file; an older one may hold keys in their old shape.
+func decodeSnapshotEntry(e snapshotEntry, schemaVersion int) (snapshotWrite, error) {
+	spec := keyspace.Lookup(e.Key)
+	if spec == nil {
+		return nil, fmt.Errorf("key %q matches no monitor key family", e.Key)
+	}
+	if schemaVersion == keyspace.SchemaVersion && e.Type != string(spec.Type) {
+		return nil, fmt.Errorf("%s keys are %s, not %s", spec.Name, spec.Type, e.Type)
+	}
+
+	switch e.Type {
+	case "string":
+		var v string
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, pipe redis.Pipeliner) { pipe.Set(ctx, e.Key, v, 0) }, nil
+	case "list", "set":
+		var v []string
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		if len(items) == 0 {
+			return nil, nil
+		}
+		if e.Type == "list" {
+			return func(ctx context.Context, pipe redis.Pipeliner) { pipe.RPush(ctx, e.Key, items...) }, nil
+		}
+		return func(ctx context.Context, pipe redis.Pipeliner) { pipe.SAdd(ctx, e.Key, items...) }, nil
+	case "hash":
+		var v map[string]string
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return nil, err
+		}
+		if len(v) == 0 {
+			return nil, nil
+		}
+		return func(ctx context.Context, pipe redis.Pipeliner) { pipe.HSet(ctx, e.Key, v) }, nil
+	case "zset":
+		var v []snapshotZMember
+		if err := json.Unmarshal(e.Value, &v); err != nil {
+			return nil, err
+		}
+		zs := make([]*redis.Z, len(v))
+		for i, m := range v {
+			zs[i] = &redis.Z{Member: m.Member, Score: m.Score}
+		}
+		if len(zs) == 0 {
+			return nil, nil
+		}
+		return func(ctx context.Context, pipe redis.Pipeliner) { pipe.ZAdd(ctx, e.Key, zs...) }, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", e.Type)
+}
+
+func restoreSnapshotEntry(ctx context.Context, r redis.Cmdable, e snapshotEntry, write snapshotWrite) error {
+	if write == nil {
+		return nil
+	}
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, e.Key)
+		write(ctx, pipe)
+		if e.TTLMs > 0 {
+			pipe.PExpire(ctx, e.Key, time.Duration(e.TTLMs)*time.Millisecond)
+		}
+		return nil
+	})
+	return err
+}
+
+// --- Command ---
+
+// RunSnapshotCommand is `monitor snapshot`:
+//
+//	monitor snapshot export [-o file]              (default: stdout)
+//	monitor snapshot restore [-i file] [-replace]  (default: stdin)
+func RunSnapshotCommand(ctx context.Context, r redis.Cmdable, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: monitor snapshot export|restore [flags]")
+	}
+	fs := flag.NewFlagSet("monitor snapshot "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stdout)
+
+	switch args[0] {
+	case "export":
+		out := fs.String("o", "", "write the snapshot to this file instead of stdout")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		w := stdout
+		if *out != "" {
+			f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		info, err := WriteSnapshot(ctx, r, w)
+		if err != nil {
+			return err
+		}
+		if *out != "" {
+			fmt.Fprintf(stdout, "exported %d keys to %s\n", info.Keys, *out)
+		}
+		return nil
+
+	case "restore":
+		in := fs.String("i", "", "read the snapshot from this file instead of stdin")
+		replace := fs.Bool("replace", false, "overwrite keys that already exist")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		rd := stdin
+		if *in != "" {
+			f, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			rd = f
+		}
+		report, err := RestoreSnapshot(ctx, r, rd, RestoreOptions{Replace: *replace})
+		if report.Partial {
+			fmt.Fprintf(stdout, "partial restore: %d keys written before the error\n", report.Restored)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "restored %d keys, skipped %d existing (schema version %d)\n", report.Restored, report.Skipped, report.SchemaVersion)
+		return nil
+	}
+	return fmt.Errorf("monitor snapshot: unknown subcommand %q", args[0])
+}
+
+// --- HTTP HANDLERS ---
+
+// GET /dashboard/api/admin/snapshot
+func (l TelegramMonitor) ExportSnapshot(c *gin.Context) {
+	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	name := fmt.Sprintf("monitor-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Status(200)
+
+	info, err := WriteSnapshot(c.Request.Context(), l.Telemetry.MonitorRedis, c.Writer)
+	if err != nil {
+		// Headers are gone already; the truncated gzip stream tells the client.
+		logger.ZSLogger.Errorw("snapshot export failed", "keys", info.Keys, "error", err)
+		return
+	}
+	l.auditRequest(c, AuditActionSnapshotExport, keyspace.All, nil, gin.H{"keys": info.Keys})
+}
+
+// RestoreSnapshotRequest is POST /dashboard/api/admin/snapshot/restore.
+type RestoreSnapshotRequest struct {
+	Replace bool `query:"replace"` // overwrite keys that already exist
+}
+
+// POST /dashboard/api/admin/snapshot/restore?replace=1 (body: the .jsonl.gz file)
+func (l TelegramMonitor) RestoreSnapshotUpload(c *gin.Context) {
+	var req RestoreSnapshotRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, snapshotUploadMaxBytes)
+	report, err := RestoreSnapshot(c.Request.Context(), l.Telemetry.MonitorRedis, body, RestoreOptions{Replace: req.Replace})
+	var tooLarge *http.MaxBytesError
+	var invalid InvalidSnapshotError
+	switch {
+	case err == nil:
+	case stderrors.As(err, &tooLarge):
+		abortWithError(c, newAPIError(413, "snapshot_too_large", "snapshot uploads are limited to %d bytes", snapshotUploadMaxBytes))
+		return
+	case stderrors.As(err, &invalid):
+		abortWithError(c, newAPIError(400, "invalid_snapshot", "%s", err))
+		return
+	default:
+		logger.ZSLogger.Errorw("snapshot restore failed", "restored", report.Restored, "partial", report.Partial, "error", err)
+		if report.Partial {
+			l.auditRequest(c, AuditActionSnapshotRestore, keyspace.All, nil, report)
+		}
+		abortWithError(c, newAPIError(500, "restore_failed", "restore stopped on a Redis error after %d keys", report.Restored).With("report", report))
+		return
+	}
+	l.auditRequest(c, AuditActionSnapshotRestore, keyspace.All, nil, report)
+	c.JSON(200, report)
+}
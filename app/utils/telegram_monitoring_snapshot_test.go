@@ -0,0 +1,280 @@
+// logic/telegram_monitoring_snapshot_test.go
+package logic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newSnapshotRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { r.Close() })
+	return mr, r
+}
+
+// seedMonitor writes one key of every kind the dashboard keeps.
+func seedMonitor(t *testing.T, r *redis.Client) {
+	t.Helper()
+	ctx := context.Background()
+	minute := time.Now().Unix() / 60
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(r.Set(ctx, keyspace.GlobalHits, 1234, 0).Err())
+	must(r.Set(ctx, keyspace.GlobalErrors, 56, 0).Err())
+	must(r.Set(ctx, keyspace.HitsMinute(minute), 10, time.Hour).Err())
+	must(r.Set(ctx, keyspace.ErrorsMinute(minute), 2, time.Hour).Err())
+	must(r.Set(ctx, keyspace.ErrorCodeMinute(CodePeerIDInvalid, minute), 1, keyspace.ErrorCodeSeriesTTL).Err())
+	must(r.RPush(ctx, keyspace.LiveFeed, `{"tg":1}`, `{"tg":2}`, `{"tg":3}`).Err())
+	must(r.ZAdd(ctx, keyspace.Quarantine, &redis.Z{Score: 1700000000, Member: "42"}, &redis.Z{Score: 1700000100, Member: "43"}).Err())
+	must(r.HSet(ctx, keyspace.QuarantineMeta, "42", `{"entered_at":1700000000}`).Err())
+	must(r.HSet(ctx, keyspace.Strikes(42), "score", "2.5", "ts", "1700000000000").Err())
+	must(r.Expire(ctx, keyspace.Strikes(42), 24*time.Hour).Err())
+	must(r.SAdd(ctx, keyspace.Watchlist, "42", "7").Err())
+	must(r.RPush(ctx, keyspace.History(42), "a", "b", "c").Err())
+	must(r.Expire(ctx, keyspace.History(42), 48*time.Hour).Err())
+	must(r.SAdd(ctx, keyspace.MapU2T(42), "9").Err())
+	must(r.SAdd(ctx, keyspace.MapT2U(9), "42").Err())
+	// Outside monitor:*, must not be exported.
+	must(r.Set(ctx, "dashboard:session:abc", "x", 0).Err())
+}
+
+type keyState struct {
+	Type  string
+	Value interface{}
+	TTL   bool
+}
+
+func dumpMonitor(t *testing.T, r *redis.Client) map[string]keyState {
+	t.Helper()
+	ctx := context.Background()
+	keys, err := r.Keys(ctx, keyspace.All).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]keyState{}
+	for _, k := range keys {
+		e, ok, err := readSnapshotEntry(ctx, r, k)
+		if err != nil || !ok {
+			t.Fatalf("read %s: ok=%v err=%v", k, ok, err)
+		}
+		var v interface{}
+		_ = json.Unmarshal(e.Value, &v)
+		if list, isList := v.([]interface{}); isList && e.Type == "set" {
+			strs := make([]string, len(list))
+			for i, s := range list {
+				strs[i] = s.(string)
+			}
+			sort.Strings(strs) // SMEMBERS order is arbitrary
+			v = strs
+		}
+		out[k] = keyState{Type: e.Type, Value: v, TTL: e.TTLMs > 0}
+	}
+	return out
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newSnapshotRedis(t)
+	seedMonitor(t, r)
+	want := dumpMonitor(t, r)
+
+	var buf bytes.Buffer
+	info, err := WriteSnapshot(ctx, r, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Keys != len(want) {
+		t.Fatalf("exported %d keys, want %d", info.Keys, len(want))
+	}
+
+	mr.FlushAll()
+	report, err := RestoreSnapshot(ctx, r, &buf, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Restored != len(want) || report.Skipped != 0 {
+		t.Fatalf("report = %+v, want %d restored", report, len(want))
+	}
+	if report.SchemaVersion != keyspace.SchemaVersion {
+		t.Errorf("schema version = %d, want %d", report.SchemaVersion, keyspace.SchemaVersion)
+	}
+
+	got := dumpMonitor(t, r)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch\n got: %v\nwant: %v", got, want)
+	}
+	if mr.Exists("dashboard:session:abc") {
+		t.Error("snapshot leaked a key outside monitor:*")
+	}
+	if ttl := mr.TTL(keyspace.Strikes(42)); ttl <= 23*time.Hour || ttl > 24*time.Hour {
+		t.Errorf("strikes TTL = %v, want ~24h", ttl)
+	}
+}
+
+func TestRestoreSnapshotExistingKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		replace   bool
+		wantHits  string
+		wantSkips int
+	}{
+		{"skip by default", false, "999", 1},
+		{"replace", true, "1234", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, r := newSnapshotRedis(t)
+			if err := r.Set(ctx, keyspace.GlobalHits, 1234, 0).Err(); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if _, err := WriteSnapshot(ctx, r, &buf); err != nil {
+				t.Fatal(err)
+			}
+			r.Set(ctx, keyspace.GlobalHits, 999, 0)
+
+			report, err := RestoreSnapshot(ctx, r, &buf, RestoreOptions{Replace: tt.replace})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Skipped != tt.wantSkips {
+				t.Errorf("skipped = %d, want %d", report.Skipped, tt.wantSkips)
+			}
+			if got := r.Get(ctx, keyspace.GlobalHits).Val(); got != tt.wantHits {
+				t.Errorf("hits = %s, want %s", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshotRejects(t *testing.T) {
+	line := func(key, kind, value string) string {
+		return fmt.Sprintf(`{"key":%q,"type":%q,"value":%s}`, key, kind, value)
+	}
+	hitsLine := line(keyspace.GlobalHits, "string", `"1"`)
+	gz := func(lines ...string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(strings.Join(lines, "\n")))
+		zw.Close()
+		return &buf
+	}
+	tests := []struct {
+		name  string
+		input *bytes.Buffer
+		want  string
+	}{
+		{"not gzip", bytes.NewBufferString("hello"), "snapshot"},
+		{"wrong format", gz(`{"format":"other","version":1}`), "not a monitor-snapshot"},
+		{"newer format", gz(`{"format":"monitor-snapshot","version":99,"schema_version":1}`), "format version 99"},
+		{"newer schema", gz(`{"format":"monitor-snapshot","version":1,"schema_version":99}`), "schema version 99"},
+		{"bad type", gz(`{"format":"monitor-snapshot","version":1,"schema_version":1}`, line(keyspace.GlobalHits, "stream", `[]`)), "unsupported type"},
+		// A valid key first: a bad line later must not leave it written.
+		{"unknown key", gz(`{"format":"monitor-snapshot","version":1,"schema_version":2}`, hitsLine, line("monitor:x", "string", `"1"`)), "matches no monitor key family"},
+		{"outside monitor", gz(`{"format":"monitor-snapshot","version":1,"schema_version":2}`, hitsLine, line("dashboard:session:abc", "string", `"x"`)), "matches no monitor key family"},
+		{"wrong type", gz(`{"format":"monitor-snapshot","version":1,"schema_version":2}`, hitsLine, line(keyspace.Quarantine, "set", `["42"]`)), "quarantine keys are zset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, r := newSnapshotRedis(t)
+			report, err := RestoreSnapshot(context.Background(), r, tt.input, RestoreOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.want)
+			}
+			var invalid InvalidSnapshotError
+			if !errors.As(err, &invalid) {
+				t.Errorf("err = %T, want an InvalidSnapshotError", err)
+			}
+			if keys := mr.Keys(); len(keys) != 0 || report.Restored != 0 || report.Partial {
+				t.Errorf("a rejected file wrote %v (report %+v)", keys, report)
+			}
+		})
+	}
+}
+
+// failPipelinesAfter lets n MULTIs through, then fails every one after.
+type failPipelinesAfter struct {
+	n int
+}
+
+func (h *failPipelinesAfter) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *failPipelinesAfter) AfterProcess(context.Context, redis.Cmder) error { return nil }
+
+func (h *failPipelinesAfter) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	if h.n == 0 {
+		return ctx, errors.New("connection reset")
+	}
+	h.n--
+	return ctx, nil
+}
+
+func (h *failPipelinesAfter) AfterProcessPipeline(context.Context, []redis.Cmder) error { return nil }
+
+func TestRestoreSnapshotPartial(t *testing.T) {
+	ctx := context.Background()
+	_, r := newSnapshotRedis(t)
+	seedMonitor(t, r)
+	var buf bytes.Buffer
+	if _, err := WriteSnapshot(ctx, r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	r.FlushAll(ctx)
+	r.AddHook(&failPipelinesAfter{n: 2})
+
+	report, err := RestoreSnapshot(ctx, r, &buf, RestoreOptions{})
+	var invalid InvalidSnapshotError
+	if err == nil || errors.As(err, &invalid) {
+		t.Fatalf("err = %v, want the Redis error", err)
+	}
+	if report.Restored != 2 || !report.Partial {
+		t.Errorf("report = %+v, want 2 keys restored and partial", report)
+	}
+}
+
+func TestRunSnapshotCommand(t *testing.T) {
+	ctx := context.Background()
+	mr, r := newSnapshotRedis(t)
+	seedMonitor(t, r)
+	want := dumpMonitor(t, r)
+	path := filepath.Join(t.TempDir(), "monitor.jsonl.gz")
+
+	var out bytes.Buffer
+	if err := RunSnapshotCommand(ctx, r, []string{"export", "-o", path}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	mr.FlushAll()
+	if err := RunSnapshotCommand(ctx, r, []string{"restore", "-i", path}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := dumpMonitor(t, r); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip through files mismatch\n got: %v\nwant: %v", got, want)
+	}
+	if err := RunSnapshotCommand(ctx, r, []string{"frobnicate"}, nil, &out); err == nil {
+		t.Error("unknown subcommand accepted")
+	}
+}
@@ -0,0 +1,524 @@
+// logic/telegram_monitoring_store.go
+package logic
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+)
+
+// --- MONITOR STORE ---
+//
+// MonitorStore is everything the dashboard handlers and the strike logic
+// keep in monitor state: stats, quarantine, strikes, watchlist, history,
+// relation maps, and what the kill switch writes next to them (review
+// queue, shadow verdicts, kill verdicts, reset jobs). Nothing outside this
+// file and the implementations touches go-redis for those.
+//
+// Implementations: RedisMonitorStore on Telemetry.MonitorRedis for
+// production, MemoryMonitorStore for tests and local runs. The store is
+// injected through NewTelegramMonitor; TelegramLogic's own entry points run
+// on the Redis one.
+//
+// The admin tools that work on Redis itself (snapshots, keys audit,
+// quarantine migration) and the audit log stay on the client directly.
+//
+// The store needs a single Redis node (replicas or Sentinel are fine), not
+// Redis Cluster. Its scripts and transactions span several keys at once: a
+// strike updates the ID's strikes and signals together with the global
+// quarantine, watchlist and meta keys. On a cluster those hash to different
+// slots and fail with CROSSSLOT; hash-tagging them into one slot would put
+// the whole monitor on one node anyway. A cluster client gets no store, and
+// CheckSingleNodeRedis catches a plain client pointed at a cluster.
+
+// MonitorStore is every concern together; implementations provide all of
+// them. Code that needs one concern takes the narrower interface.
+type MonitorStore interface {
+	StatsStore
+	InspectStore
+	StrikeStore
+	ReviewStore
+	VerdictStore
+	ResetStore
+	FeedStore
+
+	// Leases is the locker verdict execution runs under.
+	Leases() LeaseLocker
+}
+
+// StatsStore backs /dashboard/api/stats.
+type StatsStore interface {
+	// Stats reads counters, feed, worst trackers and traffic series in one go.
+	Stats(ctx context.Context, q StatsQuery) (MonitorStats, error)
+	// ErrorCodeSeries is the last `minutes` per-minute counts for code, oldest first.
+	ErrorCodeSeries(ctx context.Context, code string, minutes int, now time.Time) ([]int64, error)
+	RecordErrorCode(ctx context.Context, code string, now time.Time) error
+}
+
+// InspectStore backs the inspector: watchlist, history and relations.
+type InspectStore interface {
+	IsWatched(ctx context.Context, telegramID int64) (bool, error)
+	SetWatched(ctx context.Context, telegramID int64, watched bool) error
+
+	// History is the deep log of one ID as raw JSON, newest first.
+	History(ctx context.Context, telegramID int64, limit int64) ([]string, error)
+	// Relations returns the trackers of a user and the users of a tracker.
+	Relations(ctx context.Context, telegramID int64) (trackers, users []string, err error)
+}
+
+// StrikeStore is the strike state and quarantine.
+type StrikeStore interface {
+	// Quarantine lists everyone in quarantine, newest first.
+	Quarantine(ctx context.Context) ([]QuarantineEntry, error)
+	IsQuarantined(ctx context.Context, telegramID int64) (bool, error)
+	// Dequarantine drops the entry together with its strikes and signals.
+	Dequarantine(ctx context.Context, telegramID int64) error
+
+	// ApplyStrike and ApplyHeal are the atomic strike transitions. ApplyHeal
+	// returns HealNone, HealLowered or HealCleared and the new score.
+	ApplyStrike(ctx context.Context, telegramID int64, match DeletionClassification, weight float64, now time.Time, policy StrikePolicy) (StrikeTransition, error)
+	ApplyHeal(ctx context.Context, telegramID int64, now time.Time, policy StrikePolicy) (string, float64, error)
+	// LoadStrikes returns the score and newest signals of each ID, in order.
+	LoadStrikes(ctx context.Context, telegramIDs []int64, signals int64) ([]StrikeRecord, error)
+	ClaimKill(ctx context.Context, telegramID int64, token string, ttl time.Duration) (bool, error)
+	ReleaseKillClaim(ctx context.Context, telegramID int64) error
+}
+
+// ReviewStore is the queue of verdicts waiting for an operator.
+type ReviewStore interface {
+	// EnqueueReview keeps an ID's original place; ClaimReview returns nil
+	// when the verdict was already decided.
+	EnqueueReview(ctx context.Context, v PendingVerdict) (bool, error)
+	ClaimReview(ctx context.Context, telegramID int64) (*PendingVerdict, error)
+	PendingReviews(ctx context.Context) (map[int64]PendingVerdict, error)
+}
+
+// VerdictStore keeps what the kill switch did (kill verdicts) or would
+// have done (shadow verdicts).
+type VerdictStore interface {
+	// RecordShadowVerdict keeps an ID's first pending verdict.
+	RecordShadowVerdict(ctx context.Context, v ShadowVerdict) (bool, error)
+	// SettleShadowVerdict reports false when there was no pending verdict.
+	SettleShadowVerdict(ctx context.Context, telegramID int64, outcome, evidence string, at time.Time) (bool, error)
+	ShadowVerdicts(ctx context.Context) ([]ShadowVerdict, error)
+
+	SaveVerdict(ctx context.Context, v VerdictRecord) error
+	LoadVerdict(ctx context.Context, id string) (*VerdictRecord, error)
+	// Verdicts lists kill verdicts, newest first.
+	Verdicts(ctx context.Context) ([]VerdictRecord, error)
+	// ClaimRestore marks a verdict as being restored by actor; false means
+	// someone got there first. ReleaseRestore hands the claim back.
+	ClaimRestore(ctx context.Context, id, actor string) (bool, error)
+	ReleaseRestore(ctx context.Context, id string) error
+	MarkRestored(ctx context.Context, id string, at int64) error
+}
+
+// ResetStore runs monitor resets and keeps their jobs.
+type ResetStore interface {
+	// Reset deletes what job.Scope covers, updating job's counters (and
+	// saving its progress) as it goes.
+	Reset(ctx context.Context, job *ResetJob) error
+	SaveResetJob(ctx context.Context, job *ResetJob) error
+	LoadResetJob(ctx context.Context, id string) (*ResetJob, error)
+	IssueResetConfirmation(ctx context.Context, actor string) (string, error)
+	ConsumeResetConfirmation(ctx context.Context, token, actor string) (bool, error)
+}
+
+// FeedStore is the live event stream behind /dashboard/api/stream.
+type FeedStore interface {
+	// PublishEvent appends to the live event stream and returns its ID.
+	// EventsAfter returns up to count events after the ID, oldest first,
+	// waiting up to block for one to arrive.
+	PublishEvent(ctx context.Context, e MonitorEvent) (string, error)
+	EventsAfter(ctx context.Context, after string, count int64, block time.Duration) ([]MonitorEvent, error)
+	EventStreamInfo(ctx context.Context) (EventStreamInfo, error)
+}
+
+// monitorSnapshotter is implemented by stores that can write a snapshot
+// file; an "all" reset takes one first when it can.
+type monitorSnapshotter interface {
+	Snapshot(ctx context.Context) (SnapshotInfo, error)
+}
+
+type StatsQuery struct {
+	Now       time.Time
+	Minutes   int // traffic series length
+	FeedLimit int64
+	WorstN    int64
+}
+
+// MonitorStats is the raw material of /dashboard/api/stats.
+type MonitorStats struct {
+	Hits          int64
+	Errors        int64
+	Feed          []string // raw JSON, newest first
+	WorstTrackers []TrackerScore
+	HitSeries     []int64 // per minute, oldest first
+	ErrorSeries   []int64
+	ErrorsByCode  map[string]int64
+}
+
+// TrackerScore is one row of the worst-trackers panel. The field names are
+// what the panel got from go-redis' Z before the store existed.
+type TrackerScore struct {
+	Score  float64
+	Member string
+}
+
+// StrikeRecord is an ID's strike state and its newest signals.
+type StrikeRecord struct {
+	State   StrikeState
+	Signals []StrikeSignal
+}
+
+// ErrRedisCluster is returned for a monitor Redis running as Redis Cluster.
+var ErrRedisCluster = stderrors.New("monitor state needs a single-node Redis: its scripts and transactions span several keys, which Redis Cluster rejects with CROSSSLOT")
+
+var clusterRefused sync.Once
+
+// isRedisCluster reports whether r is a go-redis cluster client. It takes
+// any client type so callers need not convert theirs first.
+func isRedisCluster(r interface{}) bool {
+	_, ok := r.(*redis.ClusterClient)
+	return ok
+}
+
+// refuseRedisCluster is isRedisCluster for the monitor Redis: a cluster
+// client is logged once and treated as no Redis at all.
+func refuseRedisCluster(r interface{}) bool {
+	if !isRedisCluster(r) {
+		return false
+	}
+	clusterRefused.Do(func() {
+		logger.ZSLogger.Errorw("monitor Redis refused", "error", ErrRedisCluster)
+	})
+	return true
+}
+
+// CheckSingleNodeRedis returns ErrRedisCluster for a cluster client, or for
+// a plain client whose server runs with cluster mode on. Call it at startup
+// on the monitor Redis.
+func CheckSingleNodeRedis(ctx context.Context, r redis.UniversalClient) error {
+	if isRedisCluster(r) {
+		return ErrRedisCluster
+	}
+	info, err := r.Info(ctx, "cluster").Result()
+	if err != nil {
+		return err
+	}
+	if strings.Contains(info, "cluster_enabled:1") {
+		return ErrRedisCluster
+	}
+	return nil
+}
+
+// TelegramMonitor is TelegramLogic with the monitor state it runs on: the
+// kill switch, the dashboard handlers and the background jobs all hang off
+// it. Build one with NewTelegramMonitor.
+type TelegramMonitor struct {
+	TelegramLogic
+	store    MonitorStore
+	tracking TrackingResumer
+}
+
+// NewTelegramMonitor binds l to store. A nil store means a RedisMonitorStore
+// on l.Telemetry.MonitorRedis, or no store at all when that is unset or a
+// cluster client; handlers then answer 503 and strikes are skipped.
+//
+// tracking undoes the StopTrackingForTelegramID a kill made when a verdict
+// is restored; RegisterDashboardRoutes refuses to mount without it.
+func NewTelegramMonitor(l TelegramLogic, store MonitorStore, tracking TrackingResumer) TelegramMonitor {
+	if store == nil {
+		store = l.redisMonitorStore()
+	}
+	return TelegramMonitor{TelegramLogic: l, store: store, tracking: tracking}
+}
+
+// redisMonitorStore returns nil, not a nil *RedisMonitorStore, when there is
+// no usable monitor Redis.
+func (l TelegramLogic) redisMonitorStore() MonitorStore {
+	if l.Telemetry == nil || l.Telemetry.MonitorRedis == nil {
+		return nil
+	}
+	if refuseRedisCluster(l.Telemetry.MonitorRedis) {
+		return nil
+	}
+	return NewRedisMonitorStore(l.Telemetry.MonitorRedis)
+}
+
+// monitorStore is nil when the monitor has no store.
+func (l TelegramMonitor) monitorStore() MonitorStore {
+	return l.store
+}
+
+// The lookup and deletion paths hold a plain TelegramLogic. These run the
+// monitor's methods on the Redis store; none of them restores a verdict, so
+// they need no TrackingResumer.
+
+func (l TelegramLogic) ProcessDeletionSignal(inputSpan opentracing.Span, ctx context.Context, telegramID int64) {
+	NewTelegramMonitor(l, nil, nil).ProcessDeletionSignal(inputSpan, ctx, telegramID)
+}
+
+func (l TelegramLogic) ProcessDeletionError(inputSpan opentracing.Span, ctx context.Context, telegramID int64, cause error) {
+	NewTelegramMonitor(l, nil, nil).ProcessDeletionError(inputSpan, ctx, telegramID, cause)
+}
+
+func (l TelegramLogic) HealDeletionStrikes(ctx context.Context, telegramID int64) {
+	NewTelegramMonitor(l, nil, nil).HealDeletionStrikes(ctx, telegramID)
+}
+
+func (l TelegramLogic) RecordUpstreamFailure(ctx context.Context, err error) {
+	NewTelegramMonitor(l, nil, nil).RecordUpstreamFailure(ctx, err)
+}
+
+// --- Redis ---
+
+type RedisMonitorStore struct {
+	redis redis.Cmdable
+}
+
+func NewRedisMonitorStore(r redis.Cmdable) *RedisMonitorStore {
+	return &RedisMonitorStore{redis: r}
+}
+
+func (s *RedisMonitorStore) Stats(ctx context.Context, q StatsQuery) (MonitorStats, error) {
+	pipe := s.redis.Pipeline()
+	hitsCmd := pipe.Get(ctx, keyspace.GlobalHits)
+	errsCmd := pipe.Get(ctx, keyspace.GlobalErrors)
+	feedCmd := pipe.LRange(ctx, keyspace.LiveFeed, 0, q.FeedLimit-1)
+	worstCmd := pipe.ZRevRangeWithScores(ctx, keyspace.TrackerHealth, 0, q.WorstN-1)
+	byCodeCmd := pipe.HGetAll(ctx, keyspace.ErrorsByCode)
+
+	current := q.Now.Unix() / 60
+	hitCmds := make([]*redis.StringCmd, 0, q.Minutes)
+	errCmds := make([]*redis.StringCmd, 0, q.Minutes)
+	for i := q.Minutes - 1; i >= 0; i-- {
+		hitCmds = append(hitCmds, pipe.Get(ctx, keyspace.HitsMinute(current-int64(i))))
+		errCmds = append(errCmds, pipe.Get(ctx, keyspace.ErrorsMinute(current-int64(i))))
+	}
+
+	cmds, _ := pipe.Exec(ctx)
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			return MonitorStats{}, err
+		}
+	}
+
+	stats := MonitorStats{
+		Feed:          feedCmd.Val(),
+		WorstTrackers: make([]TrackerScore, 0, len(worstCmd.Val())),
+		HitSeries:     make([]int64, len(hitCmds)),
+		ErrorSeries:   make([]int64, len(errCmds)),
+		ErrorsByCode:  make(map[string]int64, len(byCodeCmd.Val())),
+	}
+	stats.Hits, _ = hitsCmd.Int64()
+	stats.Errors, _ = errsCmd.Int64()
+	for _, z := range worstCmd.Val() {
+		stats.WorstTrackers = append(stats.WorstTrackers, TrackerScore{Score: z.Score, Member: fmt.Sprint(z.Member)})
+	}
+	for i := range hitCmds {
+		stats.HitSeries[i], _ = hitCmds[i].Int64()
+		stats.ErrorSeries[i], _ = errCmds[i].Int64()
+	}
+	for code, raw := range byCodeCmd.Val() {
+		stats.ErrorsByCode[code], _ = strconv.ParseInt(raw, 10, 64)
+	}
+	return stats, nil
+}
+
+func (s *RedisMonitorStore) ErrorCodeSeries(ctx context.Context, code string, minutes int, now time.Time) ([]int64, error) {
+	return errorCodeSeries(ctx, s.redis, code, minutes, now)
+}
+
+func (s *RedisMonitorStore) RecordErrorCode(ctx context.Context, code string, now time.Time) error {
+	return recordErrorCode(ctx, s.redis, code, now)
+}
+
+func (s *RedisMonitorStore) Quarantine(ctx context.Context) ([]QuarantineEntry, error) {
+	return readQuarantine(ctx, s.redis)
+}
+
+func (s *RedisMonitorStore) IsQuarantined(ctx context.Context, telegramID int64) (bool, error) {
+	return isQuarantined(ctx, s.redis, telegramID)
+}
+
+func (s *RedisMonitorStore) Dequarantine(ctx context.Context, telegramID int64) error {
+	return dequarantine(ctx, s.redis, telegramID, keyspace.Strikes(telegramID), keyspace.Signals(telegramID))
+}
+
+func (s *RedisMonitorStore) ApplyStrike(ctx context.Context, telegramID int64, match DeletionClassification, weight float64, now time.Time, policy StrikePolicy) (StrikeTransition, error) {
+	return applyStrike(ctx, s.redis, telegramID, match, weight, now, policy)
+}
+
+func (s *RedisMonitorStore) ApplyHeal(ctx context.Context, telegramID int64, now time.Time, policy StrikePolicy) (string, float64, error) {
+	return applyHeal(ctx, s.redis, telegramID, now, policy)
+}
+
+func (s *RedisMonitorStore) LoadStrikes(ctx context.Context, telegramIDs []int64, signals int64) ([]StrikeRecord, error) {
+	if len(telegramIDs) == 0 {
+		return []StrikeRecord{}, nil
+	}
+	pipe := s.redis.Pipeline()
+	strikeCmds := make([]*redis.StringStringMapCmd, len(telegramIDs))
+	signalCmds := make([]*redis.StringSliceCmd, len(telegramIDs))
+	for i, id := range telegramIDs {
+		strikeCmds[i] = pipe.HGetAll(ctx, keyspace.Strikes(id))
+		signalCmds[i] = pipe.LRange(ctx, keyspace.Signals(id), 0, signals-1)
+	}
+	_, _ = pipe.Exec(ctx)
+
+	out := make([]StrikeRecord, len(telegramIDs))
+	for i, id := range telegramIDs {
+		out[i].State = parseStrikeState(strikeCmds[i].Val())
+		if strikeCmds[i].Err() != nil { // legacy STRING counter
+			state, _, err := loadStrikeState(ctx, s.redis, id)
+			if err != nil {
+				return nil, err
+			}
+			out[i].State = state
+		}
+		if err := signalCmds[i].Err(); err != nil {
+			return nil, err
+		}
+		out[i].Signals = parseStrikeSignals(signalCmds[i].Val())
+	}
+	return out, nil
+}
+
+func (s *RedisMonitorStore) ClaimKill(ctx context.Context, telegramID int64, token string, ttl time.Duration) (bool, error) {
+	return claimKill(ctx, s.redis, telegramID, token, ttl)
+}
+
+func (s *RedisMonitorStore) ReleaseKillClaim(ctx context.Context, telegramID int64) error {
+	return releaseKillClaim(ctx, s.redis, telegramID)
+}
+
+func (s *RedisMonitorStore) IsWatched(ctx context.Context, telegramID int64) (bool, error) {
+	return s.redis.SIsMember(ctx, keyspace.Watchlist, keyspace.Member(telegramID)).Result()
+}
+
+func (s *RedisMonitorStore) SetWatched(ctx context.Context, telegramID int64, watched bool) error {
+	if watched {
+		return s.redis.SAdd(ctx, keyspace.Watchlist, keyspace.Member(telegramID)).Err()
+	}
+	return s.redis.SRem(ctx, keyspace.Watchlist, keyspace.Member(telegramID)).Err()
+}
+
+func (s *RedisMonitorStore) History(ctx context.Context, telegramID int64, limit int64) ([]string, error) {
+	return s.redis.LRange(ctx, keyspace.History(telegramID), 0, limit-1).Result()
+}
+
+func (s *RedisMonitorStore) Relations(ctx context.Context, telegramID int64) ([]string, []string, error) {
+	var trackers, users *redis.StringSliceCmd
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		trackers = pipe.SMembers(ctx, keyspace.MapU2T(telegramID))
+		users = pipe.SMembers(ctx, keyspace.MapT2U(telegramID))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return trackers.Val(), users.Val(), nil
+}
+
+func (s *RedisMonitorStore) EnqueueReview(ctx context.Context, v PendingVerdict) (bool, error) {
+	return enqueueReview(ctx, s.redis, v)
+}
+
+func (s *RedisMonitorStore) ClaimReview(ctx context.Context, telegramID int64) (*PendingVerdict, error) {
+	return claimReview(ctx, s.redis, telegramID)
+}
+
+func (s *RedisMonitorStore) PendingReviews(ctx context.Context) (map[int64]PendingVerdict, error) {
+	return loadPendingReviews(ctx, s.redis)
+}
+
+func (s *RedisMonitorStore) RecordShadowVerdict(ctx context.Context, v ShadowVerdict) (bool, error) {
+	return recordShadowVerdict(ctx, s.redis, v)
+}
+
+func (s *RedisMonitorStore) SettleShadowVerdict(ctx context.Context, telegramID int64, outcome, evidence string, at time.Time) (bool, error) {
+	return settleShadowVerdict(ctx, s.redis, telegramID, outcome, evidence, at)
+}
+
+func (s *RedisMonitorStore) ShadowVerdicts(ctx context.Context) ([]ShadowVerdict, error) {
+	return loadShadowVerdicts(ctx, s.redis)
+}
+
+func (s *RedisMonitorStore) SaveVerdict(ctx context.Context, v VerdictRecord) error {
+	return saveVerdict(ctx, s.redis, v)
+}
+
+func (s *RedisMonitorStore) LoadVerdict(ctx context.Context, id string) (*VerdictRecord, error) {
+	return loadVerdict(ctx, s.redis, id)
+}
+
+func (s *RedisMonitorStore) Verdicts(ctx context.Context) ([]VerdictRecord, error) {
+	return loadVerdicts(ctx, s.redis)
+}
+
+func (s *RedisMonitorStore) ClaimRestore(ctx context.Context, id, actor string) (bool, error) {
+	return s.redis.HSetNX(ctx, keyspace.Verdict(id), "restored_by", actor).Result()
+}
+
+func (s *RedisMonitorStore) ReleaseRestore(ctx context.Context, id string) error {
+	return s.redis.HDel(ctx, keyspace.Verdict(id), "restored_by").Err()
+}
+
+func (s *RedisMonitorStore) MarkRestored(ctx context.Context, id string, at int64) error {
+	return s.redis.HSet(ctx, keyspace.Verdict(id), "restored_at", at).Err()
+}
+
+func (s *RedisMonitorStore) Reset(ctx context.Context, job *ResetJob) error {
+	for _, pattern := range job.Patterns {
+		if err := resetPattern(ctx, s.redis, job, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisMonitorStore) SaveResetJob(ctx context.Context, job *ResetJob) error {
+	return saveResetJob(ctx, s.redis, job)
+}
+
+func (s *RedisMonitorStore) LoadResetJob(ctx context.Context, id string) (*ResetJob, error) {
+	return loadResetJob(ctx, s.redis, id)
+}
+
+func (s *RedisMonitorStore) IssueResetConfirmation(ctx context.Context, actor string) (string, error) {
+	return issueResetConfirmation(ctx, s.redis, actor)
+}
+
+func (s *RedisMonitorStore) ConsumeResetConfirmation(ctx context.Context, token, actor string) (bool, error) {
+	return consumeResetConfirmation(ctx, s.redis, token, actor)
+}
+
+func (s *RedisMonitorStore) PublishEvent(ctx context.Context, e MonitorEvent) (string, error) {
+	return appendEvent(ctx, s.redis, e, CurrentStreamConfig().Retention)
+}
+
+func (s *RedisMonitorStore) EventsAfter(ctx context.Context, after string, count int64, block time.Duration) ([]MonitorEvent, error) {
+	return readEvents(ctx, s.redis, after, count, block)
+}
+
+func (s *RedisMonitorStore) EventStreamInfo(ctx context.Context) (EventStreamInfo, error) {
+	return loadEventStreamInfo(ctx, s.redis)
+}
+
+func (s *RedisMonitorStore) Leases() LeaseLocker {
+	return NewRedisLeaseLocker(s.redis, "")
+}
+
+func (s *RedisMonitorStore) Snapshot(ctx context.Context) (SnapshotInfo, error) {
+	return snapshotToFile(ctx, s.redis)
+}
@@ -0,0 +1,699 @@
+// logic/telegram_monitoring_store_memory.go
+package logic
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- In-memory MonitorStore ---
+//
+// MemoryMonitorStore keeps monitor state in maps behind one mutex, with the
+// same transitions as the Redis scripts (decay, threshold, MinSpan hold,
+// first-seen quarantine time). Nothing expires but kill claims, whose TTL is
+// part of what they mean; elsewhere TTLs only matter to Redis memory. The
+// telemetry service fills Redis in production; tests seed this
+// store through RecordLookup, PushFeed, AppendHistory, Relate and
+// SetTrackerHealth.
+
+type memoryQuarantine struct {
+	enteredAt int64
+	meta      *QuarantineMeta
+}
+
+type memoryVerdict struct {
+	record     VerdictRecord
+	restoredBy string
+	restoredAt int64
+}
+
+type memoryClaim struct {
+	token     string
+	expiresAt time.Time
+}
+
+type MemoryMonitorStore struct {
+	mu sync.Mutex
+	// Now is the clock kill claims expire against; tests move it forward.
+	Now func() time.Time
+
+	hits, errors    int64
+	hitSeries       map[int64]int64 // unix minute -> count
+	errorSeries     map[int64]int64
+	errorsByCode    map[string]int64
+	errorCodeSeries map[string]map[int64]int64
+	feed            []string // newest first
+	trackerHealth   map[string]float64
+
+	quarantine map[int64]memoryQuarantine
+	watchlist  map[int64]bool
+	strikes    map[int64]StrikeState
+	signals    map[int64][]StrikeSignal // newest first
+	history    map[int64][]string       // newest first
+	u2t, t2u   map[int64]map[string]bool
+
+	reviews       map[int64]PendingVerdict
+	shadow        map[int64]ShadowVerdict
+	verdicts      map[string]*memoryVerdict
+	killClaims    map[int64]memoryClaim
+	resetJobs     map[string]ResetJob
+	confirmations map[string]string
+
+	events        []MonitorEvent // oldest first
+	lastEventMs   int64
+	lastEventSeq  int64
+	eventsChanged chan struct{} // closed and replaced on every publish
+
+	leases *MemoryLeaseLocker
+}
+
+func NewMemoryMonitorStore() *MemoryMonitorStore {
+	s := &MemoryMonitorStore{
+		Now:           time.Now,
+		verdicts:      map[string]*memoryVerdict{},
+		killClaims:    map[int64]memoryClaim{},
+		resetJobs:     map[string]ResetJob{},
+		confirmations: map[string]string{},
+		eventsChanged: make(chan struct{}),
+		leases:        NewMemoryLeaseLocker("memory"),
+	}
+	s.clearMonitor()
+	return s
+}
+
+// clearMonitor empties everything Redis keeps under monitor:*.
+func (s *MemoryMonitorStore) clearMonitor() {
+	s.hits, s.errors = 0, 0
+	s.hitSeries = map[int64]int64{}
+	s.errorSeries = map[int64]int64{}
+	s.errorsByCode = map[string]int64{}
+	s.errorCodeSeries = map[string]map[int64]int64{}
+	s.feed = nil
+	s.trackerHealth = map[string]float64{}
+	s.quarantine = map[int64]memoryQuarantine{}
+	s.watchlist = map[int64]bool{}
+	s.strikes = map[int64]StrikeState{}
+	s.signals = map[int64][]StrikeSignal{}
+	s.history = map[int64][]string{}
+	s.u2t = map[int64]map[string]bool{}
+	s.t2u = map[int64]map[string]bool{}
+	s.reviews = map[int64]PendingVerdict{}
+	s.shadow = map[int64]ShadowVerdict{}
+}
+
+// --- Seeding (what the telemetry service writes) ---
+
+// RecordLookup counts one lookup at now, as the telemetry service does.
+func (s *MemoryMonitorStore) RecordLookup(now time.Time, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	minute := now.Unix() / 60
+	s.hits++
+	s.hitSeries[minute]++
+	if failed {
+		s.errors++
+		s.errorSeries[minute]++
+	}
+}
+
+// PushFeed adds raw JSON entries to the head of the live feed.
+func (s *MemoryMonitorStore) PushFeed(raws ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, raw := range raws {
+		s.feed = append([]string{raw}, s.feed...)
+	}
+}
+
+// AppendHistory adds raw JSON entries to the head of telegramID's deep log.
+func (s *MemoryMonitorStore) AppendHistory(telegramID int64, raws ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, raw := range raws {
+		s.history[telegramID] = append([]string{raw}, s.history[telegramID]...)
+	}
+}
+
+// Relate records that trackerID tracks userID.
+func (s *MemoryMonitorStore) Relate(userID, trackerID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addMember(s.u2t, userID, strconv.FormatInt(trackerID, 10))
+	addMember(s.t2u, trackerID, strconv.FormatInt(userID, 10))
+}
+
+func (s *MemoryMonitorStore) SetTrackerHealth(trackerID string, score float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trackerHealth[trackerID] = score
+}
+
+func addMember(m map[int64]map[string]bool, id int64, member string) {
+	if m[id] == nil {
+		m[id] = map[string]bool{}
+	}
+	m[id][member] = true
+}
+
+func sortedMembers(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for m := range set {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// --- Stats ---
+
+func (s *MemoryMonitorStore) Stats(_ context.Context, q StatsQuery) (MonitorStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := MonitorStats{
+		Hits:          s.hits,
+		Errors:        s.errors,
+		Feed:          headStrings(s.feed, q.FeedLimit),
+		WorstTrackers: []TrackerScore{},
+		HitSeries:     make([]int64, 0, q.Minutes),
+		ErrorSeries:   make([]int64, 0, q.Minutes),
+		ErrorsByCode:  make(map[string]int64, len(s.errorsByCode)),
+	}
+	for member, score := range s.trackerHealth {
+		stats.WorstTrackers = append(stats.WorstTrackers, TrackerScore{Score: score, Member: member})
+	}
+	sort.Slice(stats.WorstTrackers, func(i, j int) bool {
+		a, b := stats.WorstTrackers[i], stats.WorstTrackers[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Member > b.Member // ZREVRANGE order on ties
+	})
+	if int64(len(stats.WorstTrackers)) > q.WorstN {
+		stats.WorstTrackers = stats.WorstTrackers[:q.WorstN]
+	}
+
+	current := q.Now.Unix() / 60
+	for i := q.Minutes - 1; i >= 0; i-- {
+		stats.HitSeries = append(stats.HitSeries, s.hitSeries[current-int64(i)])
+		stats.ErrorSeries = append(stats.ErrorSeries, s.errorSeries[current-int64(i)])
+	}
+	for code, n := range s.errorsByCode {
+		stats.ErrorsByCode[code] = n
+	}
+	return stats, nil
+}
+
+func headStrings(list []string, limit int64) []string {
+	if int64(len(list)) > limit {
+		list = list[:limit]
+	}
+	return append([]string(nil), list...)
+}
+
+func (s *MemoryMonitorStore) ErrorCodeSeries(_ context.Context, code string, minutes int, now time.Time) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := now.Unix() / 60
+	series := make([]int64, 0, minutes)
+	for i := minutes - 1; i >= 0; i-- {
+		series = append(series, s.errorCodeSeries[code][current-int64(i)])
+	}
+	return series, nil
+}
+
+func (s *MemoryMonitorStore) RecordErrorCode(_ context.Context, code string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorsByCode[code]++
+	if s.errorCodeSeries[code] == nil {
+		s.errorCodeSeries[code] = map[int64]int64{}
+	}
+	s.errorCodeSeries[code][now.Unix()/60]++
+	return nil
+}
+
+// --- Quarantine ---
+
+func (s *MemoryMonitorStore) Quarantine(_ context.Context) ([]QuarantineEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]QuarantineEntry, 0, len(s.quarantine))
+	for id, q := range s.quarantine {
+		e := QuarantineEntry{TelegramID: id, EnteredAt: q.enteredAt}
+		if q.meta != nil {
+			meta := *q.meta
+			e.Meta = &meta
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].EnteredAt != entries[j].EnteredAt {
+			return entries[i].EnteredAt > entries[j].EnteredAt
+		}
+		return entries[i].TelegramID > entries[j].TelegramID
+	})
+	return entries, nil
+}
+
+func (s *MemoryMonitorStore) IsQuarantined(_ context.Context, telegramID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.quarantine[telegramID]
+	return ok, nil
+}
+
+func (s *MemoryMonitorStore) Dequarantine(_ context.Context, telegramID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropStrikes(telegramID)
+	return nil
+}
+
+func (s *MemoryMonitorStore) dropStrikes(telegramID int64) {
+	delete(s.quarantine, telegramID)
+	delete(s.strikes, telegramID)
+	delete(s.signals, telegramID)
+}
+
+// --- Strikes ---
+
+func (s *MemoryMonitorStore) ApplyStrike(_ context.Context, telegramID int64, match DeletionClassification, weight float64, now time.Time, policy StrikePolicy) (StrikeTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nowS := now.Unix()
+	q, ok := s.quarantine[telegramID]
+	if !ok {
+		q = memoryQuarantine{enteredAt: nowS, meta: &QuarantineMeta{EnteredAt: nowS, Rule: match.RuleID, Verdict: match.Verdict}}
+		s.quarantine[telegramID] = q
+	}
+	s.watchlist[telegramID] = true
+
+	score := weight
+	if prev, ok := s.strikes[telegramID]; ok {
+		score += prev.at(now, policy.HalfLife.Std())
+	}
+	s.strikes[telegramID] = StrikeState{Score: score, UpdatedAt: now}
+	s.pushSignal(telegramID, StrikeSignal{At: nowS, Kind: "strike", Rule: match.RuleID, Verdict: match.Verdict, Weight: weight, Score: score}, policy.MaxSignals)
+
+	t := StrikeTransition{Verdict: StrikeRecorded, Score: score, FirstSeen: q.enteredAt}
+	if score >= policy.Threshold {
+		t.Verdict = StrikeThreshold
+		if span := int64(policy.MinSpan.Std().Seconds()); span > 0 && nowS-q.enteredAt < span {
+			t.Verdict = StrikeHeld
+		}
+	}
+	return t, nil
+}
+
+func (s *MemoryMonitorStore) ApplyHeal(_ context.Context, telegramID int64, now time.Time, policy StrikePolicy) (string, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.strikes[telegramID]
+	if !ok {
+		return HealNone, 0, nil
+	}
+	score := prev.at(now, policy.HalfLife.Std()) - policy.HealWeight
+	if score < 0 {
+		score = 0
+	}
+	if score < strikeScoreFloor {
+		s.dropStrikes(telegramID)
+		return HealCleared, 0, nil
+	}
+	s.strikes[telegramID] = StrikeState{Score: score, UpdatedAt: now}
+	s.pushSignal(telegramID, StrikeSignal{At: now.Unix(), Kind: "heal", Weight: -policy.HealWeight, Score: score}, policy.MaxSignals)
+	return HealLowered, score, nil
+}
+
+func (s *MemoryMonitorStore) pushSignal(telegramID int64, sig StrikeSignal, max int) {
+	list := append([]StrikeSignal{sig}, s.signals[telegramID]...)
+	if max > 0 && len(list) > max {
+		list = list[:max]
+	}
+	s.signals[telegramID] = list
+}
+
+func (s *MemoryMonitorStore) LoadStrikes(_ context.Context, telegramIDs []int64, signals int64) ([]StrikeRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]StrikeRecord, len(telegramIDs))
+	for i, id := range telegramIDs {
+		out[i].State = s.strikes[id]
+		list := s.signals[id]
+		if int64(len(list)) > signals {
+			list = list[:signals]
+		}
+		out[i].Signals = append([]StrikeSignal{}, list...)
+	}
+	return out, nil
+}
+
+func (s *MemoryMonitorStore) ClaimKill(_ context.Context, telegramID int64, token string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	if cur, ok := s.killClaims[telegramID]; ok && now.Before(cur.expiresAt) {
+		return false, nil
+	}
+	s.killClaims[telegramID] = memoryClaim{token: token, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryMonitorStore) ReleaseKillClaim(_ context.Context, telegramID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.killClaims, telegramID)
+	return nil
+}
+
+// --- Watchlist, history, relations ---
+
+func (s *MemoryMonitorStore) IsWatched(_ context.Context, telegramID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watchlist[telegramID], nil
+}
+
+func (s *MemoryMonitorStore) SetWatched(_ context.Context, telegramID int64, watched bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if watched {
+		s.watchlist[telegramID] = true
+	} else {
+		delete(s.watchlist, telegramID)
+	}
+	return nil
+}
+
+func (s *MemoryMonitorStore) History(_ context.Context, telegramID int64, limit int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return headStrings(s.history[telegramID], limit), nil
+}
+
+func (s *MemoryMonitorStore) Relations(_ context.Context, telegramID int64) ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedMembers(s.u2t[telegramID]), sortedMembers(s.t2u[telegramID]), nil
+}
+
+// --- Review queue ---
+
+func (s *MemoryMonitorStore) EnqueueReview(_ context.Context, v PendingVerdict) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reviews[v.TelegramID]; ok {
+		return false, nil
+	}
+	s.reviews[v.TelegramID] = v
+	return true, nil
+}
+
+func (s *MemoryMonitorStore) ClaimReview(_ context.Context, telegramID int64) (*PendingVerdict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.reviews[telegramID]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.reviews, telegramID)
+	return &v, nil
+}
+
+func (s *MemoryMonitorStore) PendingReviews(_ context.Context) (map[int64]PendingVerdict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[int64]PendingVerdict, len(s.reviews))
+	for id, v := range s.reviews {
+		out[id] = v
+	}
+	return out, nil
+}
+
+// --- Shadow verdicts ---
+
+func (s *MemoryMonitorStore) RecordShadowVerdict(_ context.Context, v ShadowVerdict) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.shadow[v.TelegramID]; ok && existing.Outcome == ShadowOutcomePending {
+		return false, nil
+	}
+	s.shadow[v.TelegramID] = v
+	return true, nil
+}
+
+func (s *MemoryMonitorStore) SettleShadowVerdict(_ context.Context, telegramID int64, outcome, evidence string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.shadow[telegramID]
+	if !ok || v.Outcome != ShadowOutcomePending {
+		return false, nil
+	}
+	v.Outcome = outcome
+	v.OutcomeAt = at.Unix()
+	v.OutcomeBy = evidence
+	s.shadow[telegramID] = v
+	return true, nil
+}
+
+func (s *MemoryMonitorStore) ShadowVerdicts(_ context.Context) ([]ShadowVerdict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]ShadowVerdict, 0, len(s.shadow))
+	for _, v := range s.shadow {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// --- Kill verdicts ---
+
+func (s *MemoryMonitorStore) SaveVerdict(_ context.Context, v VerdictRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.verdicts[v.ID]; ok {
+		cur.record = v
+		return nil
+	}
+	s.verdicts[v.ID] = &memoryVerdict{record: v}
+	return nil
+}
+
+func (v *memoryVerdict) view() VerdictRecord {
+	out := v.record
+	out.RestoredAt = v.restoredAt
+	out.RestoredBy = v.restoredBy
+	return out
+}
+
+func (s *MemoryMonitorStore) LoadVerdict(_ context.Context, id string) (*VerdictRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.verdicts[id]
+	if !ok {
+		return nil, nil
+	}
+	out := v.view()
+	return &out, nil
+}
+
+func (s *MemoryMonitorStore) Verdicts(_ context.Context) ([]VerdictRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]VerdictRecord, 0, len(s.verdicts))
+	for _, v := range s.verdicts {
+		out = append(out, v.view())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].At != out[j].At {
+			return out[i].At > out[j].At
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (s *MemoryMonitorStore) ClaimRestore(_ context.Context, id, actor string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.verdicts[id]
+	if !ok || v.restoredBy != "" {
+		return false, nil
+	}
+	v.restoredBy = actor
+	return true, nil
+}
+
+func (s *MemoryMonitorStore) ReleaseRestore(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.verdicts[id]; ok {
+		v.restoredBy = ""
+	}
+	return nil
+}
+
+func (s *MemoryMonitorStore) MarkRestored(_ context.Context, id string, at int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.verdicts[id]; ok {
+		v.restoredAt = at
+	}
+	return nil
+}
+
+// --- Resets ---
+
+// Reset counts one "key" per list, series bucket or per-ID entry it drops,
+// roughly what the Redis reset would UNLINK.
+func (s *MemoryMonitorStore) Reset(_ context.Context, job *ResetJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	switch job.Scope {
+	case ResetScopeFeed:
+		if len(s.feed) > 0 {
+			n = 1
+		}
+		s.feed = nil
+	case ResetScopeTimeSeries:
+		n = int64(len(s.hitSeries) + len(s.errorSeries))
+		for _, series := range s.errorCodeSeries {
+			n += int64(len(series))
+		}
+		s.hitSeries = map[int64]int64{}
+		s.errorSeries = map[int64]int64{}
+		s.errorCodeSeries = map[string]map[int64]int64{}
+	case ResetScopeHistory:
+		if _, ok := s.history[job.TelegramID]; ok {
+			n = 1
+		}
+		delete(s.history, job.TelegramID)
+	case ResetScopeAll:
+		n = int64(len(s.hitSeries) + len(s.errorSeries) + len(s.history) + len(s.strikes) + len(s.signals) +
+			len(s.u2t) + len(s.t2u))
+		s.clearMonitor()
+	default:
+		_, err := resetPatterns(job.Scope, job.TelegramID)
+		return err
+	}
+	job.Scanned += n
+	job.Deleted += n
+	return nil
+}
+
+func (s *MemoryMonitorStore) SaveResetJob(_ context.Context, job *ResetJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetJobs[job.ID] = *job
+	return nil
+}
+
+func (s *MemoryMonitorStore) LoadResetJob(_ context.Context, id string) (*ResetJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.resetJobs[id]
+	if !ok {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (s *MemoryMonitorStore) IssueResetConfirmation(_ context.Context, actor string) (string, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.confirmations[token] = actor
+	return token, nil
+}
+
+func (s *MemoryMonitorStore) ConsumeResetConfirmation(_ context.Context, token, actor string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	issuedTo, ok := s.confirmations[token]
+	delete(s.confirmations, token)
+	return ok && issuedTo == actor, nil
+}
+
+// PublishEvent numbers events like Redis does: unix milliseconds, then a
+// sequence within the millisecond.
+func (s *MemoryMonitorStore) PublishEvent(_ context.Context, e MonitorEvent) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms := time.Now().UnixMilli()
+	if ms <= s.lastEventMs {
+		ms = s.lastEventMs
+		s.lastEventSeq++
+	} else {
+		s.lastEventSeq = 0
+	}
+	s.lastEventMs = ms
+	e.ID = strconv.FormatInt(ms, 10) + "-" + strconv.FormatInt(s.lastEventSeq, 10)
+
+	s.events = append(s.events, e)
+	if retention := CurrentStreamConfig().Retention; int64(len(s.events)) > retention {
+		s.events = append([]MonitorEvent(nil), s.events[int64(len(s.events))-retention:]...)
+	}
+	close(s.eventsChanged)
+	s.eventsChanged = make(chan struct{})
+	return e.ID, nil
+}
+
+func (s *MemoryMonitorStore) EventsAfter(ctx context.Context, after string, count int64, block time.Duration) ([]MonitorEvent, error) {
+	var timeout <-chan time.Time
+	if block > 0 {
+		t := time.NewTimer(block)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		s.mu.Lock()
+		var out []MonitorEvent
+		for _, e := range s.events {
+			if compareEventIDs(e.ID, after) > 0 {
+				out = append(out, e)
+				if int64(len(out)) == count {
+					break
+				}
+			}
+		}
+		changed := s.eventsChanged
+		s.mu.Unlock()
+
+		if len(out) > 0 || timeout == nil {
+			return out, nil
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *MemoryMonitorStore) EventStreamInfo(_ context.Context) (EventStreamInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := EventStreamInfo{Length: int64(len(s.events))}
+	if len(s.events) > 0 {
+		info.Oldest = s.events[0].ID
+		info.Newest = s.events[len(s.events)-1].ID
+	}
+	return info, nil
+}
+
+func (s *MemoryMonitorStore) Leases() LeaseLocker {
+	return s.leases
+}
@@ -0,0 +1,29 @@
+// logic/telegram_monitoring_store_test.go
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCheckSingleNodeRedis(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := newSnapshotRedis(t)
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer cluster.Close()
+	if err := CheckSingleNodeRedis(ctx, cluster); err != ErrRedisCluster {
+		t.Errorf("cluster client: err = %v, want ErrRedisCluster", err)
+	}
+
+	router := gin.New()
+	err := NewTelegramMonitor(TelegramLogic{}, nil, &fakeTrackedRepo{}).RegisterDashboardRoutes(router, NewDashboardAuth(cluster, DashboardAuthConfig{}))
+	if err != ErrRedisCluster {
+		t.Errorf("register on a cluster client: err = %v, want ErrRedisCluster", err)
+	}
+	if n := len(router.Routes()); n != 0 {
+		t.Errorf("%d dashboard routes registered on a cluster client", n)
+	}
+}
@@ -0,0 +1,485 @@
+// logic/telegram_monitoring_stream.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- LIVE EVENT STREAM ---
+//
+// Writers append what changed to one Redis stream, dashboard:events:
+//
+//   lookup      a lookup landed in the live feed (PublishLookupEvent, for
+//               the feed's writer to call next to its LPUSH)
+//   quarantine  an ID was struck, healed or cleared (the strike logic)
+//   reset       a reset job finished; clients should refetch
+//
+// GET /dashboard/api/stream turns that into Server-Sent Events. Every client
+// reads the stream from its own cursor, so resuming with Last-Event-ID is
+// just reading from that ID, and a slow client only slows its own reads:
+// nothing is buffered on its behalf. A client that stays a full batch behind
+// for MaxCatchUp rounds, or whose cursor was trimmed away, is sent "resync"
+// and skipped to the head; it refetches /stats instead of replaying.
+//
+// The stream is trimmed to roughly Retention entries on write.
+
+const (
+	MonitorEventLookup     = "lookup"
+	MonitorEventQuarantine = "quarantine"
+	MonitorEventReset      = "reset"
+
+	QuarantineStruck  = "struck"  // entered quarantine or its score went up
+	QuarantineHealed  = "healed"  // score went down, still quarantined
+	QuarantineCleared = "cleared" // left quarantine: healed, killed or rejected
+)
+
+// MonitorEvent is one stream entry. ID is the stream ID, set by the store.
+type MonitorEvent struct {
+	ID   string          `json:"-"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// LookupEvent is the data of a lookup event.
+type LookupEvent struct {
+	Item   json.RawMessage `json:"item"` // the feed entry as pushed
+	Failed bool            `json:"failed"`
+}
+
+// QuarantineEvent is the data of a quarantine event.
+type QuarantineEvent struct {
+	TelegramID int64   `json:"id"`
+	Change     string  `json:"change"` // QuarantineStruck, QuarantineHealed or QuarantineCleared
+	Score      float64 `json:"score"`
+	Reason     string  `json:"reason,omitempty"` // rule on a strike; heal, kill or review on a clear
+	At         int64   `json:"ts"`
+}
+
+// ResetEvent is the data of a reset event.
+type ResetEvent struct {
+	JobID string `json:"job_id"`
+	Scope string `json:"scope"`
+}
+
+// EventStreamInfo is the retained range of the stream. Oldest and Newest
+// are "" while it is empty.
+type EventStreamInfo struct {
+	Oldest string
+	Newest string
+	Length int64
+}
+
+// --- Config ---
+
+// StreamConfig bounds the event stream and its clients.
+type StreamConfig struct {
+	// Retention is how many events writers keep (approximately, on Redis).
+	Retention int64
+	// MaxClients caps concurrent streams per process. Each holds a Redis
+	// connection while it waits for events.
+	MaxClients int
+	// Batch is how many events one read takes and one write sends.
+	Batch int64
+	// MaxCatchUp is how many full batches in a row a client may read
+	// before it is resynced instead.
+	MaxCatchUp int
+	// Heartbeat is how long a read waits before sending a keep-alive.
+	Heartbeat time.Duration
+}
+
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		Retention:  10000,
+		MaxClients: 50,
+		Batch:      100,
+		MaxCatchUp: 10,
+		Heartbeat:  15 * time.Second,
+	}
+}
+
+var activeStreams = struct {
+	mu      sync.Mutex
+	cfg     StreamConfig
+	clients int
+}{cfg: DefaultStreamConfig()}
+
+// SetStreamConfig replaces the stream limits. Open streams keep the config
+// they started with.
+func SetStreamConfig(cfg StreamConfig) {
+	activeStreams.mu.Lock()
+	activeStreams.cfg = cfg
+	activeStreams.mu.Unlock()
+}
+
+func CurrentStreamConfig() StreamConfig {
+	activeStreams.mu.Lock()
+	defer activeStreams.mu.Unlock()
+	return activeStreams.cfg
+}
+
+// acquireStreamSlot reserves a client slot; false means the cap is reached.
+func acquireStreamSlot() (StreamConfig, bool) {
+	activeStreams.mu.Lock()
+	defer activeStreams.mu.Unlock()
+	if activeStreams.clients >= activeStreams.cfg.MaxClients {
+		return activeStreams.cfg, false
+	}
+	activeStreams.clients++
+	return activeStreams.cfg, true
+}
+
+func releaseStreamSlot() {
+	activeStreams.mu.Lock()
+	activeStreams.clients--
+	activeStreams.mu.Unlock()
+}
+
+// --- Event IDs ---
+
+// parseEventID splits a stream ID ("1700000000000-3"). A bare millisecond
+// time is accepted, as Redis does.
+func parseEventID(id string) (ms, seq uint64, err error) {
+	msPart, seqPart := id, "0"
+	if i := strings.IndexByte(id, '-'); i >= 0 {
+		msPart, seqPart = id[:i], id[i+1:]
+	}
+	if ms, err = strconv.ParseUint(msPart, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	return ms, seq, nil
+}
+
+// compareEventIDs orders two stream IDs; unparseable IDs sort as 0-0.
+func compareEventIDs(a, b string) int {
+	ams, aseq, _ := parseEventID(a)
+	bms, bseq, _ := parseEventID(b)
+	switch {
+	case ams != bms:
+		if ams < bms {
+			return -1
+		}
+		return 1
+	case aseq != bseq:
+		if aseq < bseq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// --- Redis ---
+
+// PublishLookupEvent announces a feed entry to dashboard streams. The feed's
+// writer should call it with the JSON it just pushed onto the live feed.
+// That writer is the telemetry service, which does not call it yet; until
+// it does, the dashboard keeps polling /stats for the feed and counters.
+func PublishLookupEvent(ctx context.Context, r redis.Cmdable, item []byte, failed bool) error {
+	data, err := json.Marshal(LookupEvent{Item: item, Failed: failed})
+	if err != nil {
+		return err
+	}
+	_, err = appendEvent(ctx, r, MonitorEvent{Type: MonitorEventLookup, Data: data}, CurrentStreamConfig().Retention)
+	return err
+}
+
+func appendEvent(ctx context.Context, r redis.Cmdable, e MonitorEvent, retention int64) (string, error) {
+	return r.XAdd(ctx, &redis.XAddArgs{
+		Stream:       keyspace.Events,
+		MaxLenApprox: retention,
+		Values:       map[string]interface{}{"type": e.Type, "data": string(e.Data)},
+	}).Result()
+}
+
+// readEvents returns up to count events after the given ID, waiting up to
+// block for the first one. block <= 0 does not wait.
+func readEvents(ctx context.Context, r redis.Cmdable, after string, count int64, block time.Duration) ([]MonitorEvent, error) {
+	if block <= 0 {
+		block = -1 // go-redis sends BLOCK 0, "forever", for a zero Block
+	}
+	streams, err := r.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{keyspace.Events, after},
+		Count:   count,
+		Block:   block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []MonitorEvent
+	for _, s := range streams {
+		for _, msg := range s.Messages {
+			typ, _ := msg.Values["type"].(string)
+			data, _ := msg.Values["data"].(string)
+			events = append(events, MonitorEvent{ID: msg.ID, Type: typ, Data: json.RawMessage(data)})
+		}
+	}
+	return events, nil
+}
+
+func loadEventStreamInfo(ctx context.Context, r redis.Cmdable) (EventStreamInfo, error) {
+	pipe := r.Pipeline()
+	lenCmd := pipe.XLen(ctx, keyspace.Events)
+	oldestCmd := pipe.XRangeN(ctx, keyspace.Events, "-", "+", 1)
+	newestCmd := pipe.XRevRangeN(ctx, keyspace.Events, "+", "-", 1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return EventStreamInfo{}, err
+	}
+	info := EventStreamInfo{Length: lenCmd.Val()}
+	if msgs := oldestCmd.Val(); len(msgs) > 0 {
+		info.Oldest = msgs[0].ID
+	}
+	if msgs := newestCmd.Val(); len(msgs) > 0 {
+		info.Newest = msgs[0].ID
+	}
+	return info, nil
+}
+
+// publishMonitorEvent is best-effort: a stream that misses an event costs a
+// dashboard one refresh, so failures are logged and the caller carries on.
+func publishMonitorEvent(ctx context.Context, store FeedStore, eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err == nil {
+		_, err = store.PublishEvent(ctx, MonitorEvent{Type: eventType, Data: raw})
+	}
+	if err != nil {
+		logger.ZSLogger.Warnw("failed to publish monitor event", "type", eventType, "error", err)
+	}
+}
+
+// --- HTTP HANDLERS ---
+
+// StreamRequest resumes a stream for clients that cannot send the
+// Last-Event-ID header; the header wins when both are present.
+type StreamRequest struct {
+	LastEventID string `query:"last_event_id"`
+}
+
+// Server-Sent Event payloads. Every batch ends with the only event that
+// carries an id, so a client that resumes never gets half a batch's counters.
+
+// StreamReady opens every stream. Resumed is false for a fresh client,
+// which should load /stats once.
+type StreamReady struct {
+	Resumed bool `json:"resumed"`
+}
+
+// StreamCounters is the change in the global counters over one batch.
+type StreamCounters struct {
+	Hits   int64 `json:"hits"`
+	Errors int64 `json:"errors"`
+}
+
+// StreamResync tells a client its cursor was skipped forward: it fell too
+// far behind ("lagging") or asked for events no longer kept ("expired").
+type StreamResync struct {
+	Reason string `json:"reason"`
+}
+
+// GET /dashboard/api/stream (Last-Event-ID or ?last_event_id= to resume)
+func (l TelegramMonitor) StreamDashboard(c *gin.Context) {
+	var req StreamRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	cursor := req.LastEventID
+	if h := c.GetHeader("Last-Event-ID"); h != "" {
+		cursor = h
+	}
+	if cursor != "" {
+		if _, _, err := parseEventID(cursor); err != nil {
+			abortWithError(c, newAPIError(400, "invalid_last_event_id", "Last-Event-ID must be a stream ID like 1700000000000-0"))
+			return
+		}
+	}
+
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	cfg, ok := acquireStreamSlot()
+	if !ok {
+		abortWithError(c, newAPIError(503, "too_many_streams", "this instance already serves %d streams; poll /dashboard/api/stats instead", cfg.MaxClients))
+		return
+	}
+	defer releaseStreamSlot()
+
+	ctx := c.Request.Context()
+	info, err := store.EventStreamInfo(ctx)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read event stream", "error", err)
+		abortWithError(c, newAPIError(500, "stream_read_failed", "could not read the event stream"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // proxies must not sit on the events
+	c.Status(200)
+	out := &sseWriter{w: c.Writer, flush: c.Writer.Flush}
+
+	head := info.Newest
+	if head == "" {
+		head = "0-0"
+	}
+	switch {
+	case cursor == "":
+		cursor = head
+		out.event(cursor, "ready", StreamReady{})
+	case info.Length >= cfg.Retention && compareEventIDs(cursor, info.Oldest) < 0:
+		cursor = head
+		out.event(cursor, "resync", StreamResync{Reason: "expired"})
+	default:
+		out.event(cursor, "ready", StreamReady{Resumed: true})
+	}
+	if out.send() != nil {
+		return
+	}
+
+	behind := 0
+	for {
+		events, err := store.EventsAfter(ctx, cursor, cfg.Batch, cfg.Heartbeat)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The client reconnects with its Last-Event-ID.
+			logger.ZSLogger.Errorw("event stream read failed", "cursor", cursor, "error", err)
+			return
+		}
+		if len(events) == 0 {
+			out.comment("ping")
+			if out.send() != nil {
+				return
+			}
+			continue
+		}
+
+		if int64(len(events)) < cfg.Batch {
+			behind = 0
+		} else if behind++; behind > cfg.MaxCatchUp {
+			info, err := store.EventStreamInfo(ctx)
+			if err != nil {
+				logger.ZSLogger.Errorw("failed to read event stream", "error", err)
+				return
+			}
+			logger.ZSLogger.Warnw("event stream client lagging, resyncing", "cursor", cursor, "head", info.Newest)
+			behind = 0
+			cursor = info.Newest
+			out.event(cursor, "resync", StreamResync{Reason: "lagging"})
+			if out.send() != nil {
+				return
+			}
+			continue
+		}
+
+		cursor = events[len(events)-1].ID
+		writeEventBatch(out, events, cursor)
+		if out.send() != nil {
+			return
+		}
+	}
+}
+
+// writeEventBatch queues one SSE event per stream entry plus the counters
+// for the batch, with the batch's last ID on the final event only.
+func writeEventBatch(out *sseWriter, events []MonitorEvent, lastID string) {
+	type sseEvent struct {
+		name string
+		data interface{}
+	}
+	var batch []sseEvent
+	var counters StreamCounters
+	for _, e := range events {
+		switch e.Type {
+		case MonitorEventLookup:
+			var lookup LookupEvent
+			if err := json.Unmarshal(e.Data, &lookup); err != nil {
+				continue
+			}
+			counters.Hits++
+			if lookup.Failed {
+				counters.Errors++
+			}
+			for _, entry := range parseLookupLog([]string{string(lookup.Item)}) {
+				batch = append(batch, sseEvent{"feed", entry})
+			}
+		case MonitorEventQuarantine, MonitorEventReset:
+			batch = append(batch, sseEvent{e.Type, e.Data})
+		}
+	}
+	if counters.Hits > 0 {
+		batch = append(batch, sseEvent{"counters", counters})
+	}
+
+	if len(batch) == 0 {
+		// Nothing to show, but the client's cursor still moves.
+		out.id(lastID)
+		return
+	}
+	for i, e := range batch {
+		id := ""
+		if i == len(batch)-1 {
+			id = lastID
+		}
+		out.event(id, e.name, e.data)
+	}
+}
+
+// sseWriter buffers events and writes them out with one flush, so a batch
+// costs one write to the client.
+type sseWriter struct {
+	w     io.Writer
+	flush func()
+	buf   strings.Builder
+}
+
+func (s *sseWriter) event(id, name string, data interface{}) {
+	raw, err := json.Marshal(data) // compact, so the data is one line
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to encode stream event", "event", name, "error", err)
+		return
+	}
+	if id != "" {
+		s.buf.WriteString("id: " + id + "\n")
+	}
+	s.buf.WriteString("event: " + name + "\ndata: ")
+	s.buf.Write(raw)
+	s.buf.WriteString("\n\n")
+}
+
+func (s *sseWriter) id(id string) {
+	s.buf.WriteString("id: " + id + "\n\n")
+}
+
+func (s *sseWriter) comment(text string) {
+	s.buf.WriteString(": " + text + "\n\n")
+}
+
+func (s *sseWriter) send() error {
+	_, err := io.WriteString(s.w, s.buf.String())
+	s.buf.Reset()
+	if err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
@@ -0,0 +1,261 @@
+// logic/telegram_monitoring_stream_test.go
+package logic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+type sseEvent struct {
+	ID, Name, Data string
+}
+
+// withStreamConfig swaps the stream limits for one test.
+func withStreamConfig(t *testing.T, edit func(*StreamConfig)) {
+	t.Helper()
+	prev := CurrentStreamConfig()
+	cfg := DefaultStreamConfig()
+	cfg.Heartbeat = 20 * time.Millisecond
+	edit(&cfg)
+	SetStreamConfig(cfg)
+	t.Cleanup(func() { SetStreamConfig(prev) })
+}
+
+// newStreamServer serves env over a real listener. Cleanups run last-in
+// first-out, so open streams are cancelled before Close waits on them.
+func newStreamServer(t *testing.T, env *handlerEnv) *httptest.Server {
+	srv := httptest.NewServer(env.router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// openStream connects to the stream and delivers every event block,
+// id-only blocks included, until the test ends.
+func openStream(t *testing.T, srv *httptest.Server, lastEventID string) <-chan sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/dashboard/api/stream", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("stream: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	out := make(chan sseEvent, 100)
+	go func() {
+		defer res.Body.Close()
+		defer close(out)
+		var ev sseEvent
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.Name != "" || ev.ID != "" {
+					out <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.Name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return out
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event within 2s")
+	}
+	return sseEvent{}
+}
+
+func publishLookup(t *testing.T, store MonitorStore, item string, failed bool) string {
+	t.Helper()
+	data, _ := json.Marshal(LookupEvent{Item: json.RawMessage(item), Failed: failed})
+	id, err := store.PublishEvent(context.Background(), MonitorEvent{Type: MonitorEventLookup, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestStreamDashboard(t *testing.T) {
+	withStreamConfig(t, func(*StreamConfig) {})
+	env := newHandlerEnv(t, true)
+	srv := newStreamServer(t, env)
+
+	events := openStream(t, srv, "")
+	if ev := nextEvent(t, events); ev.Name != "ready" || ev.Data != `{"resumed":false}` || ev.ID != "0-0" {
+		t.Fatalf("first event = %+v", ev)
+	}
+
+	// Each batch is its feed entries followed by one counters event that
+	// carries the batch's ID. The two lookups may land in one batch or two.
+	publishLookup(t, env.store, `{"tg":1,"s":"OK"}`, false)
+	last := publishLookup(t, env.store, `{"tg":2,"s":"ERR","e":"PEER_ID_INVALID"}`, true)
+	var feed []string
+	var total StreamCounters
+	for ev := (sseEvent{}); ev.ID != last; {
+		ev = nextEvent(t, events)
+		switch ev.Name {
+		case "feed":
+			if ev.ID != "" {
+				t.Errorf("feed entry carries the batch ID: %+v", ev)
+			}
+			feed = append(feed, ev.Data)
+		case "counters":
+			var c StreamCounters
+			if err := json.Unmarshal([]byte(ev.Data), &c); err != nil || ev.ID == "" {
+				t.Fatalf("counters = %+v", ev)
+			}
+			total.Hits += c.Hits
+			total.Errors += c.Errors
+		default:
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	}
+	if total != (StreamCounters{Hits: 2, Errors: 1}) {
+		t.Errorf("counters add up to %+v, want 2 hits and 1 error", total)
+	}
+	if len(feed) != 2 || !strings.Contains(feed[1], `"ec":"PEER_ID_INVALID"`) {
+		t.Errorf("feed entries should be parsed like /stats: %v", feed)
+	}
+
+	// Resuming replays only what came after the cursor.
+	quarantined, _ := json.Marshal(QuarantineEvent{TelegramID: 42, Change: QuarantineStruck, Score: 1})
+	after, _ := env.store.PublishEvent(context.Background(), MonitorEvent{Type: MonitorEventQuarantine, Data: quarantined})
+	resumed := openStream(t, srv, last)
+	if ev := nextEvent(t, resumed); ev.Name != "ready" || ev.Data != `{"resumed":true}` {
+		t.Fatalf("resume: first event = %+v", ev)
+	}
+	if ev := nextEvent(t, resumed); ev.Name != "quarantine" || ev.ID != after {
+		t.Errorf("resume: event = %+v, want the quarantine change %s", ev, after)
+	}
+}
+
+func TestStreamResync(t *testing.T) {
+	t.Run("cursor trimmed away", func(t *testing.T) {
+		withStreamConfig(t, func(c *StreamConfig) { c.Retention = 3 })
+		env := newHandlerEnv(t, true)
+		first := publishLookup(t, env.store, `{"tg":1}`, false)
+		var last string
+		for i := 0; i < 4; i++ {
+			last = publishLookup(t, env.store, `{"tg":1}`, false)
+		}
+		srv := newStreamServer(t, env)
+
+		events := openStream(t, srv, first)
+		if ev := nextEvent(t, events); ev.Name != "resync" || ev.Data != `{"reason":"expired"}` || ev.ID != last {
+			t.Errorf("event = %+v, want an expired resync to %s", ev, last)
+		}
+	})
+
+	t.Run("client too far behind", func(t *testing.T) {
+		withStreamConfig(t, func(c *StreamConfig) {
+			c.Batch = 2
+			c.MaxCatchUp = 1
+		})
+		env := newHandlerEnv(t, true)
+		var last string
+		for i := 0; i < 10; i++ {
+			last = publishLookup(t, env.store, `{"tg":1}`, false)
+		}
+		srv := newStreamServer(t, env)
+
+		// One full batch is caught up on; the second in a row resyncs.
+		events := openStream(t, srv, "0-0")
+		var names []string
+		for {
+			ev := nextEvent(t, events)
+			names = append(names, ev.Name)
+			if ev.Name == "resync" {
+				if ev.Data != `{"reason":"lagging"}` || ev.ID != last {
+					t.Errorf("resync = %+v, want the head %s", ev, last)
+				}
+				break
+			}
+		}
+		if want := "ready feed feed counters resync"; strings.Join(names, " ") != want {
+			t.Errorf("events = %v, want %s", names, want)
+		}
+	})
+}
+
+func TestStreamRejects(t *testing.T) {
+	t.Run("too many streams", func(t *testing.T) {
+		withStreamConfig(t, func(c *StreamConfig) { c.MaxClients = 0 })
+		env := newHandlerEnv(t, true)
+		w := serve(env.router, "GET", "/dashboard/api/stream", "")
+		if w.Code != 503 || errorCode(t, w) != "too_many_streams" {
+			t.Errorf("status %d: %s", w.Code, w.Body.String())
+		}
+	})
+	t.Run("malformed Last-Event-ID", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		w := serve(env.router, "GET", "/dashboard/api/stream", "", "Last-Event-ID", "12-x")
+		if w.Code != 400 || errorCode(t, w) != "invalid_last_event_id" {
+			t.Errorf("status %d: %s", w.Code, w.Body.String())
+		}
+	})
+	t.Run("no telemetry", func(t *testing.T) {
+		env := newHandlerEnv(t, false)
+		w := serve(env.router, "GET", "/dashboard/api/stream", "")
+		if w.Code != 503 || errorCode(t, w) != "telemetry_unavailable" {
+			t.Errorf("status %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestStrikesPublishQuarantineEvents(t *testing.T) {
+	withStrikePolicy(t, func(p *StrikePolicy) { p.HealWeight = 5 })
+	env := newHandlerEnv(t, true)
+	ctx := context.Background()
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+
+	env.logic.ProcessDeletionError(span, ctx, 42, errors.New("PEER_ID_INVALID"))
+	env.logic.HealDeletionStrikes(ctx, 42)
+
+	events, err := env.store.EventsAfter(ctx, "0-0", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []string
+	for _, e := range events {
+		var q QuarantineEvent
+		if e.Type != MonitorEventQuarantine || json.Unmarshal(e.Data, &q) != nil || q.TelegramID != 42 {
+			t.Fatalf("unexpected event %s %s", e.Type, e.Data)
+		}
+		changes = append(changes, q.Change+"/"+q.Reason)
+	}
+	if got, want := strings.Join(changes, " "), "struck/peer_id_invalid cleared/heal"; got != want {
+		t.Errorf("quarantine events = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,301 @@
+// logic/telegram_monitoring_strikes.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- DECAYING STRIKE SCORE ---
+//
+// A strike is no longer a bare counter. Each ID keeps a score that halves
+// every StrikePolicy.HalfLife, plus the raw signals that moved it:
+//
+//   monitor:strikes:<id>  HASH { score, ts }  score as of ts (unix ms)
+//   monitor:signals:<id>  LIST of StrikeSignal JSON, newest first
+//
+// Deletion errors add their rule's weight, successes subtract HealWeight.
+// Sporadic blips decay away; persistent failures still climb to the threshold.
+//
+// Both transitions run as one Lua script each, so concurrent signals for the
+// same ID (other goroutines, other replicas) cannot interleave between the
+// read, the decay and the write.
+
+const strikeScoreFloor = 0.01 // below this the ID is considered clean
+
+// Strike transition verdicts returned by strikeScript.
+const (
+	StrikeRecorded  = "strike"    // below threshold
+	StrikeHeld      = "held"      // at threshold, but evidence spans less than MinSpan
+	StrikeThreshold = "threshold" // at threshold: the caller decides kill / shadow / review
+)
+
+// Heal transition results returned by healScript.
+const (
+	HealNone    = "none"    // no strikes on record
+	HealLowered = "lowered" // score went down but is still above the floor
+	HealCleared = "cleared" // score fell below the floor; strikes and quarantine entry dropped
+)
+
+// strikeScript adds one weighted strike on top of the decayed score. Its
+// keys span slots, which is why the store needs a single Redis node.
+//
+//	KEYS: strikes, signals, quarantine, watchlist, quarantine meta
+//	ARGV: id, now_ms, weight, half_life_ms, threshold, ttl_s, max_signals,
+//	      min_span_s, rule, verdict
+//
+// Returns {verdict, score, first_seen}. Numbers come back as strings because
+// Lua would truncate them to integers.
+var strikeScript = redis.NewScript(`
+local now_ms = tonumber(ARGV[2])
+local now_s = math.floor(now_ms / 1000)
+
+-- Quarantine keeps the shape it has until MigrateQuarantine runs.
+local qtype = redis.call('TYPE', KEYS[3]).ok
+if qtype == 'none' or qtype == 'zset' then
+	redis.call('ZADD', KEYS[3], 'NX', now_s, ARGV[1])
+	qtype = 'zset'
+elseif qtype == 'set' then
+	redis.call('SADD', KEYS[3], ARGV[1])
+end
+redis.call('SADD', KEYS[4], ARGV[1])
+
+local score, ts = 0, now_ms
+local stype = redis.call('TYPE', KEYS[1]).ok
+if stype == 'hash' then
+	score = tonumber(redis.call('HGET', KEYS[1], 'score') or '0') or 0
+	ts = tonumber(redis.call('HGET', KEYS[1], 'ts') or now_ms) or now_ms
+elseif stype == 'string' then
+	score = tonumber(redis.call('GET', KEYS[1])) or 0
+end
+local half = tonumber(ARGV[4])
+if half > 0 and score > 0 and now_ms > ts then
+	score = score * math.pow(0.5, (now_ms - ts) / half)
+end
+local weight = tonumber(ARGV[3])
+score = score + weight
+
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'score', tostring(score), 'ts', now_ms)
+redis.call('EXPIRE', KEYS[1], ARGV[6])
+redis.call('LPUSH', KEYS[2], cjson.encode({ts = now_s, kind = 'strike', rule = ARGV[9], verdict = ARGV[10], weight = weight, score = score}))
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[7]) - 1)
+redis.call('EXPIRE', KEYS[2], ARGV[6])
+
+local first = 0
+if qtype == 'zset' then
+	first = tonumber(redis.call('ZSCORE', KEYS[3], ARGV[1]) or '0') or 0
+end
+local entered = first
+if entered == 0 then
+	entered = now_s
+end
+redis.call('HSETNX', KEYS[5], ARGV[1], cjson.encode({entered_at = entered, rule = ARGV[9], verdict = ARGV[10]}))
+if first == 0 then
+	local ok, meta = pcall(cjson.decode, redis.call('HGET', KEYS[5], ARGV[1]))
+	if ok and type(meta) == 'table' then
+		first = tonumber(meta.entered_at) or 0
+	end
+end
+
+local verdict = 'strike'
+if score >= tonumber(ARGV[5]) then
+	verdict = 'threshold'
+	local span = tonumber(ARGV[8])
+	if span > 0 and first > 0 and now_s - first < span then
+		verdict = 'held'
+	end
+end
+return {verdict, tostring(score), tostring(first)}
+`)
+
+// healScript subtracts HealWeight from the decayed score, or clears the ID
+// once it falls below strikeScoreFloor.
+//
+//	KEYS: strikes, signals, quarantine, quarantine meta
+//	ARGV: id, now_ms, heal_weight, half_life_ms, floor, ttl_s, max_signals
+//
+// Returns {result, score}.
+var healScript = redis.NewScript(`
+local stype = redis.call('TYPE', KEYS[1]).ok
+if stype == 'none' then
+	return {'none', '0'}
+end
+
+local now_ms = tonumber(ARGV[2])
+local score, ts = 0, now_ms
+if stype == 'hash' then
+	score = tonumber(redis.call('HGET', KEYS[1], 'score') or '0') or 0
+	ts = tonumber(redis.call('HGET', KEYS[1], 'ts') or now_ms) or now_ms
+elseif stype == 'string' then
+	score = tonumber(redis.call('GET', KEYS[1])) or 0
+end
+local half = tonumber(ARGV[4])
+if half > 0 and score > 0 and now_ms > ts then
+	score = score * math.pow(0.5, (now_ms - ts) / half)
+end
+local heal = tonumber(ARGV[3])
+score = score - heal
+if score < 0 then
+	score = 0
+end
+
+if score < tonumber(ARGV[5]) then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	local qtype = redis.call('TYPE', KEYS[3]).ok
+	if qtype == 'zset' then
+		redis.call('ZREM', KEYS[3], ARGV[1])
+	elseif qtype == 'set' then
+		redis.call('SREM', KEYS[3], ARGV[1])
+	end
+	redis.call('HDEL', KEYS[4], ARGV[1])
+	return {'cleared', '0'}
+end
+
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'score', tostring(score), 'ts', now_ms)
+redis.call('EXPIRE', KEYS[1], ARGV[6])
+redis.call('LPUSH', KEYS[2], cjson.encode({ts = math.floor(now_ms / 1000), kind = 'heal', weight = -heal, score = score}))
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[7]) - 1)
+redis.call('EXPIRE', KEYS[2], ARGV[6])
+return {'lowered', tostring(score)}
+`)
+
+// StrikeTransition is what one strike did. Verdict is StrikeRecorded,
+// StrikeHeld or StrikeThreshold.
+type StrikeTransition struct {
+	Verdict   string
+	Score     float64
+	FirstSeen int64 // unix seconds the ID entered quarantine, 0 if unknown
+}
+
+// applyStrike runs strikeScript for one deletion signal.
+func applyStrike(ctx context.Context, r redis.Cmdable, telegramID int64, match DeletionClassification, weight float64, now time.Time, policy StrikePolicy) (StrikeTransition, error) {
+	id := strconv.FormatInt(telegramID, 10)
+	res, err := strikeScript.Run(ctx, r,
+		[]string{keyspace.Strikes(telegramID), keyspace.Signals(telegramID), keyspace.Quarantine, keyspace.Watchlist, keyspace.QuarantineMeta},
+		id, now.UnixMilli(), weight, policy.HalfLife.Std().Milliseconds(), policy.Threshold,
+		int64(policy.TTL.Std().Seconds()), policy.MaxSignals, int64(policy.MinSpan.Std().Seconds()),
+		match.RuleID, string(match.Verdict),
+	).Slice()
+	if err != nil {
+		return StrikeTransition{}, err
+	}
+	if len(res) != 3 {
+		return StrikeTransition{}, fmt.Errorf("strike script: unexpected reply %v", res)
+	}
+
+	t := StrikeTransition{Verdict: fmt.Sprint(res[0])}
+	t.Score, _ = strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	first, _ := strconv.ParseFloat(fmt.Sprint(res[2]), 64)
+	t.FirstSeen = int64(first)
+	return t, nil
+}
+
+// applyHeal runs healScript for one successful lookup.
+func applyHeal(ctx context.Context, r redis.Cmdable, telegramID int64, now time.Time, policy StrikePolicy) (string, float64, error) {
+	res, err := healScript.Run(ctx, r,
+		[]string{keyspace.Strikes(telegramID), keyspace.Signals(telegramID), keyspace.Quarantine, keyspace.QuarantineMeta},
+		strconv.FormatInt(telegramID, 10), now.UnixMilli(), policy.HealWeight, policy.HalfLife.Std().Milliseconds(),
+		strikeScoreFloor, int64(policy.TTL.Std().Seconds()), policy.MaxSignals,
+	).Slice()
+	if err != nil {
+		return "", 0, err
+	}
+	if len(res) != 2 {
+		return "", 0, fmt.Errorf("heal script: unexpected reply %v", res)
+	}
+	score, _ := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	return fmt.Sprint(res[0]), score, nil
+}
+
+type StrikeSignal struct {
+	At      int64           `json:"ts"`             // unix seconds
+	Kind    string          `json:"kind"`           // "strike" or "heal"
+	Rule    string          `json:"rule,omitempty"` // classifier rule that matched
+	Verdict DeletionVerdict `json:"verdict,omitempty"`
+	Class   string          `json:"class,omitempty"` // signals recorded before rules existed
+	Weight  float64         `json:"weight"`
+	Score   float64         `json:"score"` // score right after this signal
+}
+
+// StrikeState is an ID's score as last written, before decay.
+type StrikeState struct {
+	Score     float64
+	UpdatedAt time.Time
+}
+
+// decayScore applies exponential decay: half the score is gone every halfLife.
+func decayScore(score float64, elapsed, halfLife time.Duration) float64 {
+	if score <= 0 || elapsed <= 0 || halfLife <= 0 {
+		return score
+	}
+	return score * math.Pow(0.5, elapsed.Seconds()/halfLife.Seconds())
+}
+
+// at returns the score decayed to t.
+func (s StrikeState) at(t time.Time, halfLife time.Duration) float64 {
+	return decayScore(s.Score, t.Sub(s.UpdatedAt), halfLife)
+}
+
+// loadStrikeState reads the stored score. Counters written before scores
+// decayed (plain STRING from INCR) are read as a score as of now.
+func loadStrikeState(ctx context.Context, r redis.Cmdable, telegramID int64) (StrikeState, bool, error) {
+	fields, err := r.HGetAll(ctx, keyspace.Strikes(telegramID)).Result()
+	if err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		legacy, gerr := r.Get(ctx, keyspace.Strikes(telegramID)).Float64()
+		if gerr != nil {
+			return StrikeState{}, false, gerr
+		}
+		return StrikeState{Score: legacy, UpdatedAt: time.Now()}, true, nil
+	}
+	if err != nil {
+		return StrikeState{}, false, err
+	}
+	if len(fields) == 0 {
+		return StrikeState{}, false, nil
+	}
+	return parseStrikeState(fields), true, nil
+}
+
+func parseStrikeState(fields map[string]string) StrikeState {
+	score, _ := strconv.ParseFloat(fields["score"], 64)
+	ms, _ := strconv.ParseInt(fields["ts"], 10, 64)
+	return StrikeState{Score: score, UpdatedAt: time.UnixMilli(ms)}
+}
+
+// killClaimTTL keeps a claim as long as the verdict that can restore it,
+// far past any strike TTL.
+const killClaimTTL = verdictRetention
+
+// claimKill takes the kill for telegramID. The claim is the idempotency key:
+// whoever sets it runs the DB side effects; everyone else who reached the
+// same verdict backs off. It outlives the strikes, so late signals from a
+// replica that lagged behind cannot kill twice; a restore releases it.
+func claimKill(ctx context.Context, r redis.Cmdable, telegramID int64, token string, ttl time.Duration) (bool, error) {
+	return r.SetNX(ctx, keyspace.KillClaim(telegramID), token, ttl).Result()
+}
+
+func releaseKillClaim(ctx context.Context, r redis.Cmdable, telegramID int64) error {
+	return r.Del(ctx, keyspace.KillClaim(telegramID)).Err()
+}
+
+// parseStrikeSignals decodes a signals list, skipping entries it cannot read.
+func parseStrikeSignals(raws []string) []StrikeSignal {
+	out := make([]StrikeSignal, 0, len(raws))
+	for _, raw := range raws {
+		var s StrikeSignal
+		if json.Unmarshal([]byte(raw), &s) == nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
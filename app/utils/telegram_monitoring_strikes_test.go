@@ -0,0 +1,325 @@
+// logic/telegram_monitoring_strikes_test.go
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/domain"
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestStrikeHealKillLifecycle(t *testing.T) {
+	withStrikePolicy(t, func(p *StrikePolicy) {
+		p.Threshold = 3
+		p.HealWeight = 1
+		p.HalfLife = 0 // no decay, so the threshold is crossed exactly
+	})
+	env := newHandlerEnv(t, true)
+	ctx := context.Background()
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+	deletion := errors.New("PEER_ID_INVALID")
+	const id = 42
+
+	quarantined := func() bool {
+		q, _ := env.store.IsQuarantined(ctx, id)
+		return q
+	}
+	score := func() float64 {
+		records, _ := env.store.LoadStrikes(ctx, []int64{id}, 10)
+		return records[0].State.at(time.Now(), CurrentStrikePolicy().HalfLife.Std())
+	}
+
+	env.logic.ProcessDeletionError(span, ctx, id, deletion)
+	env.logic.ProcessDeletionError(span, ctx, id, deletion)
+	if !quarantined() || math.Abs(score()-2) > 0.01 {
+		t.Fatalf("after two strikes: quarantined=%v score=%v", quarantined(), score())
+	}
+	if watched, _ := env.store.IsWatched(ctx, id); !watched {
+		t.Error("a strike should put the ID on the watchlist")
+	}
+
+	env.logic.HealDeletionStrikes(ctx, id)
+	if !quarantined() || math.Abs(score()-1) > 0.01 {
+		t.Fatalf("after heal: quarantined=%v score=%v", quarantined(), score())
+	}
+	if _, touched := env.users.isDeleted(id); touched {
+		t.Fatal("DB written before the threshold")
+	}
+
+	env.logic.ProcessDeletionError(span, ctx, id, deletion)
+	env.logic.ProcessDeletionError(span, ctx, id, deletion)
+	if deleted, _ := env.users.isDeleted(id); !deleted || !env.tracked.isStopped(id) {
+		t.Fatalf("kill switch did not run: deleted=%v stopped=%v", deleted, env.tracked.isStopped(id))
+	}
+	if quarantined() {
+		t.Error("kill should clear the quarantine entry")
+	}
+	verdicts, _ := env.store.Verdicts(ctx)
+	if len(verdicts) != 1 || verdicts[0].TelegramID != id || len(verdicts[0].Changes) != 2 || len(verdicts[0].Signals) == 0 {
+		t.Fatalf("verdicts = %+v", verdicts)
+	}
+
+	// The kill claim outlives the strikes: a second threshold crossing does
+	// not run the DB writes again.
+	env.users.deleted = map[int64]bool{}
+	for i := 0; i < 3; i++ {
+		env.logic.ProcessDeletionError(span, ctx, id, deletion)
+	}
+	if _, touched := env.users.isDeleted(id); touched {
+		t.Error("second kill ran the DB writes again")
+	}
+
+	// Restoring puts the DB back, resumes tracking and releases the claim.
+	w := serve(env.router, "POST", "/dashboard/api/verdicts/"+verdicts[0].ID+"/restore", "")
+	if w.Code != 200 {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+	if deleted, _ := env.users.isDeleted(id); deleted {
+		t.Error("restore left the account deleted")
+	}
+	if env.tracked.isStopped(id) {
+		t.Error("restore left tracking stopped")
+	}
+	restored, _ := env.store.LoadVerdict(ctx, verdicts[0].ID)
+	if n := len(restored.Changes); n == 0 || restored.Changes[n-1] != changeResumeTracking {
+		t.Errorf("verdict changes = %v, want the tracking resume last", restored.Changes)
+	}
+	if claimed, _ := env.store.ClaimKill(ctx, id, "probe", time.Minute); !claimed {
+		t.Error("restore did not release the kill claim")
+	}
+}
+
+func TestKillClaim(t *testing.T) {
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+	ctx := context.Background()
+	deletion := errors.New("PEER_ID_INVALID")
+	killPolicy := func(p *StrikePolicy) {
+		p.Threshold = 1
+		p.HalfLife = 0
+	}
+
+	t.Run("survives a monitor reset", func(t *testing.T) {
+		withStrikePolicy(t, killPolicy)
+		env := newHandlerEnv(t, true)
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if deleted, _ := env.users.isDeleted(42); !deleted {
+			t.Fatal("kill switch did not run")
+		}
+
+		runReset(t, env, `{"scope":"all","confirm":"`+resetConfirmToken(t, env)+`"}`)
+		env.users.deleted = map[int64]bool{}
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if _, touched := env.users.isDeleted(42); touched {
+			t.Error("a reset dropped the claim and the kill ran again")
+		}
+	})
+
+	t.Run("expires with its ttl", func(t *testing.T) {
+		env := newHandlerEnv(t, true)
+		now := time.Now()
+		env.store.Now = func() time.Time { return now }
+		if ok, _ := env.store.ClaimKill(ctx, 42, "a", time.Minute); !ok {
+			t.Fatal("first claim refused")
+		}
+		if ok, _ := env.store.ClaimKill(ctx, 42, "b", time.Minute); ok {
+			t.Fatal("claim taken twice")
+		}
+		now = now.Add(2 * time.Minute)
+		if ok, _ := env.store.ClaimKill(ctx, 42, "b", time.Minute); !ok {
+			t.Error("expired claim still held")
+		}
+	})
+
+	t.Run("handed back when the DB write fails", func(t *testing.T) {
+		withStrikePolicy(t, killPolicy)
+		env := newHandlerEnv(t, true)
+		env.users.err = errors.New("db down")
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if env.tracked.isStopped(42) {
+			t.Fatal("tracking stopped although the account was not marked deleted")
+		}
+
+		env.users.err = nil
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if deleted, _ := env.users.isDeleted(42); !deleted || !env.tracked.isStopped(42) {
+			t.Error("the retried kill did not run")
+		}
+	})
+
+	t.Run("rolled back when tracking cannot stop", func(t *testing.T) {
+		withStrikePolicy(t, killPolicy)
+		env := newHandlerEnv(t, true)
+		env.tracked.stopErr = errors.New("db down")
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if deleted, touched := env.users.isDeleted(42); !touched || deleted {
+			t.Fatalf("is_deleted = %v (written %v), want it put back to false", deleted, touched)
+		}
+		if verdicts, _ := env.store.Verdicts(ctx); len(verdicts) != 0 {
+			t.Fatalf("rolled-back kill left a verdict: %+v", verdicts)
+		}
+
+		env.tracked.stopErr = nil
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if deleted, _ := env.users.isDeleted(42); !deleted || !env.tracked.isStopped(42) {
+			t.Error("the retried kill did not run")
+		}
+	})
+}
+
+func TestHealClearsQuarantine(t *testing.T) {
+	withStrikePolicy(t, func(p *StrikePolicy) { p.HealWeight = 5 })
+	env := newHandlerEnv(t, true)
+	ctx := context.Background()
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+
+	env.logic.ProcessDeletionError(span, ctx, 42, errors.New("PEER_ID_INVALID"))
+	env.logic.HealDeletionStrikes(ctx, 42)
+	if q, _ := env.store.IsQuarantined(ctx, 42); q {
+		t.Error("a heal below the floor should clear the quarantine entry")
+	}
+	// Nothing on record: healing again is a no-op.
+	env.logic.HealDeletionStrikes(ctx, 42)
+}
+
+// ProcessDeletionSignal is the form without a cause: a definite deletion at
+// the default weight.
+func TestProcessDeletionSignalWithoutCause(t *testing.T) {
+	withStrikePolicy(t, func(p *StrikePolicy) { p.DefaultWeight = 2.5 })
+	env := newHandlerEnv(t, true)
+	ctx := context.Background()
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+
+	env.logic.ProcessDeletionSignal(span, ctx, 42)
+	recs, err := env.store.LoadStrikes(ctx, []int64{42}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs[0].Signals) != 1 || recs[0].Signals[0].Rule != UnmatchedRuleID || recs[0].Signals[0].Weight != 2.5 {
+		t.Errorf("signals = %+v, want one %s strike weighing 2.5", recs[0].Signals, UnmatchedRuleID)
+	}
+}
+
+func TestStrikeModes(t *testing.T) {
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+	ctx := context.Background()
+	deletion := errors.New("PEER_ID_INVALID")
+
+	t.Run("shadow", func(t *testing.T) {
+		withStrikePolicy(t, func(p *StrikePolicy) {
+			p.Threshold = 1
+			p.Mode = StrikeModeShadow
+		})
+		env := newHandlerEnv(t, true)
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if _, touched := env.users.isDeleted(42); touched {
+			t.Fatal("shadow mode wrote to the DB")
+		}
+		env.logic.HealDeletionStrikes(ctx, 42)
+		// 43 was deleted by other means; only reconciling finds out.
+		env.logic.ProcessDeletionError(span, ctx, 43, deletion)
+		env.tracked.identities[43] = &domain.TrackedIdentity{IsDeleted: true}
+		env.tracked.queried = nil
+
+		outcomes := func() map[string]interface{} {
+			body := decodeBody(t, serve(env.router, "GET", "/dashboard/api/shadow", ""))
+			out := map[string]interface{}{}
+			for _, v := range body["verdicts"].([]interface{}) {
+				v := v.(map[string]interface{})
+				out[fmt.Sprint(v["id"])] = v["outcome"]
+			}
+			return out
+		}
+		want := map[string]interface{}{"42": ShadowOutcomeFalsePositive, "43": ShadowOutcomePending}
+		if got := outcomes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("shadow verdicts = %v, want %v", got, want)
+		}
+		if len(env.tracked.queried) != 0 {
+			t.Errorf("GET looked up %v in the DB", env.tracked.queried)
+		}
+
+		body := decodeBody(t, serve(env.router, "POST", "/dashboard/api/shadow/reconcile", ""))
+		if body["checked"] != 1.0 || body["confirmed"] != 1.0 {
+			t.Errorf("reconcile = %v, want 1 checked and 1 confirmed", body)
+		}
+		want["43"] = ShadowOutcomeConfirmed
+		if got := outcomes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("after reconcile: shadow verdicts = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("review", func(t *testing.T) {
+		withStrikePolicy(t, func(p *StrikePolicy) {
+			p.Threshold = 1
+			p.Review.Enabled = true
+		})
+		env := newHandlerEnv(t, true)
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		if _, touched := env.users.isDeleted(42); touched {
+			t.Fatal("review mode wrote to the DB before approval")
+		}
+
+		if w := serve(env.router, "POST", "/dashboard/api/review/42/approve", ""); w.Code != 200 {
+			t.Fatalf("approve: %d %s", w.Code, w.Body.String())
+		}
+		if deleted, _ := env.users.isDeleted(42); !deleted {
+			t.Error("approval did not run the kill")
+		}
+		if w := serve(env.router, "POST", "/dashboard/api/review/42/approve", ""); w.Code != 404 {
+			t.Errorf("second approve: status %d, want 404", w.Code)
+		}
+		if w := serve(env.router, "POST", "/dashboard/api/review/abc/approve", ""); w.Code != 400 {
+			t.Errorf("malformed id: status %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("review approval that cannot kill", func(t *testing.T) {
+		withStrikePolicy(t, func(p *StrikePolicy) {
+			p.Threshold = 1
+			p.Review.Enabled = true
+		})
+		env := newHandlerEnv(t, true)
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+
+		// Another replica is executing a verdict for the account.
+		lease, err := env.store.Leases().Acquire(ctx, "verdict:42", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := serve(env.router, "POST", "/dashboard/api/review/42/approve", "")
+		if w.Code != 409 || errorCode(t, w) != "verdict_busy" {
+			t.Fatalf("approve under a held lease: %d %s", w.Code, w.Body.String())
+		}
+		if _, touched := env.users.isDeleted(42); touched {
+			t.Fatal("kill ran under someone else's lease")
+		}
+		if pending, _ := env.store.PendingReviews(ctx); len(pending) != 1 {
+			t.Fatalf("verdict not put back in the queue: %v", pending)
+		}
+
+		_, _ = env.store.Leases().Release(ctx, lease)
+		if w := serve(env.router, "POST", "/dashboard/api/review/42/approve", ""); w.Code != 200 {
+			t.Fatalf("retried approve: %d %s", w.Code, w.Body.String())
+		}
+		if deleted, _ := env.users.isDeleted(42); !deleted {
+			t.Error("retried approval did not run the kill")
+		}
+	})
+
+	t.Run("no telemetry", func(t *testing.T) {
+		env := newHandlerEnv(t, false)
+		// Must not panic.
+		env.logic.ProcessDeletionError(span, ctx, 42, deletion)
+		env.logic.HealDeletionStrikes(ctx, 42)
+	})
+}
@@ -0,0 +1,106 @@
+// logic/telegram_monitoring_taxonomy.go
+package logic
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- ERROR TAXONOMY ---
+//
+// total_errs says "something failed"; this says what. Every upstream failure
+// is counted under its UpstreamError code, overall and per minute:
+//
+//   monitor:errors:by_code               HASH code -> count
+//   monitor:ts:errcode:<code>:<minute>   STRING count (same bucketing as monitor:ts:err)
+//
+// The stats endpoint reports the top codes with a sparkline each, and
+// ?class=<code> narrows the error line of the traffic graph to one code.
+
+const (
+	errorTaxonomyTopN    = 5
+	errorTaxonomyMaxTopN = 20
+	errorTaxonomyMinutes = 30 // matches the traffic graph window
+)
+
+type ErrorClassStat struct {
+	Code   string  `json:"code"`
+	Total  int64   `json:"total"`
+	Series []int64 `json:"series"` // per minute, oldest first
+}
+
+// RecordUpstreamFailure counts err under its upstream code. The lookup path
+// calls it next to the global error counter.
+func (l TelegramMonitor) RecordUpstreamFailure(ctx context.Context, err error) {
+	store := l.monitorStore()
+	if store == nil {
+		return
+	}
+	ue := AsUpstreamError(err)
+	if ue == nil {
+		return
+	}
+	if recErr := store.RecordErrorCode(ctx, ue.Code, time.Now()); recErr != nil {
+		logger.ZSLogger.Errorw("failed to count upstream error", "code", ue.Code, "error", recErr)
+	}
+}
+
+func recordErrorCode(ctx context.Context, r redis.Cmdable, code string, now time.Time) error {
+	key := keyspace.ErrorCodeMinute(code, now.Unix()/60)
+	_, err := r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, keyspace.ErrorsByCode, code, 1)
+		pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, keyspace.ErrorCodeSeriesTTL)
+		return nil
+	})
+	return err
+}
+
+// topErrorClasses returns the n most frequent codes with their recent series.
+func topErrorClasses(ctx context.Context, store MonitorStore, totals map[string]int64, n int, now time.Time) []ErrorClassStat {
+	stats := make([]ErrorClassStat, 0, len(totals))
+	for code, total := range totals {
+		stats = append(stats, ErrorClassStat{Code: code, Total: total})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Code < stats[j].Code
+	})
+	if len(stats) > n {
+		stats = stats[:n]
+	}
+
+	for i := range stats {
+		stats[i].Series, _ = store.ErrorCodeSeries(ctx, stats[i].Code, errorTaxonomyMinutes, now)
+	}
+	return stats
+}
+
+// errorCodeSeries reads the last `minutes` per-minute counts for code.
+func errorCodeSeries(ctx context.Context, r redis.Cmdable, code string, minutes int, now time.Time) ([]int64, error) {
+	current := now.Unix() / 60
+	pipe := r.Pipeline()
+	cmds := make([]*redis.StringCmd, 0, minutes)
+	for i := minutes - 1; i >= 0; i-- {
+		cmds = append(cmds, pipe.Get(ctx, keyspace.ErrorCodeMinute(code, current-int64(i))))
+	}
+	executed, _ := pipe.Exec(ctx)
+	for _, cmd := range executed {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	series := make([]int64, len(cmds))
+	for i, cmd := range cmds {
+		series[i], _ = cmd.Int64()
+	}
+	return series, nil
+}
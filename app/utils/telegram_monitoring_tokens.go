@@ -0,0 +1,376 @@
+// logic/telegram_monitoring_tokens.go
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// --- MACHINE API TOKENS ---
+//
+// Tokens look like "pxt_<id>_<secret>". The id locates the record, the secret
+// is only ever stored as a SHA-256. Each token has a role, an expiry and an
+// optional IP allowlist, and remembers when and from where it was last used.
+
+const (
+	apiTokenPrefix = "pxt_"
+
+	ctxKeyDashboardAuth = "dashboard_auth"
+
+	defaultAPITokenTTL = 30 * 24 * time.Hour
+	maxAPITokenTTL     = 365 * 24 * time.Hour
+)
+
+type DashboardAPIToken struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Role       DashboardRole `json:"role"`
+	AllowedIPs []string      `json:"allowed_ips"`
+	CreatedBy  string        `json:"created_by"`
+	CreatedAt  int64         `json:"created_at"`
+	ExpiresAt  int64         `json:"expires_at"`
+	LastUsedAt int64         `json:"last_used_at,omitempty"`
+	LastUsedIP string        `json:"last_used_ip,omitempty"`
+
+	secretHash string
+}
+
+// CreateAPIToken mints a token and returns its plain value. The plain value
+// is not recoverable afterwards.
+func (a *DashboardAuth) CreateAPIToken(ctx context.Context, name string, role DashboardRole, ttl time.Duration, allowedIPs []string, createdBy string) (string, *DashboardAPIToken, error) {
+	if !role.Valid() {
+		return "", nil, fmt.Errorf("unknown role %q", role)
+	}
+	if ttl <= 0 {
+		ttl = defaultAPITokenTTL
+	}
+	if ttl > maxAPITokenTTL {
+		return "", nil, fmt.Errorf("ttl exceeds %s", maxAPITokenTTL)
+	}
+	for _, entry := range allowedIPs {
+		if parseIPRule(entry) == nil {
+			return "", nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := newSessionToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	tok := &DashboardAPIToken{
+		ID:         id,
+		Name:       name,
+		Role:       role,
+		AllowedIPs: allowedIPs,
+		CreatedBy:  createdBy,
+		CreatedAt:  now.Unix(),
+		ExpiresAt:  now.Add(ttl).Unix(),
+		secretHash: hashAPITokenSecret(secret),
+	}
+
+	key := keyspace.APIToken(id)
+	_, err = a.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"name":        tok.Name,
+			"role":        string(tok.Role),
+			"allowed_ips": strings.Join(tok.AllowedIPs, ","),
+			"created_by":  tok.CreatedBy,
+			"created_at":  tok.CreatedAt,
+			"expires_at":  tok.ExpiresAt,
+			"secret_hash": tok.secretHash,
+		})
+		pipe.ExpireAt(ctx, key, time.Unix(tok.ExpiresAt, 0))
+		pipe.SAdd(ctx, keyspace.APITokens, id)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return apiTokenPrefix + id + "_" + secret, tok, nil
+}
+
+// ListAPITokens returns live tokens and prunes expired ones from the index.
+func (a *DashboardAuth) ListAPITokens(ctx context.Context) ([]DashboardAPIToken, error) {
+	ids, err := a.redis.SMembers(ctx, keyspace.APITokens).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []DashboardAPIToken{}
+	for _, id := range ids {
+		tok, err := a.loadAPIToken(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			a.redis.SRem(ctx, keyspace.APITokens, id)
+			continue
+		}
+		out = append(out, *tok)
+	}
+	return out, nil
+}
+
+// RevokeAPIToken deletes the token; it stops working on the next request.
+func (a *DashboardAuth) RevokeAPIToken(ctx context.Context, id string) (bool, error) {
+	var del *redis.IntCmd
+	_, err := a.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = pipe.Del(ctx, keyspace.APIToken(id))
+		pipe.SRem(ctx, keyspace.APITokens, id)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return del.Val() > 0, nil
+}
+
+func (a *DashboardAuth) loadAPIToken(ctx context.Context, id string) (*DashboardAPIToken, error) {
+	fields, err := a.redis.HGetAll(ctx, keyspace.APIToken(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	tok := &DashboardAPIToken{
+		ID:         id,
+		Name:       fields["name"],
+		Role:       DashboardRole(fields["role"]),
+		AllowedIPs: []string{},
+		CreatedBy:  fields["created_by"],
+		LastUsedIP: fields["last_used_ip"],
+		secretHash: fields["secret_hash"],
+	}
+	if ips := fields["allowed_ips"]; ips != "" {
+		tok.AllowedIPs = strings.Split(ips, ",")
+	}
+	tok.CreatedAt, _ = strconv.ParseInt(fields["created_at"], 10, 64)
+	tok.ExpiresAt, _ = strconv.ParseInt(fields["expires_at"], 10, 64)
+	tok.LastUsedAt, _ = strconv.ParseInt(fields["last_used_at"], 10, 64)
+	return tok, nil
+}
+
+// authenticateBearer turns an Authorization: Bearer header into a principal.
+// A rejected token comes back as the APIError to answer with.
+func (a *DashboardAuth) authenticateBearer(c *gin.Context, raw string) (*DashboardSession, error) {
+	rest := strings.TrimPrefix(raw, apiTokenPrefix)
+	parts := strings.SplitN(rest, "_", 2)
+	if rest == raw || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, newAPIError(401, "malformed_token", "expected Bearer %s<id>_<secret>", apiTokenPrefix)
+	}
+	id, secret := parts[0], parts[1]
+
+	ctx := c.Request.Context()
+	tok, err := a.loadAPIToken(ctx, id)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to load api token", "token_id", id, "error", err)
+		return nil, newAPIError(500, "token_store_failed", "could not check the API token")
+	}
+	if tok == nil || subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(tok.secretHash)) != 1 {
+		return nil, newAPIError(401, "invalid_token", "unknown or revoked API token")
+	}
+	if time.Now().Unix() >= tok.ExpiresAt {
+		return nil, newAPIError(401, "token_expired", "API token expired")
+	}
+
+	ip := c.ClientIP()
+	if !ipAllowed(ip, tok.AllowedIPs) {
+		logger.ZSLogger.Warnw("api token used from disallowed ip", "token_id", id, "ip", ip)
+		return nil, newAPIError(403, "ip_not_allowed", "API token is not allowed from %s", ip)
+	}
+
+	a.redis.HSet(ctx, keyspace.APIToken(id), "last_used_at", time.Now().Unix(), "last_used_ip", ip)
+
+	return &DashboardSession{
+		Operator:  "token:" + tok.Name,
+		Role:      tok.Role,
+		TokenID:   tok.ID,
+		CreatedAt: tok.CreatedAt,
+		ExpiresAt: tok.ExpiresAt,
+	}, nil
+}
+
+func bearerToken(c *gin.Context) string {
+	h := c.GetHeader("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseIPRule(rule string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(rule); err == nil {
+		return n
+	}
+	ip := net.ParseIP(rule)
+	if ip == nil {
+		return nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+func ipAllowed(ip string, rules []string) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, rule := range rules {
+		if n := parseIPRule(rule); n != nil && n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DashboardAuthFrom returns the DashboardAuth that guarded this request.
+func DashboardAuthFrom(c *gin.Context) *DashboardAuth {
+	v, _ := c.Get(ctxKeyDashboardAuth)
+	a, _ := v.(*DashboardAuth)
+	return a
+}
+
+// --- HTTP HANDLERS ---
+
+// APITokenListResponse lists token metadata; secrets are never returned.
+type APITokenListResponse struct {
+	Tokens []DashboardAPIToken `json:"tokens"`
+}
+
+// CreateAPITokenResponse carries the plain token, shown this once.
+type CreateAPITokenResponse struct {
+	Token string             `json:"token"`
+	Meta  *DashboardAPIToken `json:"meta"`
+}
+
+// GET /dashboard/api/tokens
+func (l TelegramMonitor) ListAPITokens(c *gin.Context) {
+	tokens, err := DashboardAuthFrom(c).ListAPITokens(c.Request.Context())
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to list api tokens", "error", err)
+		abortWithError(c, newAPIError(500, "token_store_failed", "could not read API tokens"))
+		return
+	}
+	c.JSON(200, APITokenListResponse{Tokens: tokens})
+}
+
+// CreateAPITokenRequest is POST /dashboard/api/tokens. An empty role means
+// viewer; a zero TTL means the default.
+type CreateAPITokenRequest struct {
+	Name       string        `json:"name"`
+	Role       DashboardRole `json:"role"`
+	TTLHours   int           `json:"ttl_hours"`
+	AllowedIPs []string      `json:"allowed_ips"`
+}
+
+func (r CreateAPITokenRequest) role() DashboardRole {
+	if r.Role == "" {
+		return RoleViewer
+	}
+	return r.Role
+}
+
+func (r CreateAPITokenRequest) Validate() error {
+	if r.Name == "" {
+		return newAPIError(400, "missing_name", "name is required")
+	}
+	if !r.role().Valid() {
+		return newAPIError(400, "invalid_role", "unknown role %q", r.Role)
+	}
+	if r.TTLHours < 0 || time.Duration(r.TTLHours)*time.Hour > maxAPITokenTTL {
+		return newAPIError(400, "invalid_ttl", "ttl_hours must be between 0 and %d", int(maxAPITokenTTL.Hours()))
+	}
+	for _, entry := range r.AllowedIPs {
+		if parseIPRule(entry) == nil {
+			return newAPIError(400, "invalid_allowed_ips", "invalid IP or CIDR %q", entry)
+		}
+	}
+	return nil
+}
+
+// POST /dashboard/api/tokens { "name": "oncall", "role": "viewer", "ttl_hours": 720, "allowed_ips": ["10.0.0.0/8"] }
+func (l TelegramMonitor) CreateAPIToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// Nobody mints a token stronger than themselves.
+	sess := DashboardSessionFrom(c)
+	if !sess.Role.Allows(req.role()) {
+		abortWithError(c, newAPIError(403, "role_exceeds_caller", "cannot mint a %s token as %s", req.role(), sess.Role))
+		return
+	}
+
+	plain, tok, err := DashboardAuthFrom(c).CreateAPIToken(c.Request.Context(), req.Name, req.role(),
+		time.Duration(req.TTLHours)*time.Hour, req.AllowedIPs, sess.Operator)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to create api token", "name", req.Name, "error", err)
+		abortWithError(c, newAPIError(500, "token_store_failed", "could not store the API token"))
+		return
+	}
+
+	logger.ZSLogger.Infow("api token created", "token_id", tok.ID, "name", tok.Name, "role", tok.Role, "by", sess.Operator)
+	l.auditRequest(c, AuditActionTokenCreate, tok.ID, nil, tok)
+	c.JSON(200, CreateAPITokenResponse{Token: plain, Meta: tok})
+}
+
+// DELETE /dashboard/api/tokens/:id
+func (l TelegramMonitor) RevokeAPIToken(c *gin.Context) {
+	id := c.Param("id")
+	found, err := DashboardAuthFrom(c).RevokeAPIToken(c.Request.Context(), id)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to revoke api token", "token_id", id, "error", err)
+		abortWithError(c, newAPIError(500, "token_store_failed", "could not revoke the API token"))
+		return
+	}
+	if !found {
+		abortWithError(c, newAPIError(404, "token_not_found", "no API token %q", id))
+		return
+	}
+
+	logger.ZSLogger.Infow("api token revoked", "token_id", id, "by", dashboardActor(c))
+	l.auditRequest(c, AuditActionTokenRevoke, id, nil, nil)
+	c.JSON(200, StatusResponse{Status: "revoked"})
+}
@@ -0,0 +1,209 @@
+// logic/telegram_monitoring_upstream.go
+package logic
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/errors"
+)
+
+// --- UPSTREAM ERRORS (TDLib / Qt client) ---
+//
+// The Telegram clients hand us free text ("Qt error code: 400 ... Not Found",
+// "tdlib error 400: PEER_ID_INVALID", "FLOOD_WAIT_30"). UpstreamError parses
+// that once into a code we can classify, count and group by, and keeps the
+// raw message for humans.
+
+const (
+	UpstreamTDLib    = "tdlib"
+	UpstreamQt       = "qt"
+	UpstreamTelegram = "telegram" // neither client named itself
+
+	CodePeerIDInvalid = "PEER_ID_INVALID"
+	CodeUserNotFound  = "USER_NOT_FOUND"
+	CodeNotFound      = "NOT_FOUND"
+	CodeFloodWait     = "FLOOD_WAIT"
+	CodeTimeout       = "TIMEOUT"
+	CodeBadRequest    = "BAD_REQUEST"
+	CodeUnavailable   = "UPSTREAM_UNAVAILABLE"
+	CodeUnknown       = "UNKNOWN"
+)
+
+type UpstreamError struct {
+	Op        errors.Op
+	Upstream  string // UpstreamTDLib, UpstreamQt or UpstreamTelegram
+	Code      string // RPC-style code, e.g. PEER_ID_INVALID
+	Status    int    // numeric status the client reported, 0 if none
+	Retryable bool
+	Message   string // raw upstream message
+	Err       error
+}
+
+func (e *UpstreamError) Error() string {
+	var b strings.Builder
+	if e.Op != "" {
+		b.WriteString(string(e.Op))
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "%s %s", e.Upstream, e.Code)
+	if e.Message != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+	return b.String()
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+var (
+	reQtStatus    = regexp.MustCompile(`Qt error code: (\d+)`)
+	reTDLibStatus = regexp.MustCompile(`(?i)tdlib[^0-9]{0,16}(\d{3})`)
+	reRPCCode     = regexp.MustCompile(`\b([A-Z][A-Z0-9]*(?:_[A-Z0-9]+)+)\b`)
+	reTrailingNum = regexp.MustCompile(`_\d+$`)
+)
+
+// upstreamCodeAliases maps client-specific spellings onto the RPC code.
+var upstreamCodeAliases = map[string]string{
+	"tdlib_not_found_the_user": CodeUserNotFound,
+}
+
+var retryableCodes = map[string]bool{
+	CodeFloodWait:   true,
+	CodeTimeout:     true,
+	CodeUnavailable: true,
+}
+
+// NewUpstreamError parses a client failure. A nil err gives nil; an err
+// that already carries an UpstreamError keeps its code.
+func NewUpstreamError(op errors.Op, err error) *UpstreamError {
+	if err == nil {
+		return nil
+	}
+	var inner *UpstreamError
+	if stderrors.As(err, &inner) {
+		ue := *inner
+		ue.Op = op
+		ue.Err = err
+		return &ue
+	}
+	ue := ParseUpstreamMessage(err.Error())
+	ue.Op = op
+	ue.Err = err
+	return ue
+}
+
+// AsUpstreamError returns the UpstreamError in err's chain, or parses one
+// from the message if the caller never wrapped it.
+func AsUpstreamError(err error) *UpstreamError {
+	if err == nil {
+		return nil
+	}
+	var ue *UpstreamError
+	if stderrors.As(err, &ue) {
+		return ue
+	}
+	return NewUpstreamError("", err)
+}
+
+// ParseUpstreamMessage turns a raw TDLib / Qt message into an UpstreamError.
+func ParseUpstreamMessage(msg string) *UpstreamError {
+	ue := &UpstreamError{Upstream: UpstreamTelegram, Code: CodeUnknown, Message: msg}
+
+	if m := reQtStatus.FindStringSubmatch(msg); m != nil {
+		ue.Upstream = UpstreamQt
+		ue.Status, _ = strconv.Atoi(m[1])
+	} else if strings.Contains(strings.ToLower(msg), "tdlib") {
+		ue.Upstream = UpstreamTDLib
+		if m := reTDLibStatus.FindStringSubmatch(msg); m != nil {
+			ue.Status, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	ue.Code = upstreamCode(msg, ue.Status)
+	ue.Retryable = retryableCodes[ue.Code]
+	return ue
+}
+
+func upstreamCode(msg string, status int) string {
+	for alias, code := range upstreamCodeAliases {
+		if strings.Contains(msg, alias) {
+			return code
+		}
+	}
+	if m := reRPCCode.FindStringSubmatch(msg); m != nil {
+		// FLOOD_WAIT_30 -> FLOOD_WAIT; the seconds stay in Message.
+		return reTrailingNum.ReplaceAllString(m[1], "")
+	}
+
+	lower := strings.ToLower(msg)
+	switch {
+	case status == 400 && strings.Contains(msg, "Not Found"):
+		return CodeNotFound
+	case status == 429 || strings.Contains(lower, "too many requests"):
+		return CodeFloodWait
+	case strings.Contains(lower, "deadline exceeded") || strings.Contains(lower, "timeout"):
+		return CodeTimeout
+	case status >= 500:
+		return CodeUnavailable
+	case status >= 400:
+		return CodeBadRequest
+	}
+	return CodeUnknown
+}
+
+// FeedErrorFields is what the live feed stores next to "e" for a failed
+// lookup: code, upstream and retryable. Writers should merge it into the
+// feed item; items written before it existed are parsed from "e" on read.
+func FeedErrorFields(err error) map[string]interface{} {
+	ue := AsUpstreamError(err)
+	if ue == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"e":  ue.Message,
+		"ec": ue.Code,
+		"eu": ue.Upstream,
+		"er": ue.Retryable,
+	}
+}
+
+// LookupLogEntry is one lookup as telemetry writes it to the live feed and
+// to a watched ID's history. Telemetry is not strict about scalar types, so
+// IDs and times are read leniently.
+type LookupLogEntry struct {
+	ID        looseString `json:"id,omitempty"`
+	Time      looseString `json:"t,omitempty"`
+	Status    string      `json:"s,omitempty"` // "OK" or the failure status
+	TrackerID TelegramID  `json:"tr,omitempty"`
+	TargetID  TelegramID  `json:"tg,omitempty"`
+	Millis    json.Number `json:"ms,omitempty"`
+	// Error fields, see FeedErrorFields.
+	Error         string `json:"e,omitempty"`
+	ErrorCode     string `json:"ec,omitempty"`
+	ErrorUpstream string `json:"eu,omitempty"`
+	Retryable     bool   `json:"er,omitempty"`
+}
+
+// parseLookupLog decodes raw feed or history items, newest first as stored.
+// Unreadable items are skipped; items that only carry the raw "e" get
+// ec/eu/er parsed from it.
+func parseLookupLog(raws []string) []LookupLogEntry {
+	out := make([]LookupLogEntry, 0, len(raws))
+	for _, raw := range raws {
+		var item LookupLogEntry
+		if err := json.Unmarshal([]byte(raw), &item); err != nil {
+			continue
+		}
+		if item.Error != "" && item.ErrorCode == "" {
+			ue := ParseUpstreamMessage(item.Error)
+			item.ErrorCode, item.ErrorUpstream, item.Retryable = ue.Code, ue.Upstream, ue.Retryable
+		}
+		out = append(out, item)
+	}
+	return out
+}
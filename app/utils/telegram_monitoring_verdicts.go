@@ -0,0 +1,360 @@
+// logic/telegram_monitoring_verdicts.go
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"bitbucket.org/telexcoengineering/tracker-backend/logic/keyspace"
+	"bitbucket.org/telexcoengineering/tracker-backend/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+)
+
+// --- KILL VERDICTS (Reversible Kill Switch) ---
+//
+// Every kill writes a verdict record with what the account looked like
+// before: is_deleted, each tracker contact's status, and the strike history
+// that condemned it. POST /dashboard/api/verdicts/:id/restore puts the DB
+// back the way the record says.
+//
+//   dashboard:verdicts          ZSET verdict id by kill time
+//   dashboard:verdict:<id>      HASH { record, restored_at, restored_by }
+
+const (
+	verdictRetention    = 90 * 24 * time.Hour
+	AuditActionRestore  = "verdict.restore"
+	verdictListMaxLimit = 500
+)
+
+// Repo calls recorded in VerdictRecord.Changes and ShadowVerdict.WouldDo.
+const (
+	changeMarkDeleted    = "TelegramUserRepo.UpdateIsDeletedByTelegramID(true)"
+	changeStopTracking   = "TrackedTelegramUserRepo.StopTrackingForTelegramID"
+	changeResumeTracking = "TrackedTelegramUserRepo.ResumeTrackingForTelegramID"
+)
+
+// TrackingResumer undoes TrackedTelegramUserRepo.StopTrackingForTelegramID.
+// The tracked-user repository implements it; NewTelegramMonitor takes it so
+// a restore never finds it missing.
+type TrackingResumer interface {
+	ResumeTrackingForTelegramID(span opentracing.Span, ctx context.Context, telegramID int64) error
+}
+
+var ErrNoTrackingResumer = stderrors.New("the dashboard needs a TrackingResumer to restore kill verdicts")
+
+// RestoreVerdictRequest is POST /dashboard/api/verdicts/:id/restore.
+type RestoreVerdictRequest struct {
+	ID string `uri:"id"`
+}
+
+type VerdictContact struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+// VerdictSnapshot is the DB state a kill overwrote.
+type VerdictSnapshot struct {
+	IsDeleted bool             `json:"is_deleted"`
+	Contacts  []VerdictContact `json:"contacts"`
+}
+
+type VerdictRecord struct {
+	ID         string          `json:"id"`
+	TelegramID int64           `json:"telegram_id"`
+	At         int64           `json:"ts"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Fence      uint64          `json:"fence"` // verdict lease token the kill ran under
+	Strikes    float64         `json:"strikes"`
+	Threshold  float64         `json:"threshold"`
+	Signals    []StrikeSignal  `json:"signals"`
+	Before     VerdictSnapshot `json:"before"`
+	// Changes lists the repo calls the kill made, in order. A restore
+	// appends the call that resumed tracking.
+	Changes    []string `json:"changes"`
+	RestoredAt int64    `json:"restored_at,omitempty"`
+	RestoredBy string   `json:"restored_by,omitempty"`
+}
+
+func (v VerdictRecord) changed(call string) bool {
+	for _, c := range v.Changes {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+// captureVerdictBefore reads what a kill is about to overwrite. Missing
+// identity or contacts are recorded as such; the kill goes ahead regardless.
+func (l TelegramMonitor) captureVerdictBefore(span opentracing.Span, ctx context.Context, telegramID int64) VerdictSnapshot {
+	snap := VerdictSnapshot{Contacts: []VerdictContact{}}
+	if identity, err := l.TrackedTelegramUserRepo.GetIdentityByTrackedTelegramID(span, ctx, telegramID); err == nil && identity != nil {
+		snap.IsDeleted = identity.IsDeleted
+	}
+	contacts, err := l.TrackedTelegramUserRepo.GetTrackerContactsByTrackedTelegramID(span, ctx, telegramID)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to snapshot tracker contacts before kill", "telegram_id", telegramID, "error", err)
+	}
+	for _, t := range contacts {
+		snap.Contacts = append(snap.Contacts, VerdictContact{ID: t.ID, Status: t.Status})
+	}
+	return snap
+}
+
+func saveVerdict(ctx context.Context, r redis.Cmdable, v VerdictRecord) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-verdictRetention).Unix()
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, keyspace.Verdict(v.ID), "record", raw)
+		pipe.Expire(ctx, keyspace.Verdict(v.ID), verdictRetention)
+		pipe.ZAdd(ctx, keyspace.Verdicts, &redis.Z{Score: float64(v.At), Member: v.ID})
+		pipe.ZRemRangeByScore(ctx, keyspace.Verdicts, "-inf", fmt.Sprintf("(%d", cutoff))
+		return nil
+	})
+	return err
+}
+
+func loadVerdict(ctx context.Context, r redis.Cmdable, id string) (*VerdictRecord, error) {
+	fields, err := r.HGetAll(ctx, keyspace.Verdict(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseVerdict(fields)
+}
+
+// loadVerdicts reads every indexed verdict, newest first.
+func loadVerdicts(ctx context.Context, r redis.Cmdable) ([]VerdictRecord, error) {
+	ids, err := r.ZRevRange(ctx, keyspace.Verdicts, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := r.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, keyspace.Verdict(id))
+	}
+	_, _ = pipe.Exec(ctx)
+
+	verdicts := make([]VerdictRecord, 0, len(ids))
+	for _, cmd := range cmds {
+		v, err := parseVerdict(cmd.Val())
+		if err != nil || v == nil {
+			continue
+		}
+		verdicts = append(verdicts, *v)
+	}
+	return verdicts, nil
+}
+
+func parseVerdict(fields map[string]string) (*VerdictRecord, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var v VerdictRecord
+	if err := json.Unmarshal([]byte(fields["record"]), &v); err != nil {
+		return nil, err
+	}
+	v.RestoredAt, _ = strconv.ParseInt(fields["restored_at"], 10, 64)
+	v.RestoredBy = fields["restored_by"]
+	return &v, nil
+}
+
+// --- HTTP HANDLERS ---
+
+// ListVerdictsRequest is GET /dashboard/api/verdicts?telegram_id=&limit=.
+type ListVerdictsRequest struct {
+	TelegramID TelegramID `query:"telegram_id"` // 0 for every account
+	Limit      int        `query:"limit"`       // 0 for the default, capped at verdictListMaxLimit
+}
+
+func (r ListVerdictsRequest) Validate() error {
+	if r.TelegramID < 0 {
+		return newAPIError(400, "invalid_telegram_id", "telegram_id must be a positive integer")
+	}
+	if r.Limit < 0 {
+		return newAPIError(400, "invalid_limit", "limit must not be negative")
+	}
+	return nil
+}
+
+// VerdictListResponse lists kill verdicts, newest first.
+type VerdictListResponse struct {
+	Verdicts []VerdictRecord `json:"verdicts"`
+}
+
+// GET /dashboard/api/verdicts?telegram_id=&limit=
+func (l TelegramMonitor) ListVerdicts(c *gin.Context) {
+	var req ListVerdictsRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	ctx := c.Request.Context()
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	if limit > verdictListMaxLimit {
+		limit = verdictListMaxLimit
+	}
+	telegramID := int64(req.TelegramID)
+
+	all, err := store.Verdicts(ctx)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read verdict index", "error", err)
+		abortWithError(c, newAPIError(500, "verdict_read_failed", "could not read verdicts"))
+		return
+	}
+
+	verdicts := []VerdictRecord{}
+	for _, v := range all {
+		if telegramID != 0 && v.TelegramID != telegramID {
+			continue
+		}
+		verdicts = append(verdicts, v)
+		if len(verdicts) == limit {
+			break
+		}
+	}
+	c.JSON(200, VerdictListResponse{Verdicts: verdicts})
+}
+
+// POST /dashboard/api/verdicts/:id/restore
+func (l TelegramMonitor) RestoreVerdict(c *gin.Context) {
+	store := l.monitorStore()
+	if store == nil {
+		abortWithError(c, errTelemetryUnavailable)
+		return
+	}
+	var req RestoreVerdictRequest
+	if !bindParams(c, &req) {
+		return
+	}
+	ctx := c.Request.Context()
+	id := req.ID
+
+	v, err := store.LoadVerdict(ctx, id)
+	if err != nil {
+		logger.ZSLogger.Errorw("failed to read verdict", "verdict_id", id, "error", err)
+		abortWithError(c, newAPIError(500, "verdict_read_failed", "could not read the verdict"))
+		return
+	}
+	if v == nil {
+		abortWithError(c, newAPIError(404, "verdict_not_found", "no verdict %q", id))
+		return
+	}
+
+	stoppedTracking := v.changed(changeStopTracking)
+
+	lease, err := l.acquireVerdictLease(ctx, v.TelegramID)
+	if err == ErrLeaseHeld {
+		abortWithError(c, newAPIError(409, "verdict_busy", "another kill or restore holds account %d", v.TelegramID))
+		return
+	}
+	if err != nil {
+		abortWithError(c, newAPIError(500, "verdict_lease_failed", "could not lock account %d for the restore", v.TelegramID))
+		return
+	}
+	defer lease.release(ctx)
+
+	// Claim the restore so two clicks cannot both replay it.
+	actor := dashboardActor(c)
+	claimed, err := store.ClaimRestore(ctx, id, actor)
+	if err != nil {
+		abortWithError(c, newAPIError(500, "verdict_claim_failed", "could not claim the restore"))
+		return
+	}
+	if !claimed {
+		abortWithError(c, newAPIError(409, "already_restored", "verdict was already restored").With("restored_by", v.RestoredBy))
+		return
+	}
+
+	span := opentracing.StartSpan("Dashboard.RestoreVerdict")
+	defer span.Finish()
+
+	// Every DB write first confirms the lease is still ours. The write itself
+	// is not fenced, so this only narrows the window for a stalled holder.
+	var failures []string
+	lost := !lease.held(ctx)
+	if !lost {
+		if err := l.TelegramUserRepo.UpdateIsDeletedByTelegramID(span, ctx, v.TelegramID, v.Before.IsDeleted); err != nil {
+			logger.ZSLogger.Errorw("restore: failed to reset is_deleted", "telegram_id", v.TelegramID, "error", err)
+			failures = append(failures, "is_deleted: "+err.Error())
+		}
+	}
+	// Resume before the contacts, so the statuses from the snapshot win over
+	// whatever resuming sets them to.
+	resumed := false
+	if stoppedTracking {
+		if lost = lost || !lease.held(ctx); !lost {
+			if err := l.tracking.ResumeTrackingForTelegramID(span, ctx, v.TelegramID); err != nil {
+				logger.ZSLogger.Errorw("restore: failed to resume tracking", "telegram_id", v.TelegramID, "error", err)
+				failures = append(failures, "tracking: "+err.Error())
+			} else {
+				resumed = true
+			}
+		}
+	}
+	for _, t := range v.Before.Contacts {
+		if lost = lost || !lease.held(ctx); lost {
+			break
+		}
+		if err := l.TrackedTelegramUserRepo.UpdateTrackerContactStatus(span, ctx, t.ID, t.Status); err != nil {
+			logger.ZSLogger.Errorw("restore: failed to reset contact status", "telegram_id", v.TelegramID, "contact_id", t.ID, "error", err)
+			failures = append(failures, fmt.Sprintf("contact %d: %s", t.ID, err.Error()))
+		}
+	}
+
+	if lost {
+		failures = append(failures, "verdict lease expired mid-restore")
+	}
+	if len(failures) > 0 {
+		// Release the claim so the restore can be retried.
+		_ = store.ReleaseRestore(ctx, id)
+		abortWithError(c, newAPIError(500, "restore_incomplete", "%d restore step(s) failed; the restore can be retried", len(failures)).With("failures", failures))
+		return
+	}
+
+	if resumed {
+		v.Changes = append(v.Changes, changeResumeTracking)
+		if err := store.SaveVerdict(ctx, *v); err != nil {
+			logger.ZSLogger.Errorw("failed to record tracking resume on verdict", "verdict_id", id, "error", err)
+		}
+	}
+	now := time.Now().Unix()
+	if err := store.MarkRestored(ctx, id, now); err != nil {
+		// The DB is back, but the verdict still reads as live. Keep the claim so
+		// a retry answers 409 instead of replaying the restore.
+		logger.ZSLogger.Errorw("failed to mark verdict restored", "verdict_id", id, "telegram_id", v.TelegramID, "error", err)
+		abortWithError(c, newAPIError(500, "verdict_mark_failed", "the restore ran but could not be recorded on the verdict"))
+		return
+	}
+	// The account is tracked again, so a future kill must be able to claim it.
+	_ = store.ReleaseKillClaim(ctx, v.TelegramID)
+
+	logger.ZSLogger.Warnw("kill verdict restored", "verdict_id", id, "telegram_id", v.TelegramID, "operator", actor)
+	l.auditRequest(c, AuditActionRestore, strconv.FormatInt(v.TelegramID, 10),
+		gin.H{"verdict_id": id, "is_deleted": true, "tracking": "stopped"},
+		gin.H{"verdict_id": id, "is_deleted": v.Before.IsDeleted, "contacts": v.Before.Contacts, "tracking": "active"},
+	)
+
+	v.RestoredAt = now
+	v.RestoredBy = actor
+	c.JSON(200, v)
+}
@@ -0,0 +1,39 @@
+// logic/telegram_monitoring_verdicts_test.go
+package logic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// markRestoredFailingStore is a memory store whose MarkRestored always fails.
+type markRestoredFailingStore struct{ *MemoryMonitorStore }
+
+func (markRestoredFailingStore) MarkRestored(context.Context, string, int64) error {
+	return errors.New("redis: connection refused")
+}
+
+func TestRestoreVerdictUnrecorded(t *testing.T) {
+	ctx := context.Background()
+	env := newHandlerEnv(t, true)
+	router := newTestRouter(NewTelegramMonitor(env.logic.TelegramLogic, markRestoredFailingStore{env.store}, env.tracked), &DashboardSession{Operator: "tester", Role: RoleAdmin})
+	_ = env.store.SaveVerdict(ctx, VerdictRecord{ID: "v1", TelegramID: 42, At: time.Now().Unix(), Changes: []string{changeMarkDeleted, changeStopTracking}})
+	env.tracked.stopped[42] = true
+
+	w := serve(router, "POST", "/dashboard/api/verdicts/v1/restore", "")
+	if w.Code != 500 {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+	if code := errorCode(t, w); code != "verdict_mark_failed" {
+		t.Errorf("error = %s, want verdict_mark_failed", code)
+	}
+	if env.tracked.isStopped(42) {
+		t.Error("the DB writes should have run before the mark failed")
+	}
+	// The claim stays, so a retry does not replay the restore.
+	if w := serve(router, "POST", "/dashboard/api/verdicts/v1/restore", ""); w.Code != 409 {
+		t.Errorf("retry: %d %s", w.Code, w.Body.String())
+	}
+}